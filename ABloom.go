@@ -1,6 +1,7 @@
 package main
 
 import (
+	"TestProject/Server/GolangServer/secrets"
 	"context"
 	"encoding/csv"
 	"fmt"
@@ -18,9 +19,8 @@ const (
 	csvFilePath = "records_1000.csv" // Path to the CSV file
 
 	// Redis connection details
-	redisAddr     = "localhost:6379" // Redis server address
-	redisPassword = ""                // Password (leave empty if no password)
-	redisDB       = 0                 // Redis database number
+	redisAddr = "localhost:6379" // Redis server address
+	redisDB   = 0                // Redis database number
 
 	// Bloom filter name
 	bloomFilterName = "optimizeKeyRedisPerformance"
@@ -31,6 +31,12 @@ var (
 )
 
 func main() {
+	// REDIS_PASS may be a secret://path#key reference, leave it unset if no password
+	redisPassword, err := secrets.Resolve(ctx, os.Getenv("REDIS_PASS"))
+	if err != nil {
+		log.Fatalf("Failed to read the Redis password: %v", err)
+	}
+
 	// Connect to Redis
 	rdb := redis.NewClient(&redis.Options{
 		Addr:     redisAddr,
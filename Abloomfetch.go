@@ -1,6 +1,7 @@
 package main
 
 import (
+	"TestProject/Server/GolangServer/secrets"
 	"context"
 	"encoding/csv"
 	"fmt"
@@ -15,9 +16,8 @@ import (
 
 const (
 	// Redis connection details
-	redisAddr     = "localhost:6379" // Redis server address
-	redisPassword = ""               // Password (leave empty if no password)
-	redisDB       = 9                // Redis database number
+	redisAddr = "localhost:6379" // Redis server address
+	redisDB   = 9                // Redis database number
 
 	// Bloom filter name
 	bloomFilterName = "optimizeKeyRedisPerformance"
@@ -41,6 +41,12 @@ func generateKey(row []string) string {
 }
 
 func main() {
+	// REDIS_PASS may be a secret://path#key reference, leave it unset if no password
+	redisPassword, err := secrets.Resolve(ctx, os.Getenv("REDIS_PASS"))
+	if err != nil {
+		log.Fatalf("Failed to read the Redis password: %v", err)
+	}
+
 	// Connect to Redis
 	rdb := redis.NewClient(&redis.Options{
 		Addr:     redisAddr,
@@ -4,51 +4,29 @@ import (
 	"context"
 	"fmt"
 	"log"
-	"strconv"
+	"time"
+
+	redisclient "digi-model-engine/redis"
 
 	"github.com/go-redis/redis/v8"
 )
 
-// FetchAllValues fetches all values from a Redis hash and converts them to their proper Go types.
-func FetchAllValues(redisClient *redis.Client, hashKey string) (map[string]interface{}, error) {
-	ctx := context.Background()
-
-	// Fetch all fields and values from the hash
-	fieldsAndValues, err := redisClient.HGetAll(ctx, hashKey).Result()
-	if err != nil {
-		return nil, err
-	}
-
-	// Convert values to proper Go types
-	result := make(map[string]interface{})
-	for field, value := range fieldsAndValues {
-		convertedValue, err := convertToGoType(value)
-		if err != nil {
-			return nil, err
-		}
-		result[field] = convertedValue
-	}
-
-	return result, nil
+// RecordDetails is the hash of one record, the redis tags give every field its type
+type RecordDetails struct {
+	MetricsStatus string    `redis:"metrics_status" json:"metrics_status"`
+	EntityID      string    `redis:"entity_id" json:"entity_id"`
+	CreatedAt     time.Time `redis:"created_at,layout=2006-01-02 15:04:05" json:"created_at"`
+	IsInserted    bool      `redis:"IsInserted" json:"IsInserted"`
 }
 
-// convertToGoType converts a string value from Redis to its proper Go type.
-func convertToGoType(value string) (interface{}, error) {
-	// You can extend this function to handle more types as needed.
-	// Currently, it supports converting to int, float64, and string.
-
-	// Try converting to int
-	if intValue, err := strconv.Atoi(value); err == nil {
-		return intValue, nil
-	}
-
-	// Try converting to float64
-	if floatValue, err := strconv.ParseFloat(value, 64); err == nil {
-		return floatValue, nil
-	}
+// FetchAllValues fetches all values from a Redis hash and decodes them into their declared Go types.
+// found is false when there is no such hash.
+func FetchAllValues(redisClient *redis.Client, hashKey string) (RecordDetails, bool, error) {
+	ctx := context.Background()
 
-	// If no conversion is successful, return the original string value
-	return value, nil
+	details := RecordDetails{}
+	found, err := redisclient.NewClient(redisClient).HGetAllInto(ctx, hashKey, &details)
+	return details, found, err
 }
 
 func main() {
@@ -70,13 +48,14 @@ func main() {
 	hashKey := "yourHashKey"
 
 	// Example usage
-	details, err := FetchAllValues(redisClient, hashKey)
+	details, found, err := FetchAllValues(redisClient, hashKey)
 	if err != nil {
 		log.Fatal(err)
 	}
-
-	// Print the fetched details and their types
-	for field, value := range details {
-		fmt.Printf("%s: %v (Type: %T)\n", field, value, value)
+	if !found {
+		log.Fatalf("hash %s does not exist", hashKey)
 	}
+
+	// Print the fetched details
+	fmt.Printf("%+v\n", details)
 }
@@ -2,6 +2,7 @@
 package main
 
 import (
+	"TestProject/Server/GolangServer/secrets"
 	"context"
 	"fmt"
 	"log"
@@ -12,6 +13,12 @@ import (
 )
 
 func main() {
+	// the password is read from the secrets provider, set POSTGRES_PASSWORD for the default env provider
+	password, err := secrets.Resolve(context.Background(), "secret://postgres#password")
+	if err != nil {
+		log.Fatalf("Unable to read the database password: %v", err)
+	}
+
 	// Replace these connection details with your PostgreSQL server information
 	connConfig := pgxpool.Config{
 		ConnConfig: pgxpool.ConnConfig{
@@ -19,7 +26,7 @@ func main() {
 			Port:     5432,
 			Database: "your_database",
 			User:     "your_username",
-			Password: "your_password",
+			Password: password,
 		},
 		MaxConnLifetime: 5 * time.Minute,
 		MaxConns:        5,
@@ -2,78 +2,77 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"os"
 	"strconv"
 
+	redisclient "digi-model-engine/redis"
+
 	"github.com/go-redis/redis/v8"
 )
 
+// errRecordNotFound is returned when a claimed record was deleted or expired before it was read
+var errRecordNotFound = errors.New("record not found")
+
 // InsertRecordInPostgress is a placeholder function. You should replace it with your actual logic.
-func InsertRecordInPostgress(hashKey string, details map[string]interface{}) {
+// It must be idempotent on hashKey, for example INSERT ... ON CONFLICT DO NOTHING, as a record whose
+// claim expired is handed to another worker.
+func InsertRecordInPostgress(hashKey string, details RecordDetails) error {
 	// Replace this with your actual implementation
 	fmt.Printf("Inserting record in Postgres for hashKey: %s with details: %+v\n", hashKey, details)
 	// Implement your logic to insert the record into Postgres here
+	return nil
 }
 
-func processRecord(redisClient *redis.Client, hashKey string) error {
-	ctx := context.Background()
+// insertRecord is replaced in the tests
+var insertRecord = InsertRecordInPostgress
 
-	// Check if the hashKey exists in Redis
-	exists, err := redisClient.Exists(ctx, hashKey).Result()
+// processRecord moves the record at hashKey through NEW → CLAIMED → INSERTED. Only the worker holding the
+// claim inserts it, a failed insert leaves the record FAILED until it is claimed again for a retry.
+func processRecord(ctx context.Context, redisClient *redis.Client, queue *redisclient.RecordQueue, hashKey, owner string) error {
+	// Condition 1: HashKey doesn't exist, create a new record in Redis
+	created, err := queue.Create(ctx, hashKey)
 	if err != nil {
 		return err
 	}
-
-	// Get the IsInserted flag value
-	isInserted, err := redisClient.HGet(ctx, hashKey, "IsInserted").Result()
-	if err != nil && err != redis.Nil {
-		return err
+	if created {
+		fmt.Println("Condition 1: New record created in Redis (state NEW).")
+		return nil
 	}
 
-	// Convert isInserted to a boolean
-	isInsertedFlag, err := strconv.ParseBool(isInserted)
+	claim, err := queue.Claim(ctx, hashKey, owner)
 	if err != nil {
 		return err
 	}
+	if !claim.Claimed {
+		// Condition 2: inserted, claimed by another worker or waiting for a retry, nothing to do
+		fmt.Printf("Condition 2: Input hash key is %s after %d attempts. Nothing to do.\n", claim.State, claim.Attempts)
+		return nil
+	}
 
-	if exists == 0 {
-		// Condition 1: HashKey doesn't exist, create a new record in Redis (IsInserted set to false)
-		recordDetails := map[string]interface{}{
-			// Add your details here
-			"IsInserted": false, // Set the flag to false when creating a new record
-			// Add other details as needed
-		}
-
-		// Set the new record in Redis
-		err := redisClient.HMSet(ctx, hashKey, recordDetails).Err()
-		if err != nil {
-			return err
-		}
-
-		fmt.Println("Condition 1: New record created in Redis (IsInserted set to false).")
-	} else if isInsertedFlag {
-		// Condition 2: If IsInserted flag is true, do nothing and return a message
-		fmt.Println("Condition 2: Input hash key exists, and IsInserted flag is true. Nothing to do.")
-	} else {
-		// Condition 3: If IsInserted flag is false, update the flag and call InsertRecordInPostgress
-		err := redisClient.HSet(ctx, hashKey, "IsInserted", true).Err()
-		if err != nil {
-			return err
-		}
-
-		// Fetch the details from Redis
-		details, err := FetchAllValues(redisClient, hashKey)
-		if err != nil {
-			return err
+	// Condition 3: the record is ours, insert it into Postgres and mark it INSERTED
+	details, found, err := FetchAllValues(redisClient, hashKey)
+	if err == nil && !found {
+		// the record is gone, failing it would write a partial record back, Reap drops the stale claim
+		return fmt.Errorf("%s: %w", hashKey, errRecordNotFound)
+	}
+	if err == nil {
+		err = insertRecord(hashKey, details)
+	}
+	if err != nil {
+		retry, failErr := queue.Fail(ctx, claim, err)
+		if failErr != nil {
+			return failErr
 		}
-
-		// Call the function to insert record in Postgres
-		InsertRecordInPostgress(hashKey, details)
-
-		fmt.Println("Condition 3: IsInserted flag updated to true, and record inserted into Postgres.")
+		return fmt.Errorf("attempt %d of %s failed, retry %t: %w", claim.Attempts, hashKey, retry, err)
+	}
+	if err := queue.Complete(ctx, claim); err != nil {
+		return err
 	}
 
+	fmt.Println("Condition 3: Record inserted into Postgres and marked INSERTED.")
 	return nil
 }
 
@@ -92,11 +91,23 @@ func main() {
 		}
 	}()
 
-	// Replace "yourHashKey" with the actual hash key you are using
+	ctx := context.Background()
+	queue := redisclient.NewRecordQueue(redisclient.NewClient(redisClient))
+	hostname, _ := os.Hostname()
+	owner := hostname + "-" + strconv.Itoa(os.Getpid())
+
+	// requeue the records of the workers which died holding a claim
+	if reaped, err := queue.Reap(ctx); err != nil {
+		log.Fatal(err)
+	} else if reaped != 0 {
+		fmt.Printf("Requeued %d records with an expired claim.\n", reaped)
+	}
+
+	// Replace "yourHashKey" with the actual hash key you are using, metricSyncWorker.go drains every pending record
 	hashKey := "yourHashKey"
 
 	// Example usage
-	err := processRecord(redisClient, hashKey)
+	err := processRecord(ctx, redisClient, queue, hashKey, owner)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	redisclient "digi-model-engine/redis"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+// deleteBeforeRead deletes the record when it is read, as if it expired after the claim
+type deleteBeforeRead struct {
+	mr  *miniredis.Miniredis
+	key string
+}
+
+func (h deleteBeforeRead) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	if cmd.Name() == "hgetall" {
+		h.mr.Del(h.key)
+	}
+	return ctx, nil
+}
+
+func (h deleteBeforeRead) AfterProcess(ctx context.Context, cmd redis.Cmder) error { return nil }
+
+func (h deleteBeforeRead) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	return ctx, nil
+}
+
+func (h deleteBeforeRead) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	return nil
+}
+
+func TestProcessRecord(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+	queue := redisclient.NewRecordQueue(redisclient.NewClient(rdb))
+
+	var inserted []string
+	insertRecord = func(hashKey string, details RecordDetails) error {
+		inserted = append(inserted, hashKey)
+		return nil
+	}
+	t.Cleanup(func() { insertRecord = InsertRecordInPostgress })
+
+	// the first call creates the record, the second inserts it
+	for i := 0; i < 2; i++ {
+		if err := processRecord(ctx, rdb, queue, "present", "worker"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(inserted) != 1 || inserted[0] != "present" {
+		t.Errorf("inserted = %v, want present", inserted)
+	}
+	if state := mr.HGet("present", "state"); state != "INSERTED" {
+		t.Errorf("state = %q, want INSERTED", state)
+	}
+
+	// a record which is gone after the claim is not inserted and not written back
+	inserted = nil
+	if _, err := queue.Create(ctx, "missing"); err != nil {
+		t.Fatal(err)
+	}
+	rdb.AddHook(deleteBeforeRead{mr, "missing"})
+	if err := processRecord(ctx, rdb, queue, "missing", "worker"); !errors.Is(err, errRecordNotFound) {
+		t.Errorf("processRecord of a missing record = %v, want errRecordNotFound", err)
+	}
+	if len(inserted) != 0 {
+		t.Errorf("a missing record is inserted: %v", inserted)
+	}
+	if mr.Exists("missing") {
+		t.Error("the missing record is written back")
+	}
+}
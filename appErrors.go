@@ -0,0 +1,152 @@
+package apperrors
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Kind classifies an error so handlers can answer with the matching status code
+type Kind int
+
+const (
+	KindInternal Kind = iota
+	KindNotFound
+	KindValidation
+	KindConflict
+	KindUpstream
+)
+
+// Error is the typed error returned by the services and DAOs
+type Error struct {
+	Kind    Kind
+	Message string
+	// Details is sent to the client as the error field, e.g. per field validation messages
+	Details interface{}
+	Err     error
+}
+
+// Response is the error envelope, same shape as the one middlewares.ExceptionHandler sends
+type Response struct {
+	Success      bool        `json:"success"`
+	Message      string      `json:"message"`
+	ResponseCode int         `json:"responseCode"`
+	Data         interface{} `json:"data"`
+	Error        interface{} `json:"error"`
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %v", e.Message, e.Err)
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is lets errors.Is match on the kind, e.g. errors.Is(err, apperrors.ErrNotFound)
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Message == "" && t.Kind == e.Kind
+}
+
+// Kind only sentinels to be used with errors.Is
+var (
+	ErrNotFound   = &Error{Kind: KindNotFound}
+	ErrValidation = &Error{Kind: KindValidation}
+	ErrConflict   = &Error{Kind: KindConflict}
+	ErrUpstream   = &Error{Kind: KindUpstream}
+)
+
+// NotFound is returned when the requested record does not exist
+func NotFound(message string) *Error {
+	return &Error{Kind: KindNotFound, Message: message}
+}
+
+// Validation is returned when the request data is not acceptable
+func Validation(message string, details interface{}) *Error {
+	return &Error{Kind: KindValidation, Message: message, Details: details}
+}
+
+// Conflict is returned when the request clashes with the stored state
+func Conflict(message string) *Error {
+	return &Error{Kind: KindConflict, Message: message}
+}
+
+// Upstream wraps a failure of a dependency such as MongoDB or a fetched URL
+func Upstream(message string, err error) *Error {
+	return &Error{Kind: KindUpstream, Message: message, Err: err}
+}
+
+// Internal wraps any other failure
+func Internal(err error) *Error {
+	return &Error{Kind: KindInternal, Message: "internal server error", Err: err}
+}
+
+// KindOf returns the kind of err, plain errors are internal
+func KindOf(err error) Kind {
+	var appErr *Error
+	if errors.As(err, &appErr) {
+		return appErr.Kind
+	}
+	return KindInternal
+}
+
+// StatusCode maps err to the http status code sent to the client
+func StatusCode(err error) int {
+	switch KindOf(err) {
+	case KindNotFound:
+		return http.StatusNotFound
+	case KindValidation:
+		return http.StatusBadRequest
+	case KindConflict:
+		return http.StatusConflict
+	case KindUpstream:
+		return http.StatusBadGateway
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// NewResponse builds the envelope of err, internal details are never sent to the client
+func NewResponse(err error) Response {
+	resp := Response{Success: false, Message: "fail", ResponseCode: StatusCode(err)}
+
+	var appErr *Error
+	var httpErr *echo.HTTPError
+	switch {
+	case errors.As(err, &appErr) && appErr.Kind != KindInternal:
+		resp.Error = appErr.Message
+		if appErr.Details != nil {
+			resp.Error = appErr.Details
+		}
+	case errors.As(err, &httpErr):
+		resp.ResponseCode = httpErr.Code
+		resp.Error = httpErr.Message
+	default:
+		resp.Error = http.StatusText(http.StatusInternalServerError)
+	}
+	return resp
+}
+
+// HTTPErrorHandler is the echo error handler, it renders every returned error as the envelope
+func HTTPErrorHandler(err error, c echo.Context) {
+	if c.Response().Committed {
+		return
+	}
+	resp := NewResponse(err)
+	c.Logger().Error(err)
+
+	if c.Request().Method == http.MethodHead {
+		err = c.NoContent(resp.ResponseCode)
+	} else {
+		err = c.JSON(resp.ResponseCode, resp)
+	}
+	if err != nil {
+		c.Logger().Error(err)
+	}
+}
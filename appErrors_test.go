@@ -0,0 +1,58 @@
+package apperrors
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestStatusCode(t *testing.T) {
+	cases := []struct {
+		err  error
+		want int
+	}{
+		{NotFound("record not found"), http.StatusNotFound},
+		{Validation("bad input", nil), http.StatusBadRequest},
+		{Conflict("record already exists"), http.StatusConflict},
+		{Upstream("Error While Connecting To MongoDB", errors.New("timeout")), http.StatusBadGateway},
+		{Internal(errors.New("boom")), http.StatusInternalServerError},
+		{errors.New("plain"), http.StatusInternalServerError},
+		{fmt.Errorf("wrapped: %w", NotFound("record not found")), http.StatusNotFound},
+	}
+	for _, tc := range cases {
+		if got := StatusCode(tc.err); got != tc.want {
+			t.Errorf("StatusCode(%v) = %d, want %d", tc.err, got, tc.want)
+		}
+	}
+}
+
+func TestErrorsIsKind(t *testing.T) {
+	err := fmt.Errorf("dao: %w", NotFound("record not found"))
+	if !errors.Is(err, ErrNotFound) {
+		t.Error("expected errors.Is to match ErrNotFound")
+	}
+	if errors.Is(err, ErrConflict) {
+		t.Error("did not expect errors.Is to match ErrConflict")
+	}
+
+	cause := errors.New("socket closed")
+	if !errors.Is(Upstream("Error While Fetching Records", cause), cause) {
+		t.Error("expected the upstream cause to be unwrapped")
+	}
+}
+
+func TestNewResponse(t *testing.T) {
+	resp := NewResponse(Validation("invalid request", map[string]string{"loginId": "loginId is a required field"}))
+	if resp.Success || resp.Message != "fail" || resp.ResponseCode != http.StatusBadRequest {
+		t.Errorf("unexpected envelope %+v", resp)
+	}
+	if details, ok := resp.Error.(map[string]string); !ok || details["loginId"] == "" {
+		t.Errorf("expected field details in the envelope but got %+v", resp.Error)
+	}
+
+	resp = NewResponse(Internal(errors.New("password=secret")))
+	if resp.Error != http.StatusText(http.StatusInternalServerError) {
+		t.Errorf("internal error details must not leak, got %+v", resp.Error)
+	}
+}
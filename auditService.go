@@ -0,0 +1,112 @@
+package main
+
+import (
+	"TestProject/Server/GolangServer/apperrors"
+	"TestProject/Server/GolangServer/collection"
+	"TestProject/Server/GolangServer/confighelper"
+	"TestProject/Server/GolangServer/dbhelper"
+	"digi-data-ingestion-client/audit"
+
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Header naming who the client claims to be, the client IP is recorded without it.
+// The server has no authentication, so the entries record the actor as unverified.
+const auditActorHeader = "X-User-Id"
+
+// auditTrail is what the employee services need of the audit writer, main sets an *audit.Writer
+type auditTrail interface {
+	Record(ctx context.Context, entry audit.Entry) bool
+	History(ctx context.Context, collection, recordID string, page audit.Page) ([]audit.Entry, error)
+	Close(ctx context.Context) error
+}
+
+// employeeAudit records the changes of the employee profiles, the entries are dropped while it is nil
+var employeeAudit auditTrail
+
+var errNoAuditTrail = errors.New("audit trail is not configured")
+
+// Response of EmployeeHistoryService
+type employeeHistoryPage struct {
+	Entries []audit.Entry `json:"entries"`
+	Page    int64         `json:"page"`
+	Limit   int64         `json:"limit"`
+}
+
+// auditCollection returns the audit collection of the configured database, it is called for every batch
+// so the entries follow the client replaced after a config reload
+func auditCollection() (*mongo.Collection, error) {
+	client, err := dbhelper.GetConfiguredMongoClient()
+	if err != nil {
+		return nil, err
+	}
+	return client.Database(confighelper.Get().DBName).Collection(collection.AUDIT), nil
+}
+
+// auditContext returns the request context carrying who makes the request and its X-Request-ID
+func auditContext(c echo.Context) context.Context {
+	actor := c.Request().Header.Get(auditActorHeader)
+	if actor == "" {
+		actor = c.RealIP()
+	}
+	return audit.WithActor(c.Request().Context(), actor, c.Response().Header().Get(echo.HeaderXRequestID), false)
+}
+
+// recordEmployeeAudit queues the change of an employee profile, a nil before or after stands for no record
+func recordEmployeeAudit(requestCtx context.Context, action, loginId string, before, after interface{}) {
+	changes, err := audit.Diff(before, after)
+	if err != nil {
+		log.Print("Error While Comparing Record::", err)
+	}
+	entry := audit.Entry{
+		Action:     action,
+		Collection: collection.EMPLOYEE_PROFILE,
+		RecordID:   loginId,
+		Changes:    changes,
+	}
+	if employeeAudit == nil || !employeeAudit.Record(requestCtx, entry) {
+		log.Print("Audit Entry Dropped::", action, " ", loginId)
+	}
+}
+
+//List the audit trail of the input login Id, the latest change first
+func EmployeeHistoryService(c echo.Context) error {
+	loginId := c.Param("loginId")
+
+	page := audit.Page{Number: 1, Size: defaultPageLimit}
+	if limit := c.QueryParam("limit"); limit != "" {
+		parsed, err := strconv.ParseInt(limit, 10, 64)
+		if err != nil || parsed < 1 || parsed > maxPageLimit {
+			return apperrors.Validation(fmt.Sprintf("limit must be a number between 1 and %d", maxPageLimit), nil)
+		}
+		page.Size = parsed
+	}
+	if number := c.QueryParam("page"); number != "" {
+		parsed, err := strconv.ParseInt(number, 10, 64)
+		if err != nil || parsed < 1 {
+			return apperrors.Validation("page must be a number from 1", nil)
+		}
+		page.Number = parsed
+	}
+
+	if employeeAudit == nil {
+		return apperrors.Upstream("Error While Fetching History", errNoAuditTrail)
+	}
+	ctx, cancel := context.WithTimeout(c.Request().Context(), dbhelper.OperationTimeout)
+	defer cancel()
+	entries, err := employeeAudit.History(ctx, collection.EMPLOYEE_PROFILE, loginId, page)
+	if err != nil {
+		log.Print("Error While Fetching History::", err)
+		return apperrors.Upstream("Error While Fetching History", err)
+	}
+	return c.JSON(http.StatusOK, employeeHistoryPage{Entries: entries, Page: page.Number, Limit: page.Size})
+}
@@ -0,0 +1,275 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Actions of the audit entries
+const (
+	Create = "create"
+	Update = "update"
+	Upsert = "upsert"
+	Delete = "delete"
+	Push   = "push"
+)
+
+const (
+	// DefaultBufferSize is the number of entries a Writer holds before it drops new ones
+	DefaultBufferSize = 1024
+	batchSize         = 100
+	writeTimeout      = 10 * time.Second
+)
+
+// Entry records who did what to which record and when, Changes holds the fields before and after.
+// ActorVerified is false when Actor is only who the caller claims to be, a request header for instance.
+type Entry struct {
+	ID            primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Actor         string             `bson:"actor" json:"actor"`
+	ActorVerified bool               `bson:"actor_verified" json:"actor_verified"`
+	Action        string             `bson:"action" json:"action"`
+	Collection    string             `bson:"collection" json:"collection"`
+	RecordID      string             `bson:"record_id" json:"record_id"`
+	RequestID     string             `bson:"request_id,omitempty" json:"request_id,omitempty"`
+	At            time.Time          `bson:"at" json:"at"`
+	Changes       []Change           `bson:"changes,omitempty" json:"changes,omitempty"`
+}
+
+// Change is one field of the record, Before is nil when the field is new and After when it is removed
+type Change struct {
+	Field  string      `bson:"field" json:"field"`
+	Before interface{} `bson:"before,omitempty" json:"before,omitempty"`
+	After  interface{} `bson:"after,omitempty" json:"after,omitempty"`
+}
+
+// Diff returns the top level fields which differ between before and after, nil stands for no record.
+// Both are compared as the documents they are stored as, _id is left out as the entry names the record.
+func Diff(before, after interface{}) ([]Change, error) {
+	beforeDoc, err := document(before)
+	if err != nil {
+		return nil, err
+	}
+	afterDoc, err := document(after)
+	if err != nil {
+		return nil, err
+	}
+	fields := []string{}
+	for field := range beforeDoc {
+		fields = append(fields, field)
+	}
+	for field := range afterDoc {
+		if _, ok := beforeDoc[field]; !ok {
+			fields = append(fields, field)
+		}
+	}
+	sort.Strings(fields)
+
+	changes := []Change{}
+	for _, field := range fields {
+		if field == "_id" || reflect.DeepEqual(beforeDoc[field], afterDoc[field]) {
+			continue
+		}
+		changes = append(changes, Change{Field: field, Before: beforeDoc[field], After: afterDoc[field]})
+	}
+	return changes, nil
+}
+
+func document(value interface{}) (bson.M, error) {
+	doc := bson.M{}
+	if value == nil {
+		return doc, nil
+	}
+	bs, err := bson.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	return doc, bson.Unmarshal(bs, &doc)
+}
+
+type actorKey struct{}
+
+type actor struct {
+	actor     string
+	verified  bool
+	requestID string
+}
+
+// WithActor returns ctx carrying who makes the request and its id, the entries recorded with it are filled from it.
+// verified is true only when name comes from an authenticated session, it is stored as Entry.ActorVerified.
+func WithActor(ctx context.Context, name, requestID string, verified bool) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor{actor: name, verified: verified, requestID: requestID})
+}
+
+// Writer stores the entries in the background, a full buffer drops new entries instead of blocking the caller
+type Writer struct {
+	collection func() (*mongo.Collection, error)
+	onError    func(error)
+	entries    chan Entry
+	done       chan struct{}
+	dropped    int64
+	failed     int64
+
+	mutex  sync.RWMutex
+	closed bool
+}
+
+// NewWriter starts a writer holding up to bufferSize entries. collection is called for every batch so the writer
+// follows a client replaced after a config reload, onError receives the failed writes and may be nil.
+func NewWriter(collection func() (*mongo.Collection, error), bufferSize int, onError func(error)) *Writer {
+	if bufferSize <= 0 {
+		bufferSize = DefaultBufferSize
+	}
+	w := &Writer{
+		collection: collection,
+		onError:    onError,
+		entries:    make(chan Entry, bufferSize),
+		done:       make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+// Record queues entry and returns false when it was dropped. The actor and request id missing from entry
+// are taken from ctx, ctx is not used for the write.
+func (w *Writer) Record(ctx context.Context, entry Entry) bool {
+	if actor, ok := ctx.Value(actorKey{}).(actor); ok {
+		if entry.Actor == "" {
+			entry.Actor, entry.ActorVerified = actor.actor, actor.verified
+		}
+		if entry.RequestID == "" {
+			entry.RequestID = actor.requestID
+		}
+	}
+	if entry.At.IsZero() {
+		entry.At = time.Now().UTC()
+	}
+
+	w.mutex.RLock()
+	defer w.mutex.RUnlock()
+	if !w.closed {
+		select {
+		case w.entries <- entry:
+			return true
+		default:
+		}
+	}
+	atomic.AddInt64(&w.dropped, 1)
+	return false
+}
+
+// Dropped returns the number of entries dropped because the buffer was full or the writer closed
+func (w *Writer) Dropped() int64 {
+	return atomic.LoadInt64(&w.dropped)
+}
+
+// Failed returns the number of entries the database did not store
+func (w *Writer) Failed() int64 {
+	return atomic.LoadInt64(&w.failed)
+}
+
+// Close stops accepting entries and waits until the buffered ones are written or ctx is done
+func (w *Writer) Close(ctx context.Context) error {
+	w.mutex.Lock()
+	if !w.closed {
+		w.closed = true
+		close(w.entries)
+	}
+	w.mutex.Unlock()
+
+	select {
+	case <-w.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// History returns the entries of one record, the latest first
+func (w *Writer) History(ctx context.Context, collection, recordID string, page Page) ([]Entry, error) {
+	auditCollection, err := w.collection()
+	if err != nil {
+		return nil, err
+	}
+	findOptions := page.findOptions().SetSort(bson.D{{Key: "at", Value: -1}, {Key: "_id", Value: -1}})
+	cursor, err := auditCollection.Find(ctx, bson.M{"collection": collection, "record_id": recordID}, findOptions)
+	if err != nil {
+		return nil, fmt.Errorf("audit history: %w", err)
+	}
+	entries := []Entry{}
+	if err := cursor.All(ctx, &entries); err != nil {
+		return nil, fmt.Errorf("audit history: %w", err)
+	}
+	return entries, nil
+}
+
+// Page selects one page of the history, Number starts at 1 and a zero Size returns every entry
+type Page struct {
+	Number int64
+	Size   int64
+}
+
+func (p Page) findOptions() *options.FindOptions {
+	findOptions := options.Find()
+	if p.Size > 0 {
+		number := p.Number
+		if number < 1 {
+			number = 1
+		}
+		findOptions.SetSkip((number - 1) * p.Size).SetLimit(p.Size)
+	}
+	return findOptions
+}
+
+// run writes the entries in batches of what is buffered, up to batchSize
+func (w *Writer) run() {
+	defer close(w.done)
+	for entry := range w.entries {
+		batch := []interface{}{entry}
+	fill:
+		for len(batch) < batchSize {
+			select {
+			case next, ok := <-w.entries:
+				if !ok {
+					break fill
+				}
+				batch = append(batch, next)
+			default:
+				break fill
+			}
+		}
+		w.write(batch)
+	}
+}
+
+func (w *Writer) write(batch []interface{}) {
+	auditCollection, err := w.collection()
+	if err == nil {
+		ctx, cancel := context.WithTimeout(context.Background(), writeTimeout)
+		_, err = auditCollection.InsertMany(ctx, batch, options.InsertMany().SetOrdered(false))
+		cancel()
+	}
+	if err == nil {
+		return
+	}
+	// an unordered insert stores every entry but the ones with a write error
+	failed := int64(len(batch))
+	var bulkError mongo.BulkWriteException
+	if errors.As(err, &bulkError) && bulkError.WriteConcernError == nil && len(bulkError.WriteErrors) != 0 {
+		failed = int64(len(bulkError.WriteErrors))
+	}
+	atomic.AddInt64(&w.failed, failed)
+	if w.onError != nil {
+		w.onError(fmt.Errorf("write %d audit entries: %w", len(batch), err))
+	}
+}
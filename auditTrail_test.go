@@ -0,0 +1,106 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestDiff(t *testing.T) {
+	type profile struct {
+		ID      string `bson:"_id"`
+		Name    string `bson:"name"`
+		Enabled bool   `bson:"enabled"`
+	}
+	changes, err := Diff(profile{ID: "a", Name: "Ann"}, profile{ID: "b", Name: "Ann", Enabled: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 1 || changes[0].Field != "enabled" || changes[0].Before != false || changes[0].After != true {
+		t.Errorf("changes = %+v, want enabled false to true", changes)
+	}
+
+	changes, err = Diff(nil, bson.M{"name": "Ann", "enabled": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 2 || changes[0].Field != "enabled" || changes[1].Field != "name" || changes[1].Before != nil {
+		t.Errorf("changes of a new record = %+v, want every field sorted", changes)
+	}
+	if changes, _ := Diff(bson.M{"name": "Ann"}, nil); len(changes) != 1 || changes[0].After != nil {
+		t.Errorf("changes of a removed record = %+v", changes)
+	}
+}
+
+func TestWriterBuffer(t *testing.T) {
+	started, release := make(chan struct{}, 1), make(chan struct{})
+	collection := func() (*mongo.Collection, error) {
+		select {
+		case started <- struct{}{}:
+		default:
+		}
+		<-release
+		return nil, errors.New("no database")
+	}
+	writeErrors := make(chan error, 2)
+	w := NewWriter(collection, 1, func(err error) { writeErrors <- err })
+
+	ctx := WithActor(context.Background(), "admin", "req-1", false)
+	if !w.Record(ctx, Entry{Action: Update}) {
+		t.Fatal("the first entry is dropped")
+	}
+	// the writer holds the first entry, the second one fills the buffer
+	<-started
+	if !w.Record(ctx, Entry{Action: Update}) {
+		t.Fatal("the second entry is dropped")
+	}
+	if w.Record(ctx, Entry{Action: Update}) || w.Dropped() != 1 {
+		t.Errorf("a full buffer does not drop, dropped = %d", w.Dropped())
+	}
+
+	close(release)
+	closeCtx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := w.Close(closeCtx); err != nil {
+		t.Fatal(err)
+	}
+	if w.Failed() != 2 || len(writeErrors) != 2 {
+		t.Errorf("failed = %d, errors = %d, want 2", w.Failed(), len(writeErrors))
+	}
+	if w.Record(ctx, Entry{}) || w.Dropped() != 2 {
+		t.Error("a closed writer accepts entries")
+	}
+}
+
+func TestRecordActor(t *testing.T) {
+	w := &Writer{entries: make(chan Entry, 2)}
+	ctx := WithActor(context.Background(), "admin", "req-1", true)
+
+	w.Record(ctx, Entry{Actor: "customer"})
+	entry := <-w.entries
+	if entry.Actor != "customer" || entry.ActorVerified || entry.RequestID != "req-1" || entry.At.IsZero() {
+		t.Errorf("entry = %+v, want the given unverified actor, the request id of ctx and a time", entry)
+	}
+	w.Record(ctx, Entry{})
+	if entry = <-w.entries; entry.Actor != "admin" || !entry.ActorVerified {
+		t.Errorf("entry = %+v, want the verified actor of ctx", entry)
+	}
+}
+
+func TestHistoryPage(t *testing.T) {
+	findOptions := Page{Number: 3, Size: 20}.findOptions()
+	if *findOptions.Skip != 40 || *findOptions.Limit != 20 {
+		t.Errorf("skip, limit = %d, %d, want 40, 20", *findOptions.Skip, *findOptions.Limit)
+	}
+	findOptions = Page{Size: 10}.findOptions()
+	if *findOptions.Skip != 0 || *findOptions.Limit != 10 {
+		t.Errorf("page 0 skip, limit = %d, %d, want the first page", *findOptions.Skip, *findOptions.Limit)
+	}
+	if findOptions = (Page{}).findOptions(); findOptions.Skip != nil || findOptions.Limit != nil {
+		t.Error("an empty page limits the history")
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"TestProject/Server/GolangServer/secrets"
 	"context"
 	"encoding/csv"
 	"fmt"
@@ -19,9 +20,8 @@ const (
 	csvFilePath = "records_1000.csv" // Path to the CSV file
 
 	// Redis connection details
-	redisAddr     = "localhost:6379" // Redis server address
-	redisPassword = ""               // Password (leave empty if no password)
-	redisDB       = 0                // Redis database number
+	redisAddr = "localhost:6379" // Redis server address
+	redisDB   = 0                // Redis database number
 
 	// Bloom filter name
 	bloomFilterName = "optimizeKeyRedisPerformance"
@@ -117,6 +117,12 @@ func main() {
 
 // InitializeRedisDB initializes the Redis database connection
 func initRedisDB() error {
+	// REDIS_PASS may be a secret://path#key reference, leave it unset if no password
+	redisPassword, err := secrets.Resolve(ctx, os.Getenv("REDIS_PASS"))
+	if err != nil {
+		return fmt.Errorf("Failed to read the Redis password: %v", err)
+	}
+
 	// Create a Redis client
 	client := redis.NewClient(&redis.Options{
 		Addr:     redisAddr,
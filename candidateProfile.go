@@ -2,8 +2,14 @@ package model
 
 //For Profile Edit
 type EmployeeProfile struct {
-	FullName  string `json:"fullName" bson:"fullName"`
-	LoginId   string `json:"loginId" bson:"loginId"`
+	FullName  string `json:"fullName" bson:"fullName" validate:"max=100"`
+	LoginId   string `json:"loginId" bson:"loginId" validate:"required,max=64"`
 	IsEnabled bool   `json:"isEnabled" bson:"isEnabled"`
 	IsDeleted bool   `json:"isDeleted" bson:"isDeleted"`
 }
+
+//For partial Profile Edit, nil fields are left untouched
+type EmployeeProfilePatch struct {
+	FullName  *string `json:"fullName,omitempty" bson:"fullName,omitempty" validate:"omitempty,min=1,max=100"`
+	IsEnabled *bool   `json:"isEnabled,omitempty" bson:"isEnabled,omitempty"`
+}
@@ -2,4 +2,5 @@ package collection
 
 const (
 	EMPLOYEE_PROFILE = "employee_profile"
+	AUDIT            = "audit"
 )
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"TestProject/Server/GolangServer/apperrors"
+	"TestProject/Server/GolangServer/confighelper"
+	"TestProject/Server/GolangServer/model"
+	"TestProject/Server/GolangServer/validation"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Response of ColumnRangeService when it is not streamed
+type columnRange struct {
+	Start  string     `json:"start"`
+	Count  int64      `json:"count"`
+	Labels []string   `json:"labels,omitempty"`
+	Rows   [][]string `json:"rows,omitempty"`
+}
+
+// Returns count column labels from start, as a flat list or as rows x cols
+func ColumnRangeService(c echo.Context) error {
+	columnRangeRequest := model.ColumnRangeRequest{}
+	if err := validation.BindAndValidate(c, &columnRangeRequest); err != nil {
+		return err
+	}
+
+	startIndex, err := ColumnLabelToIndex(columnRangeRequest.Start)
+	if err != nil {
+		return apperrors.Validation("invalid request", map[string]string{"start": err.Error()})
+	}
+	count := columnRangeRequest.Count
+	hasLayout := columnRangeRequest.Rows != 0 || columnRangeRequest.Cols != 0
+	if hasLayout {
+		if columnRangeRequest.Rows == 0 || columnRangeRequest.Cols == 0 {
+			return apperrors.Validation("invalid request", map[string]string{"rows": "rows and cols must be given together"})
+		}
+		layoutCount := columnRangeRequest.Rows * columnRangeRequest.Cols
+		if count != 0 && count != layoutCount {
+			return apperrors.Validation("invalid request", map[string]string{"count": "count must be rows x cols"})
+		}
+		count = layoutCount
+	}
+	if count == 0 {
+		return apperrors.Validation("invalid request", map[string]string{"count": "count is a required field"})
+	}
+	if maxRange := confighelper.Get().ColumnsMaxRange; count > maxRange {
+		return apperrors.Validation("invalid request", map[string]string{"count": fmt.Sprintf("count must be %d or less", maxRange)})
+	}
+	if startIndex > math.MaxInt64-count {
+		return apperrors.Validation("invalid request", map[string]string{"count": "range goes past the last column"})
+	}
+
+	step := int64(1)
+	if hasLayout {
+		step = columnRangeRequest.Cols
+	}
+
+	if count > confighelper.Get().ColumnsStreamAbove {
+		// one JSON value per line, a label or a row of labels
+		res := c.Response()
+		res.Header().Set(echo.HeaderContentType, ndjsonContentType)
+		res.WriteHeader(http.StatusOK)
+		encoder := json.NewEncoder(res)
+		lines := 0
+		for index := startIndex; index < startIndex+count; index += step {
+			var line interface{} = ColumnIndexToLabel(index)
+			if hasLayout {
+				line = columnLabels(index, step)
+			}
+			if err := encoder.Encode(line); err != nil {
+				return err
+			}
+			if lines++; lines%1024 == 0 {
+				res.Flush()
+			}
+		}
+		res.Flush()
+		return nil
+	}
+
+	resp := columnRange{Start: ColumnIndexToLabel(startIndex), Count: count}
+	if !hasLayout {
+		resp.Labels = columnLabels(startIndex, count)
+		return c.JSON(http.StatusOK, resp)
+	}
+	for index := startIndex; index < startIndex+count; index += step {
+		resp.Rows = append(resp.Rows, columnLabels(index, step))
+	}
+	return c.JSON(http.StatusOK, resp)
+}
+
+// Returns the 1 based index of a column label, AAZ is 728
+func ColumnIndexService(c echo.Context) error {
+	columnIndexRequest := model.ColumnIndexRequest{}
+	if err := validation.BindAndValidate(c, &columnIndexRequest); err != nil {
+		return err
+	}
+	index, err := ColumnLabelToIndex(columnIndexRequest.Label)
+	if err != nil {
+		return apperrors.Validation("invalid request", map[string]string{"label": err.Error()})
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{"label": strings.ToUpper(columnIndexRequest.Label), "index": index})
+}
+
+// Returns the column label of a 1 based index, 1378 is AZZ
+func ColumnLabelService(c echo.Context) error {
+	columnLabelRequest := model.ColumnLabelRequest{}
+	if err := validation.BindAndValidate(c, &columnLabelRequest); err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{"label": ColumnIndexToLabel(columnLabelRequest.Index), "index": columnLabelRequest.Index})
+}
+
+// ColumnLabelToIndex converts a bijective base 26 label to its 1 based index, lower case is accepted
+func ColumnLabelToIndex(label string) (int64, error) {
+	if label == "" {
+		return 0, fmt.Errorf("label is empty")
+	}
+	var index int64
+	for _, r := range strings.ToUpper(label) {
+		if r < 'A' || r > 'Z' {
+			return 0, fmt.Errorf("label must contain only the letters A to Z")
+		}
+		digit := int64(r-'A') + 1
+		if index > (math.MaxInt64-digit)/26 {
+			return 0, fmt.Errorf("label is too long")
+		}
+		index = index*26 + digit
+	}
+	return index, nil
+}
+
+// ColumnIndexToLabel converts a 1 based index to its label, 1 is A and 27 is AA
+func ColumnIndexToLabel(index int64) string {
+	if index < 1 {
+		return ""
+	}
+	var label [16]byte
+	i := len(label)
+	for index > 0 {
+		index--
+		i--
+		label[i] = byte('A' + index%26)
+		index /= 26
+	}
+	return string(label[i:])
+}
+
+// columnLabels returns count labels starting at index
+func columnLabels(index, count int64) []string {
+	labels := make([]string, 0, count)
+	for i := int64(0); i < count; i++ {
+		labels = append(labels, ColumnIndexToLabel(index+i))
+	}
+	return labels
+}
+
+// GetColList returns numRows rows of numCols space separated labels starting at columnToStart
+func GetColList(columnToStart string, numRows, numCols int) []string {
+	startIndex, err := ColumnLabelToIndex(columnToStart)
+	if err != nil {
+		return []string{}
+	}
+	finalRes := make([]string, 0, numRows)
+	for row := 0; row < numRows; row++ {
+		labels := columnLabels(startIndex+int64(row*numCols), int64(numCols))
+		finalRes = append(finalRes, strings.Join(labels, " "))
+	}
+	return finalRes
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestColumnLabelIndexRoundTrip(t *testing.T) {
+	cases := map[string]int64{"A": 1, "Z": 26, "AA": 27, "AZ": 52, "ZZ": 702, "AAA": 703, "AAZ": 728, "AZZ": 1378, "XFD": 16384}
+	for label, index := range cases {
+		got, err := ColumnLabelToIndex(label)
+		if err != nil || got != index {
+			t.Errorf("ColumnLabelToIndex(%q) = %d, %v, want %d", label, got, err, index)
+		}
+		if got := ColumnIndexToLabel(index); got != label {
+			t.Errorf("ColumnIndexToLabel(%d) = %q, want %q", index, got, label)
+		}
+	}
+	for index := int64(1); index < 20000; index++ {
+		if got, _ := ColumnLabelToIndex(ColumnIndexToLabel(index)); got != index {
+			t.Fatalf("round trip of %d gave %d", index, got)
+		}
+	}
+	if got := ColumnIndexToLabel(math.MaxInt64); got != "CRPXNLSKVLJFHG" {
+		t.Errorf("ColumnIndexToLabel(MaxInt64) = %q", got)
+	}
+}
+
+func TestColumnLabelToIndexErrors(t *testing.T) {
+	if got, err := ColumnLabelToIndex("aaz"); err != nil || got != 728 {
+		t.Errorf("lower case label gave %d, %v", got, err)
+	}
+	for _, label := range []string{"", "A1", "Ä", "CRPXNLSKVLJFHH", "AAAAAAAAAAAAAAAA"} {
+		if _, err := ColumnLabelToIndex(label); err == nil {
+			t.Errorf("expected an error for %q", label)
+		}
+	}
+}
+
+func TestGetColList(t *testing.T) {
+	got := GetColList("Y", 2, 3)
+	want := []string{"Y Z AA", "AB AC AD"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GetColList = %v, want %v", got, want)
+	}
+	if got := GetColList("zz", 1, 2); !reflect.DeepEqual(got, []string{"ZZ AAA"}) {
+		t.Errorf("GetColList lower case = %v", got)
+	}
+}
@@ -1,24 +1,441 @@
 package confighelper
 
 import (
+	"TestProject/Server/GolangServer/secrets"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"log"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 )
 
-//InitViper function to initialize viper
-func InitViper() {
-	viper.SetConfigName("config") // name of config file (without extension)
-	viper.AddConfigPath(".")      // optionally look for config in the working directory
-	err := viper.ReadInConfig()
-	// Find and read the config file
-	if err != nil { // Handle errors reading the config file
-		panic(fmt.Errorf("Fatal error config file %s ", err))
+// EnvPrefix is the prefix of the environment overrides, APP_DBIP overrides DBIP
+const EnvPrefix = "APP"
+
+const redactedValue = "******"
+
+// secretResolveTimeout bounds resolving the secret:// references of one load
+const secretResolveTimeout = 10 * time.Second
+
+// Config is the typed configuration, the mapstructure tags are the keys of config.json
+type Config struct {
+	DBName     string `mapstructure:"DBNAME"`
+	DBIP       string `mapstructure:"DBIP"`
+	DBPort     int    `mapstructure:"PORT"`
+	DBUserName string `mapstructure:"USENAME"`
+	DBPassword string `mapstructure:"PASSWORD" secret:"true"`
+
+	MongoMaxPoolSize            uint64        `mapstructure:"MONGO_MAX_POOL_SIZE"`
+	MongoMinPoolSize            uint64        `mapstructure:"MONGO_MIN_POOL_SIZE"`
+	MongoMaxConnIdleTime        time.Duration `mapstructure:"MONGO_MAX_CONN_IDLE_TIME"`
+	MongoServerSelectionTimeout time.Duration `mapstructure:"MONGO_SERVER_SELECTION_TIMEOUT"`
+	MongoReadPreference         string        `mapstructure:"MONGO_READ_PREFERENCE"`
+
+	PrimeUpperBound       int64         `mapstructure:"PRIME_UPPER_BOUND"`
+	PrimeStreamAbove      int64         `mapstructure:"PRIME_STREAM_ABOVE"`
+	WordCountFetchTimeout time.Duration `mapstructure:"WORDCOUNT_FETCH_TIMEOUT"`
+	WordCountMaxBodyBytes int64         `mapstructure:"WORDCOUNT_MAX_BODY_BYTES"`
+	ColumnsMaxRange       int64         `mapstructure:"COLUMNS_MAX_RANGE"`
+	ColumnsStreamAbove    int64         `mapstructure:"COLUMNS_STREAM_ABOVE"`
+
+	ServerPort            int           `mapstructure:"SERVER_PORT"`
+	ServerReadTimeout     time.Duration `mapstructure:"SERVER_READ_TIMEOUT"`
+	ServerWriteTimeout    time.Duration `mapstructure:"SERVER_WRITE_TIMEOUT"`
+	ServerIdleTimeout     time.Duration `mapstructure:"SERVER_IDLE_TIMEOUT"`
+	ServerShutdownTimeout time.Duration `mapstructure:"SERVER_SHUTDOWN_TIMEOUT"`
+
+	RedisAddr       string `mapstructure:"REDIS_ADDR"`
+	RedisPassword   string `mapstructure:"REDIS_PASS" secret:"true"`
+	BloomFilterName string `mapstructure:"BLOOM_FILTER_NAME"`
+
+	// PrintConfig is set by --print-config, it is not a config key
+	PrintConfig bool `mapstructure:"-"`
+}
+
+// ValidationError names the config key holding a bad value
+type ValidationError struct {
+	Key     string
+	Message string
+}
+
+func (e ValidationError) Error() string {
+	return fmt.Sprintf("config %s: %s", e.Key, e.Message)
+}
+
+// ValidationErrors is every problem found by Config.Validate
+type ValidationErrors []ValidationError
+
+func (e ValidationErrors) Error() string {
+	messages := make([]string, 0, len(e))
+	for _, validationError := range e {
+		messages = append(messages, validationError.Error())
+	}
+	return strings.Join(messages, "; ")
+}
+
+// ChangeEvent is published to the subscribers when a reload changes the config
+type ChangeEvent struct {
+	Old  Config
+	New  Config
+	Keys []string // keys whose value changed, in field order
+}
+
+// Changed tells whether any of keys changed
+func (e ChangeEvent) Changed(keys ...string) bool {
+	for _, changed := range e.Keys {
+		for _, key := range keys {
+			if changed == key {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+var (
+	currentMutex sync.RWMutex
+	current      = Defaults()
+	active       = viper.GetViper()
+	// set by Load so Reload reads the same layers again
+	loadedFile  string
+	loadedFlags *pflag.FlagSet
+
+	reloadMutex      sync.Mutex
+	subscribersMutex sync.Mutex
+	subscribers      = map[int]func(ChangeEvent){}
+	nextSubscriber   int
+)
+
+// Defaults returns the first layer of the configuration
+func Defaults() Config {
+	return Config{
+		DBName:                      "sampleTestDatabase",
+		DBIP:                        "localhost",
+		DBPort:                      27017,
+		MongoMaxPoolSize:            100,
+		MongoMaxConnIdleTime:        5 * time.Minute,
+		MongoServerSelectionTimeout: 5 * time.Second,
+		MongoReadPreference:         "primary",
+		PrimeUpperBound:             10000000,
+		PrimeStreamAbove:            100000,
+		WordCountFetchTimeout:       10 * time.Second,
+		WordCountMaxBodyBytes:       2 << 20,
+		ColumnsMaxRange:             1000000,
+		ColumnsStreamAbove:          10000,
+		ServerPort:                  4000,
+		ServerReadTimeout:           15 * time.Second,
+		ServerWriteTimeout:          60 * time.Second,
+		ServerIdleTimeout:           120 * time.Second,
+		ServerShutdownTimeout:       20 * time.Second,
+		RedisAddr:                   "localhost:6379",
+		BloomFilterName:             "optimizeKeyRedisPerformance",
+	}
+}
+
+// Load reads the configuration in layers: defaults, then the config file (json, yaml or toml),
+// then APP_ environment variables, then command line flags such as --dbip or --server-port.
+func Load(args []string) (*Config, error) {
+	flags := pflag.NewFlagSet("config", pflag.ContinueOnError)
+	configFile := flags.String("config", "", "path of the config file, json, yaml or toml")
+	printConfig := flags.Bool("print-config", false, "print the effective config with secrets redacted and exit")
+	for _, key := range configKeys() {
+		flags.String(flagName(key), "", "overrides "+key)
+	}
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+
+	v, err := newViper(*configFile, flags)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := decode(v)
+	if err != nil {
+		return nil, err
+	}
+
+	reloadMutex.Lock()
+	defer reloadMutex.Unlock()
+	loadedFile = v.ConfigFileUsed()
+	loadedFlags = flags
+	setCurrent(v, cfg)
+	cfg.PrintConfig = *printConfig
+	return cfg, nil
+}
+
+// newViper stacks the layers, configFile is searched as ./config.* when empty
+func newViper(configFile string, flags *pflag.FlagSet) (*viper.Viper, error) {
+	v := viper.New()
+	defaultValues := reflect.ValueOf(Defaults())
+	for i, key := range configKeys() {
+		v.SetDefault(key, defaultValues.Field(i).Interface())
+		if err := v.BindPFlag(key, flags.Lookup(flagName(key))); err != nil {
+			return nil, err
+		}
+	}
+
+	if configFile != "" {
+		v.SetConfigFile(configFile)
+	} else {
+		v.SetConfigName("config") // name of config file (without extension)
+		v.AddConfigPath(".")      // optionally look for config in the working directory
+	}
+	if err := v.ReadInConfig(); err != nil {
+		var notFound viper.ConfigFileNotFoundError
+		if !errors.As(err, &notFound) {
+			return nil, fmt.Errorf("config file: %v", err)
+		}
+		log.Print("No config file found, using defaults and environment")
+	}
+
+	v.SetEnvPrefix(EnvPrefix)
+	v.AutomaticEnv()
+	return v, nil
+}
+
+// Reload reads the layers given to Load again. An invalid config is rejected and the last good one kept,
+// otherwise the subscribers get a ChangeEvent when a value changed.
+func Reload() error {
+	reloadMutex.Lock()
+	defer reloadMutex.Unlock()
+	if loadedFlags == nil {
+		return fmt.Errorf("config: Reload called before Load")
+	}
+
+	v, err := newViper(loadedFile, loadedFlags)
+	if err != nil {
+		return err
+	}
+	cfg, err := decode(v)
+	if err != nil {
+		return err
+	}
+
+	event := ChangeEvent{Old: Get(), New: *cfg, Keys: changedKeys(Get(), *cfg)}
+	setCurrent(v, cfg)
+	if len(event.Keys) == 0 {
+		return nil
 	}
+	log.Print("Config Reloaded, changed keys::", strings.Join(event.Keys, ","))
+	publish(event)
+	return nil
+}
+
+// Watch calls Reload whenever the config file found by Load is written
+func Watch() error {
+	reloadMutex.Lock()
+	file := loadedFile
+	reloadMutex.Unlock()
+	if file == "" {
+		return fmt.Errorf("config: no config file to watch")
+	}
+
+	// a separate viper only gets the file events, the loaded config is replaced by Reload
+	watcher := viper.New()
+	watcher.SetConfigFile(file)
+	watcher.OnConfigChange(func(fsnotify.Event) {
+		if err := Reload(); err != nil {
+			log.Print("Config Reload Rejected, keeping the last good config::", err)
+		}
+	})
+	watcher.WatchConfig()
+	return nil
+}
+
+// Subscribe registers fn for the ChangeEvents, fn runs on the reloading goroutine. Call the returned func to unsubscribe.
+func Subscribe(fn func(ChangeEvent)) func() {
+	subscribersMutex.Lock()
+	defer subscribersMutex.Unlock()
+	id := nextSubscriber
+	nextSubscriber++
+	subscribers[id] = fn
+	return func() {
+		subscribersMutex.Lock()
+		defer subscribersMutex.Unlock()
+		delete(subscribers, id)
+	}
+}
+
+func publish(event ChangeEvent) {
+	subscribersMutex.Lock()
+	fns := make([]func(ChangeEvent), 0, len(subscribers))
+	for _, fn := range subscribers {
+		fns = append(fns, fn)
+	}
+	subscribersMutex.Unlock()
+	for _, fn := range fns {
+		fn(event)
+	}
+}
+
+// changedKeys returns the keys whose value differs between old and new
+func changedKeys(old, new Config) []string {
+	oldValues, newValues := reflect.ValueOf(old), reflect.ValueOf(new)
+	keys := []string{}
+	for i, key := range configKeys() {
+		if !reflect.DeepEqual(oldValues.Field(i).Interface(), newValues.Field(i).Interface()) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// decode builds and validates the typed config from the current viper state
+func decode(v *viper.Viper) (*Config, error) {
+	cfg := &Config{}
+	if err := v.Unmarshal(cfg); err != nil {
+		return nil, fmt.Errorf("config: %v", err)
+	}
+	if err := resolveSecrets(cfg); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// resolveSecrets replaces the string values written as secret://path#key by the referenced secret
+func resolveSecrets(cfg *Config) error {
+	ctx, cancel := context.WithTimeout(context.Background(), secretResolveTimeout)
+	defer cancel()
+
+	var validationErrors ValidationErrors
+	values := reflect.ValueOf(cfg).Elem()
+	for i, key := range configKeys() {
+		field := values.Field(i)
+		if field.Kind() != reflect.String || !secrets.IsReference(field.String()) {
+			continue
+		}
+		resolved, err := secrets.Resolve(ctx, field.String())
+		if err != nil {
+			validationErrors = append(validationErrors, ValidationError{Key: key, Message: "can not resolve secret: " + err.Error()})
+			continue
+		}
+		field.SetString(resolved)
+	}
+	if len(validationErrors) != 0 {
+		return validationErrors
+	}
+	return nil
+}
+
+// Validate returns ValidationErrors naming every key with a bad value
+func (c Config) Validate() error {
+	var validationErrors ValidationErrors
+	check := func(ok bool, key, message string) {
+		if !ok {
+			validationErrors = append(validationErrors, ValidationError{Key: key, Message: message})
+		}
+	}
+
+	check(c.DBName != "", "DBNAME", "is required")
+	check(c.DBIP != "", "DBIP", "is required")
+	check(c.DBPort > 0 && c.DBPort < 65536, "PORT", "must be a port number")
+	check(c.DBPassword == "" || c.DBUserName != "", "USENAME", "is required when PASSWORD is set")
+	check(c.MongoMaxPoolSize > 0, "MONGO_MAX_POOL_SIZE", "must be greater than 0")
+	check(c.MongoMinPoolSize <= c.MongoMaxPoolSize, "MONGO_MIN_POOL_SIZE", "can not be greater than MONGO_MAX_POOL_SIZE")
+	check(c.MongoServerSelectionTimeout > 0, "MONGO_SERVER_SELECTION_TIMEOUT", "must be greater than 0")
+	switch c.MongoReadPreference {
+	case "primary", "primaryPreferred", "secondary", "secondaryPreferred", "nearest":
+	default:
+		check(false, "MONGO_READ_PREFERENCE", "must be one of primary, primaryPreferred, secondary, secondaryPreferred, nearest")
+	}
+	check(c.PrimeUpperBound > 0, "PRIME_UPPER_BOUND", "must be greater than 0")
+	check(c.PrimeStreamAbove > 0, "PRIME_STREAM_ABOVE", "must be greater than 0")
+	check(c.WordCountFetchTimeout > 0, "WORDCOUNT_FETCH_TIMEOUT", "must be greater than 0")
+	check(c.WordCountMaxBodyBytes > 0, "WORDCOUNT_MAX_BODY_BYTES", "must be greater than 0")
+	check(c.ColumnsMaxRange > 0, "COLUMNS_MAX_RANGE", "must be greater than 0")
+	check(c.ColumnsStreamAbove > 0, "COLUMNS_STREAM_ABOVE", "must be greater than 0")
+	check(c.ServerPort > 0 && c.ServerPort < 65536, "SERVER_PORT", "must be a port number")
+	check(c.ServerShutdownTimeout > 0, "SERVER_SHUTDOWN_TIMEOUT", "must be greater than 0")
+	check(c.RedisAddr != "", "REDIS_ADDR", "is required")
+	check(c.BloomFilterName != "", "BLOOM_FILTER_NAME", "is required")
+
+	if len(validationErrors) != 0 {
+		return validationErrors
+	}
+	return nil
+}
+
+// Redacted returns the config keyed like config.json, secret values are masked
+func (c Config) Redacted() map[string]interface{} {
+	redacted := map[string]interface{}{}
+	values := reflect.ValueOf(c)
+	fields := values.Type()
+	for i, key := range configKeys() {
+		value := values.Field(i).Interface()
+		if duration, ok := value.(time.Duration); ok {
+			value = duration.String()
+		}
+		if fields.Field(i).Tag.Get("secret") == "true" && !values.Field(i).IsZero() {
+			value = redactedValue
+		}
+		redacted[key] = value
+	}
+	return redacted
+}
+
+// PrintRedacted writes the redacted config as indented json, for --print-config
+func PrintRedacted(w io.Writer, cfg *Config) error {
+	bs, err := json.MarshalIndent(cfg.Redacted(), "", "    ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(bs))
+	return err
+}
+
+// Get returns the last loaded config, the defaults before Load is called
+func Get() Config {
+	currentMutex.RLock()
+	defer currentMutex.RUnlock()
+	return current
+}
+
+func setCurrent(v *viper.Viper, cfg *Config) {
+	currentMutex.Lock()
+	defer currentMutex.Unlock()
+	active = v
+	current = *cfg
+}
+
+// configKeys returns the keys of Config in field order, the fields without a key are always last
+func configKeys() []string {
+	t := reflect.TypeOf(Config{})
+	keys := []string{}
+	for i := 0; i < t.NumField(); i++ {
+		if key := t.Field(i).Tag.Get("mapstructure"); key != "-" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// flagName is the command line flag of a key, MONGO_MAX_POOL_SIZE is --mongo-max-pool-size
+func flagName(key string) string {
+	return strings.ToLower(strings.ReplaceAll(key, "_", "-"))
+}
+
+//InitViper function to initialize the config, kept for callers which only use GetConfig
+func InitViper() error {
+	_, err := Load(nil)
+	return err
 }
 
-//GetConfig method to get configs from config file
+//GetConfig method to get configs from the last good config
 func GetConfig(keyName string) string {
-	keyValue := viper.GetString(keyName)
+	currentMutex.RLock()
+	defer currentMutex.RUnlock()
+	keyValue := active.GetString(keyName)
 	return keyValue
 }
@@ -0,0 +1,184 @@
+package confighelper
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeConfigFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadLayers(t *testing.T) {
+	path := writeConfigFile(t, "config.yaml", "DBIP: filehost\nPORT: 27018\nSERVER_PORT: 5000\nSERVER_READ_TIMEOUT: 3s\n")
+	t.Setenv("APP_DBIP", "envhost")
+	t.Setenv("APP_SERVER_PORT", "6000")
+
+	cfg, err := Load([]string{"--config", path, "--server-port", "7000"})
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.DBName != "sampleTestDatabase" {
+		t.Errorf("DBNAME = %q, want the default", cfg.DBName)
+	}
+	if cfg.DBPort != 27018 || cfg.ServerReadTimeout != 3*time.Second {
+		t.Errorf("PORT, SERVER_READ_TIMEOUT = %d, %v, want the file values", cfg.DBPort, cfg.ServerReadTimeout)
+	}
+	if cfg.DBIP != "envhost" {
+		t.Errorf("DBIP = %q, want the env value", cfg.DBIP)
+	}
+	if cfg.ServerPort != 7000 {
+		t.Errorf("SERVER_PORT = %d, want the flag value", cfg.ServerPort)
+	}
+	if Get().DBIP != "envhost" {
+		t.Errorf("Get() did not return the loaded config")
+	}
+	if GetConfig("DBIP") != "envhost" {
+		t.Errorf("GetConfig(DBIP) = %q, want the env value", GetConfig("DBIP"))
+	}
+}
+
+func TestLoadFormats(t *testing.T) {
+	files := map[string]string{
+		"config.json": `{"DBNAME": "jsonDB"}`,
+		"config.toml": "DBNAME = \"jsonDB\"\n",
+		"config.yml":  "DBNAME: jsonDB\n",
+	}
+	for name, content := range files {
+		cfg, err := Load([]string{"--config", writeConfigFile(t, name, content)})
+		if err != nil {
+			t.Fatalf("%s: Load() error = %v", name, err)
+		}
+		if cfg.DBName != "jsonDB" {
+			t.Errorf("%s: DBNAME = %q", name, cfg.DBName)
+		}
+	}
+}
+
+func TestLoadMissingFile(t *testing.T) {
+	wd, _ := os.Getwd()
+	defer os.Chdir(wd)
+	os.Chdir(t.TempDir())
+
+	cfg, err := Load(nil)
+	if err != nil {
+		t.Fatalf("Load() error = %v, want the defaults", err)
+	}
+	if cfg.ServerPort != Defaults().ServerPort {
+		t.Errorf("SERVER_PORT = %d, want the default", cfg.ServerPort)
+	}
+}
+
+func TestLoadValidation(t *testing.T) {
+	path := writeConfigFile(t, "config.json", `{"PORT": "70000", "MONGO_READ_PREFERENCE": "fastest", "PASSWORD": "secret"}`)
+
+	_, err := Load([]string{"--config", path})
+	var validationErrors ValidationErrors
+	if !errors.As(err, &validationErrors) {
+		t.Fatalf("Load() error = %v, want ValidationErrors", err)
+	}
+	keys := map[string]bool{}
+	for _, validationError := range validationErrors {
+		keys[validationError.Key] = true
+	}
+	for _, key := range []string{"PORT", "MONGO_READ_PREFERENCE", "USENAME"} {
+		if !keys[key] {
+			t.Errorf("no error for %s in %v", key, err)
+		}
+	}
+
+	path = writeConfigFile(t, "config.json", `{"SERVER_IDLE_TIMEOUT": "soon"}`)
+	if _, err := Load([]string{"--config", path}); err == nil || !strings.Contains(err.Error(), "SERVER_IDLE_TIMEOUT") {
+		t.Errorf("Load() error = %v, want it to name SERVER_IDLE_TIMEOUT", err)
+	}
+}
+
+func TestPrintRedacted(t *testing.T) {
+	path := writeConfigFile(t, "config.json", `{"USENAME": "admin", "PASSWORD": "hunter2"}`)
+	cfg, err := Load([]string{"--config", path, "--print-config"})
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if !cfg.PrintConfig {
+		t.Error("PrintConfig is not set by --print-config")
+	}
+	var out bytes.Buffer
+	if err := PrintRedacted(&out, cfg); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(out.String(), "hunter2") || !strings.Contains(out.String(), redactedValue) {
+		t.Errorf("PASSWORD is not redacted:\n%s", out.String())
+	}
+	if !strings.Contains(out.String(), `"USENAME": "admin"`) || !strings.Contains(out.String(), `"SERVER_READ_TIMEOUT": "15s"`) {
+		t.Errorf("unexpected output:\n%s", out.String())
+	}
+}
+
+func TestReload(t *testing.T) {
+	path := writeConfigFile(t, "config.json", `{"DBIP": "first", "REDIS_ADDR": "redis:6379"}`)
+	if _, err := Load([]string{"--config", path}); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	events := []ChangeEvent{}
+	unsubscribe := Subscribe(func(event ChangeEvent) { events = append(events, event) })
+	defer unsubscribe()
+
+	if err := os.WriteFile(path, []byte(`{"DBIP": "second", "REDIS_ADDR": "redis:6379"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := Reload(); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+	if len(events) != 1 || !events[0].Changed("DBIP") || events[0].Changed("REDIS_ADDR") {
+		t.Fatalf("events = %+v, want one DBIP change", events)
+	}
+	if events[0].Old.DBIP != "first" || events[0].New.DBIP != "second" || Get().DBIP != "second" {
+		t.Errorf("DBIP old, new, current = %q, %q, %q", events[0].Old.DBIP, events[0].New.DBIP, Get().DBIP)
+	}
+
+	// invalid and unchanged reloads do not publish, the last good config is kept
+	if err := os.WriteFile(path, []byte(`{"DBIP": "third", "PORT": "0"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := Reload(); err == nil || !strings.Contains(err.Error(), "PORT") {
+		t.Errorf("Reload() error = %v, want it to name PORT", err)
+	}
+	if Get().DBIP != "second" || GetConfig("DBIP") != "second" {
+		t.Errorf("DBIP = %q, %q after an invalid reload, want second", Get().DBIP, GetConfig("DBIP"))
+	}
+	if err := os.WriteFile(path, []byte(`{"DBIP": "second", "REDIS_ADDR": "redis:6379"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := Reload(); err != nil || len(events) != 1 {
+		t.Errorf("Reload() error = %v, events = %d, want no new event", err, len(events))
+	}
+}
+
+func TestLoadResolvesSecrets(t *testing.T) {
+	t.Setenv("MONGO_PASSWORD", "hunter2")
+	path := writeConfigFile(t, "config.json", `{"USENAME": "app", "PASSWORD": "secret://mongo#password", "REDIS_PASS": "secret://redis#password"}`)
+
+	_, err := Load([]string{"--config", path})
+	if err == nil || !strings.Contains(err.Error(), "REDIS_PASS") {
+		t.Fatalf("Load() error = %v, want it to name REDIS_PASS", err)
+	}
+
+	t.Setenv("REDIS_PASSWORD", "redispass")
+	cfg, err := Load([]string{"--config", path})
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.DBPassword != "hunter2" || cfg.RedisPassword != "redispass" {
+		t.Errorf("PASSWORD, REDIS_PASS = %q, %q", cfg.DBPassword, cfg.RedisPassword)
+	}
+}
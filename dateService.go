@@ -0,0 +1,122 @@
+package main
+
+import (
+	"TestProject/Server/GolangServer/apperrors"
+	"TestProject/Server/GolangServer/model"
+	"TestProject/Server/GolangServer/validation"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const dayLayout = "2006-01-02"
+
+// Layouts tried in order, after RFC3339 and before epoch seconds
+var dateInputLayouts = []string{layoutISO, layoutUS}
+
+// First and last day of a month, quarter or year
+type datePeriod struct {
+	Number int    `json:"number,omitempty"`
+	First  string `json:"first"`
+	Last   string `json:"last"`
+}
+
+type isoWeek struct {
+	Year int `json:"year"`
+	Week int `json:"week"`
+}
+
+// Response of GetDateInfoService
+type dateInfo struct {
+	Input                        string     `json:"input"`
+	Zone                         string     `json:"zone"`
+	Date                         string     `json:"date"`
+	Epoch                        string     `json:"epoch"`
+	Month                        datePeriod `json:"month"`
+	Quarter                      datePeriod `json:"quarter"`
+	Year                         datePeriod `json:"year"`
+	ISOWeek                      isoWeek    `json:"isoWeek"`
+	BusinessDaysRemainingInMonth int        `json:"businessDaysRemainingInMonth"`
+}
+
+//Returns the calendar details of the input date in the input zone, UTC when no zone is given
+func GetDateInfoService(c echo.Context) error {
+	dateInfoRequest := model.DateInfoRequest{}
+	if err := validation.BindAndValidate(c, &dateInfoRequest); err != nil {
+		return err
+	}
+
+	location := time.UTC
+	if dateInfoRequest.Zone != "" {
+		loaded, err := time.LoadLocation(dateInfoRequest.Zone)
+		if err != nil {
+			return apperrors.Validation("invalid request", map[string]string{"zone": "zone must be an IANA time zone such as Asia/Kolkata"})
+		}
+		location = loaded
+	}
+
+	t, err := parseDateInput(string(dateInfoRequest.Date), location)
+	if err != nil {
+		return apperrors.Validation("invalid request", map[string]string{"date": err.Error()})
+	}
+	return c.JSON(http.StatusOK, newDateInfo(string(dateInfoRequest.Date), t))
+}
+
+// parseDateInput accepts RFC3339, layoutISO, layoutUS or epoch seconds, the result is in location
+func parseDateInput(value string, location *time.Location) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t.In(location), nil
+	}
+	for _, layout := range dateInputLayouts {
+		if t, err := time.ParseInLocation(layout, value, location); err == nil {
+			return t, nil
+		}
+	}
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(seconds, 0).In(location), nil
+	}
+	return time.Time{}, fmt.Errorf("date must be RFC3339, %q, %q or epoch seconds", layoutISO, layoutUS)
+}
+
+// newDateInfo computes the calendar details of t in its own location
+func newDateInfo(input string, t time.Time) dateInfo {
+	year, month, _ := t.Date()
+	location := t.Location()
+
+	firstOfMonth := time.Date(year, month, 1, 0, 0, 0, 0, location)
+	lastOfMonth := firstOfMonth.AddDate(0, 1, -1)
+	quarter := (int(month)-1)/3 + 1
+	firstOfQuarter := time.Date(year, time.Month((quarter-1)*3+1), 1, 0, 0, 0, 0, location)
+	lastOfQuarter := firstOfQuarter.AddDate(0, 3, -1)
+	weekYear, week := t.ISOWeek()
+
+	return dateInfo{
+		Input:                        input,
+		Zone:                         location.String(),
+		Date:                         t.Format(time.RFC3339),
+		Epoch:                        strconv.FormatInt(t.Unix(), 10),
+		Month:                        datePeriod{Number: int(month), First: firstOfMonth.Format(dayLayout), Last: lastOfMonth.Format(dayLayout)},
+		Quarter:                      datePeriod{Number: quarter, First: firstOfQuarter.Format(dayLayout), Last: lastOfQuarter.Format(dayLayout)},
+		Year:                         datePeriod{Number: year, First: fmt.Sprintf("%04d-01-01", year), Last: fmt.Sprintf("%04d-12-31", year)},
+		ISOWeek:                      isoWeek{Year: weekYear, Week: week},
+		BusinessDaysRemainingInMonth: businessDaysAfter(t, lastOfMonth),
+	}
+}
+
+// businessDaysAfter counts the Monday to Friday days after t up to and including last
+func businessDaysAfter(t, last time.Time) int {
+	count := 0
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location()).AddDate(0, 0, 1)
+	for !day.After(last) {
+		if weekday := day.Weekday(); weekday != time.Saturday && weekday != time.Sunday {
+			count++
+		}
+		day = day.AddDate(0, 0, 1)
+	}
+	return count
+}
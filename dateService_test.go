@@ -0,0 +1,62 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDateInput(t *testing.T) {
+	kolkata, err := time.LoadLocation("Asia/Kolkata")
+	if err != nil {
+		t.Skip("time zone database is not available")
+	}
+	want := time.Date(2024, 2, 10, 9, 30, 0, 0, kolkata)
+
+	for _, input := range []string{"2024-02-10T09:30:00+05:30", "2024-02-10T04:00:00Z", "2024-02-10T09:30", "1707537600"} {
+		got, err := parseDateInput(input, kolkata)
+		if err != nil {
+			t.Errorf("%q: %v", input, err)
+			continue
+		}
+		if !got.Equal(want) || got.Location() != kolkata {
+			t.Errorf("%q: got %v, want %v", input, got, want)
+		}
+	}
+
+	got, err := parseDateInput("February 10, 2024", kolkata)
+	if err != nil || !got.Equal(time.Date(2024, 2, 10, 0, 0, 0, 0, kolkata)) {
+		t.Errorf("layoutUS: got %v, %v", got, err)
+	}
+	if _, err := parseDateInput("10/02/2024", kolkata); err == nil {
+		t.Error("expected an error for an unknown layout")
+	}
+}
+
+func TestNewDateInfo(t *testing.T) {
+	info := newDateInfo("2024-02-10T09:30", time.Date(2024, 2, 10, 9, 30, 0, 0, time.UTC))
+
+	if info.Month.First != "2024-02-01" || info.Month.Last != "2024-02-29" {
+		t.Errorf("unexpected month %+v", info.Month)
+	}
+	if info.Quarter.Number != 1 || info.Quarter.First != "2024-01-01" || info.Quarter.Last != "2024-03-31" {
+		t.Errorf("unexpected quarter %+v", info.Quarter)
+	}
+	if info.Year.First != "2024-01-01" || info.Year.Last != "2024-12-31" {
+		t.Errorf("unexpected year %+v", info.Year)
+	}
+	if info.ISOWeek != (isoWeek{Year: 2024, Week: 6}) {
+		t.Errorf("unexpected iso week %+v", info.ISOWeek)
+	}
+	// Saturday the 10th, Monday the 12th to Thursday the 29th remain
+	if info.BusinessDaysRemainingInMonth != 14 {
+		t.Errorf("expected 14 business days but got %d", info.BusinessDaysRemainingInMonth)
+	}
+	if info.Epoch != "1707557400" {
+		t.Errorf("unexpected epoch %s", info.Epoch)
+	}
+
+	info = newDateInfo("", time.Date(2020, 12, 31, 0, 0, 0, 0, time.UTC))
+	if info.ISOWeek != (isoWeek{Year: 2020, Week: 53}) || info.Quarter.Number != 4 || info.BusinessDaysRemainingInMonth != 0 {
+		t.Errorf("unexpected year end info %+v", info)
+	}
+}
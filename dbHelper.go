@@ -1,52 +1,260 @@
 package dbhelper
 
 import (
+	"TestProject/Server/GolangServer/confighelper"
+	"TestProject/Server/GolangServer/secrets"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
 	"log"
+	"strconv"
+	"sync"
 	"time"
 
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
 )
 
-//GetMongoClient To get mongo db client
-func GetMongoClient(host, port, dbName, userName, password string, passwordSet bool) (*mongo.Client, context.Context, error) {
-	ctx, _ := context.WithTimeout(context.Background(), 10*time.Second)
-	var client *mongo.Client
-	var err error
+// OperationTimeout is the deadline given to the context returned with a database handle
+const OperationTimeout = 10 * time.Second
+
+// PoolSettings holds the connection pool options shared by every client of the registry
+type PoolSettings struct {
+	MaxPoolSize            uint64
+	MinPoolSize            uint64
+	MaxConnIdleTime        time.Duration
+	ServerSelectionTimeout time.Duration
+	ReadPreference         string
+}
+
+// ClientHealth is the result of pinging one registered client
+type ClientHealth struct {
+	URI     string        `json:"uri"`
+	Healthy bool          `json:"healthy"`
+	Latency time.Duration `json:"latency"`
+	Error   string        `json:"error,omitempty"`
+}
+
+// process wide registry, one client per uri and credential
+var (
+	clientsMutex sync.Mutex
+	clients      = map[string]*mongo.Client{}
+	clientURIs   = map[string]string{}
+	// clients retired by a config change, each is disconnected by its timer or by DisconnectAll
+	retiredClients = map[*mongo.Client]*time.Timer{}
+	retiring       sync.WaitGroup
+)
+
+// PoolSettingsFromConfig returns the MONGO_* pool keys of the loaded config
+func PoolSettingsFromConfig() PoolSettings {
+	cfg := confighelper.Get()
+	return PoolSettings{
+		MaxPoolSize:            cfg.MongoMaxPoolSize,
+		MinPoolSize:            cfg.MongoMinPoolSize,
+		MaxConnIdleTime:        cfg.MongoMaxConnIdleTime,
+		ServerSelectionTimeout: cfg.MongoServerSelectionTimeout,
+		ReadPreference:         cfg.MongoReadPreference,
+	}
+}
+
+// clientOptions builds the driver options of the settings
+func (settings PoolSettings) clientOptions() (*options.ClientOptions, error) {
+	mode, err := readpref.ModeFromString(settings.ReadPreference)
+	if err != nil {
+		return nil, fmt.Errorf("MONGO_READ_PREFERENCE: %v", err)
+	}
+	readPreference, err := readpref.New(mode)
+	if err != nil {
+		return nil, fmt.Errorf("MONGO_READ_PREFERENCE: %v", err)
+	}
+	return options.Client().
+		SetMaxPoolSize(settings.MaxPoolSize).
+		SetMinPoolSize(settings.MinPoolSize).
+		SetMaxConnIdleTime(settings.MaxConnIdleTime).
+		SetServerSelectionTimeout(settings.ServerSelectionTimeout).
+		SetReadPreference(readPreference), nil
+}
+
+//GetMongoClient To get the shared mongo db client, it is connected on the first call for a host and credential.
+//userName and password may be secret://path#key references.
+func GetMongoClient(host, port, dbName, userName, password string, passwordSet bool) (*mongo.Client, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), OperationTimeout)
+	defer cancel()
+	userName, err := secrets.Resolve(ctx, userName)
+	if err != nil {
+		return nil, err
+	}
+	if password, err = secrets.Resolve(ctx, password); err != nil {
+		return nil, err
+	}
+
+	uri := "mongodb://" + host + ":" + port
+	key := clientKey(uri, dbName, userName, password, passwordSet)
+
+	clientsMutex.Lock()
+	defer clientsMutex.Unlock()
+	if client, ok := clients[key]; ok {
+		return client, nil
+	}
+
+	clientOptions, err := PoolSettingsFromConfig().clientOptions()
+	if err != nil {
+		return nil, err
+	}
+	clientOptions.ApplyURI(uri)
 	if passwordSet {
-		client, err = mongo.Connect(ctx,
-			options.Client().SetAuth(options.Credential{
-				Username:    userName,
-				Password:    password,
-				AuthSource:  dbName,
-				PasswordSet: passwordSet,
-			}).ApplyURI("mongodb://@"+host+":"+port))
-	} else {
-		client, err = mongo.Connect(ctx,
-			options.Client().ApplyURI("mongodb://@"+host+":"+port))
-	}
-	return client, ctx, err
-}
-
-// func GetMongoClient(host, port, dbName, userName, password string, passwordSet bool) (*mongo.Client, context.Context, error) {
-// 	ctx, _ := context.WithTimeout(context.Background(), 20*time.Second)
-// 	client, err := mongo.Connect(ctx,
-// 		options.Client().SetAuth(options.Credential{
-// 			Username:    userName,
-// 			Password:    password,
-// 			AuthSource:  dbName,
-// 			PasswordSet: passwordSet,
-// 		}).ApplyURI("mongodb://@"+host+":"+port))
-// 	return client, ctx, err
-// }
-
-//GetMongoDB To Get the mongo db instance
-func GetMongoDB(host, port, dbName, userName, password string, passwordSet bool) (*mongo.Database, context.Context, error) {
-	client, ctx, err := GetMongoClient(host, port, dbName, userName, password, passwordSet)
+		clientOptions.SetAuth(options.Credential{
+			Username:    userName,
+			Password:    password,
+			AuthSource:  dbName,
+			PasswordSet: passwordSet,
+		})
+	}
+
+	client, err := mongo.Connect(ctx, clientOptions)
+	if err != nil {
+		return nil, err
+	}
+	clients[key] = client
+	clientURIs[key] = host + ":" + port
+	return client, nil
+}
+
+// clientKey tells the clients apart by uri and credential, the password is only kept as a hash.
+// Without a password the client does not authenticate and dbName does not matter.
+func clientKey(uri, dbName, userName, password string, passwordSet bool) string {
+	if !passwordSet {
+		return uri + "|" + userName
+	}
+	hash := sha256.Sum256([]byte(password))
+	return uri + "|" + userName + "|" + dbName + "|" + hex.EncodeToString(hash[:])
+}
+
+//GetMongoDB To Get the mongo db instance with a context bounded by OperationTimeout, the caller must call cancel
+func GetMongoDB(host, port, dbName, userName, password string, passwordSet bool) (*mongo.Database, context.Context, context.CancelFunc, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), OperationTimeout)
+	client, err := GetMongoClient(host, port, dbName, userName, password, passwordSet)
 	if err != nil {
 		log.Print("Error While Connecting Mongo Client")
-		return nil, ctx, err
+		return nil, ctx, cancel, err
+	}
+	return client.Database(dbName), ctx, cancel, nil
+}
+
+//GetConfiguredMongoClient To get the shared client of the configured DBIP, PORT, DBNAME, USENAME and PASSWORD
+func GetConfiguredMongoClient() (*mongo.Client, error) {
+	cfg := confighelper.Get()
+	return GetMongoClient(cfg.DBIP, strconv.Itoa(cfg.DBPort), cfg.DBName, cfg.DBUserName, cfg.DBPassword, cfg.DBPassword != "")
+}
+
+//GetConfiguredMongoDB To Get the configured DBNAME database, authenticated when PASSWORD is set, the caller must call cancel
+func GetConfiguredMongoDB() (*mongo.Database, context.Context, context.CancelFunc, error) {
+	cfg := confighelper.Get()
+	return GetMongoDB(cfg.DBIP, strconv.Itoa(cfg.DBPort), cfg.DBName, cfg.DBUserName, cfg.DBPassword, cfg.DBPassword != "")
+}
+
+// Health pings every registered client and reports the result per server
+func Health(ctx context.Context) []ClientHealth {
+	clientsMutex.Lock()
+	registered := make(map[string]*mongo.Client, len(clients))
+	uris := make(map[string]string, len(clients))
+	for key, client := range clients {
+		registered[key] = client
+		uris[key] = clientURIs[key]
+	}
+	clientsMutex.Unlock()
+
+	report := []ClientHealth{}
+	for key, client := range registered {
+		started := time.Now()
+		err := client.Ping(ctx, readpref.Primary())
+		health := ClientHealth{URI: uris[key], Healthy: err == nil, Latency: time.Since(started)}
+		if err != nil {
+			health.Error = err.Error()
+		}
+		report = append(report, health)
+	}
+	return report
+}
+
+// DisconnectAll closes every registered and retired client, the registry is empty afterwards
+func DisconnectAll(ctx context.Context) error {
+	clientsMutex.Lock()
+	registered := make([]*mongo.Client, 0, len(clients))
+	for key, client := range clients {
+		registered = append(registered, client)
+		delete(clients, key)
+		delete(clientURIs, key)
+	}
+	retired := make([]*mongo.Client, 0, len(retiredClients))
+	for client, timer := range retiredClients {
+		timer.Stop()
+		retired = append(retired, client)
+		delete(retiredClients, client)
+	}
+	clientsMutex.Unlock()
+
+	var firstErr error
+	for i, client := range append(registered, retired...) {
+		if err := client.Disconnect(ctx); err != nil {
+			log.Print("Error While Disconnecting Mongo Client::", err)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+		if i >= len(registered) {
+			retiring.Done()
+		}
+	}
+	// the retired clients whose timer fired already
+	retiring.Wait()
+	return firstErr
+}
+
+// keys of the config which need a new client when they change
+var mongoConfigKeys = []string{
+	"DBIP", "PORT", "DBNAME", "USENAME", "PASSWORD",
+	"MONGO_MAX_POOL_SIZE", "MONGO_MIN_POOL_SIZE", "MONGO_MAX_CONN_IDLE_TIME", "MONGO_SERVER_SELECTION_TIMEOUT", "MONGO_READ_PREFERENCE",
+}
+
+// WatchConfig retires the registered clients when a reload changes a mongo key, call the returned func to stop
+func WatchConfig() func() {
+	return confighelper.Subscribe(func(event confighelper.ChangeEvent) {
+		if event.Changed(mongoConfigKeys...) {
+			log.Print("Mongo Config Changed, Reconnecting Clients")
+			retireClients()
+		}
+	})
+}
+
+// retireClients empties the registry so the next call connects with the new settings,
+// the old clients are disconnected once their in-flight operations had OperationTimeout to finish
+func retireClients() {
+	clientsMutex.Lock()
+	defer clientsMutex.Unlock()
+	for _, client := range clients {
+		client := client
+		retiring.Add(1)
+		retiredClients[client] = time.AfterFunc(OperationTimeout, func() {
+			clientsMutex.Lock()
+			_, ok := retiredClients[client]
+			delete(retiredClients, client)
+			clientsMutex.Unlock()
+			if !ok {
+				// DisconnectAll took it
+				return
+			}
+			defer retiring.Done()
+
+			ctx, cancel := context.WithTimeout(context.Background(), OperationTimeout)
+			defer cancel()
+			if err := client.Disconnect(ctx); err != nil {
+				log.Print("Error While Disconnecting Retired Mongo Client::", err)
+			}
+		})
 	}
-	return client.Database(dbName), ctx, nil
+	clients = map[string]*mongo.Client{}
+	clientURIs = map[string]string{}
 }
@@ -0,0 +1,162 @@
+package dbhelper
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+)
+
+func TestPoolSettingsClientOptions(t *testing.T) {
+	settings := PoolSettings{
+		MaxPoolSize:            50,
+		MinPoolSize:            5,
+		MaxConnIdleTime:        time.Minute,
+		ServerSelectionTimeout: 2 * time.Second,
+		ReadPreference:         "secondaryPreferred",
+	}
+	clientOptions, err := settings.clientOptions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *clientOptions.MaxPoolSize != 50 || *clientOptions.MinPoolSize != 5 {
+		t.Errorf("pool size = %d-%d, want 5-50", *clientOptions.MinPoolSize, *clientOptions.MaxPoolSize)
+	}
+	if *clientOptions.MaxConnIdleTime != time.Minute || *clientOptions.ServerSelectionTimeout != 2*time.Second {
+		t.Errorf("idle, selection timeout = %v, %v", *clientOptions.MaxConnIdleTime, *clientOptions.ServerSelectionTimeout)
+	}
+	if clientOptions.ReadPreference.Mode() != readpref.SecondaryPreferredMode {
+		t.Errorf("read preference = %v", clientOptions.ReadPreference.Mode())
+	}
+
+	settings.ReadPreference = "closest"
+	if _, err := settings.clientOptions(); err == nil {
+		t.Error("an unknown read preference is accepted")
+	}
+}
+
+func TestPoolSettingsFromConfig(t *testing.T) {
+	settings := PoolSettingsFromConfig()
+	if settings.MaxPoolSize != 100 || settings.ServerSelectionTimeout != 5*time.Second || settings.ReadPreference != "primary" {
+		t.Errorf("settings = %+v, want the config defaults", settings)
+	}
+}
+
+func TestClientRegistry(t *testing.T) {
+	ctx := context.Background()
+	if report := Health(ctx); len(report) != 0 {
+		t.Errorf("health of an empty registry = %+v", report)
+	}
+	if err := DisconnectAll(ctx); err != nil {
+		t.Errorf("DisconnectAll of an empty registry = %v", err)
+	}
+
+	// the driver connects lazily, no server is needed to register a client
+	client, err := GetMongoClient("127.0.0.1", "1", "testDB", "user", "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer DisconnectAll(ctx)
+	if same, _ := GetMongoClient("127.0.0.1", "1", "otherDB", "user", "", false); same != client {
+		t.Error("the same host and user get a new client")
+	}
+	if other, _ := GetMongoClient("127.0.0.1", "1", "testDB", "admin", "", false); other == client {
+		t.Error("another user shares the client")
+	}
+	// a client which authenticates is kept per password and auth database
+	authenticated, _ := GetMongoClient("127.0.0.1", "1", "testDB", "user", "secret", true)
+	if authenticated == client {
+		t.Error("an authenticated user shares the client without a password")
+	}
+	if other, _ := GetMongoClient("127.0.0.1", "1", "testDB", "user", "changed", true); other == authenticated {
+		t.Error("another password shares the client")
+	}
+	if other, _ := GetMongoClient("127.0.0.1", "1", "otherDB", "user", "secret", true); other == authenticated {
+		t.Error("another auth database shares the client")
+	}
+	if same, _ := GetMongoClient("127.0.0.1", "1", "testDB", "user", "secret", true); same != authenticated {
+		t.Error("the same credential gets a new client")
+	}
+
+	pingCtx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	report := Health(pingCtx)
+	if len(report) != 5 {
+		t.Fatalf("health = %+v, want every client", report)
+	}
+	for _, health := range report {
+		if health.URI != "127.0.0.1:1" || health.Healthy || health.Error == "" {
+			t.Errorf("health = %+v, want an unhealthy 127.0.0.1:1", health)
+		}
+	}
+
+	if err := DisconnectAll(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if report := Health(ctx); len(report) != 0 {
+		t.Errorf("health after DisconnectAll = %+v", report)
+	}
+	if again, _ := GetMongoClient("127.0.0.1", "1", "testDB", "user", "", false); again == client {
+		t.Error("a disconnected client is returned")
+	}
+}
+
+func TestClientKeyHidesThePassword(t *testing.T) {
+	key := clientKey("mongodb://127.0.0.1:1", "testDB", "user", "secret", true)
+	if strings.Contains(key, "secret") {
+		t.Errorf("key %q holds the password", key)
+	}
+}
+
+func TestDisconnectAllDrainsRetiredClients(t *testing.T) {
+	ctx := context.Background()
+	client, err := GetMongoClient("127.0.0.1", "1", "testDB", "user", "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	retireClients()
+	if len(retiredClients) != 1 {
+		t.Fatalf("retired = %d clients, want 1", len(retiredClients))
+	}
+
+	if err := DisconnectAll(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(retiredClients) != 0 {
+		t.Errorf("retired = %d clients after DisconnectAll", len(retiredClients))
+	}
+	if err := client.Ping(ctx, nil); !errors.Is(err, mongo.ErrClientDisconnected) {
+		t.Errorf("ping of the retired client = %v, want it disconnected", err)
+	}
+}
+
+func TestGetMongoDB(t *testing.T) {
+	defer DisconnectAll(context.Background())
+
+	db, ctx, cancel, err := GetMongoDB("127.0.0.1", "1", "testDB", "user", "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cancel()
+	if db.Name() != "testDB" {
+		t.Errorf("database = %q, want testDB", db.Name())
+	}
+	if deadline, ok := ctx.Deadline(); !ok || time.Until(deadline) > OperationTimeout {
+		t.Errorf("deadline = %v, %v, want at most OperationTimeout", deadline, ok)
+	}
+	cancel()
+	if ctx.Err() == nil {
+		t.Error("cancel does not end the context")
+	}
+
+	// the context and cancel are returned with the error too
+	db, ctx, cancel, err = GetMongoDB("127.0.0.1", "1", "testDB", "secret://missing#username", "", false)
+	if err == nil || db != nil || ctx == nil || cancel == nil {
+		t.Fatalf("unresolved user = %v, %v, %v", db, ctx, err)
+	}
+	cancel()
+}
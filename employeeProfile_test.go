@@ -0,0 +1,160 @@
+package main
+
+import (
+	"TestProject/Server/GolangServer/apperrors"
+	"TestProject/Server/GolangServer/model"
+	"TestProject/Server/GolangServer/validation"
+
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+// in memory DAOs for the employee profile services, soft deleted profiles are kept like in MongoDB
+type fakeEmployeeStore map[string]model.EmployeeProfile
+
+func (store fakeEmployeeStore) install(t *testing.T) {
+	savedCreate, savedGet, savedPatch, savedSoftDelete, savedPurge := createEmployee, getEmployee, patchEmployee, softDeleteEmployee, purgeEmployee
+	t.Cleanup(func() {
+		createEmployee, getEmployee, patchEmployee, softDeleteEmployee, purgeEmployee = savedCreate, savedGet, savedPatch, savedSoftDelete, savedPurge
+	})
+
+	createEmployee = func(_ context.Context, profile model.EmployeeProfile) error {
+		if existing, ok := store[profile.LoginId]; ok && !existing.IsDeleted {
+			return apperrors.Conflict("record already exists")
+		}
+		profile.IsDeleted = false
+		store[profile.LoginId] = profile
+		return nil
+	}
+	getEmployee = func(loginId string) (model.EmployeeProfile, error) {
+		profile, ok := store[loginId]
+		if !ok || profile.IsDeleted {
+			return model.EmployeeProfile{}, apperrors.NotFound("record not found")
+		}
+		return profile, nil
+	}
+	patchEmployee = func(_ context.Context, loginId string, patch model.EmployeeProfilePatch) (model.EmployeeProfile, error) {
+		profile, err := getEmployee(loginId)
+		if err != nil {
+			return profile, err
+		}
+		if patch.FullName != nil {
+			profile.FullName = *patch.FullName
+		}
+		if patch.IsEnabled != nil {
+			profile.IsEnabled = *patch.IsEnabled
+		}
+		store[loginId] = profile
+		return profile, nil
+	}
+	softDeleteEmployee = func(_ context.Context, loginId string) error {
+		profile, err := getEmployee(loginId)
+		if err != nil {
+			return err
+		}
+		profile.IsDeleted = true
+		store[loginId] = profile
+		return nil
+	}
+	purgeEmployee = func(_ context.Context, loginId string) error {
+		if _, ok := store[loginId]; !ok {
+			return apperrors.NotFound("record not found")
+		}
+		delete(store, loginId)
+		return nil
+	}
+}
+
+func newEmployeeTestServer() *echo.Echo {
+	e := echo.New()
+	e.HTTPErrorHandler = apperrors.HTTPErrorHandler
+	e.Validator = validation.NewEchoValidator()
+	e.POST("/employees", CreateEmployeeService)
+	e.GET("/employees/:loginId", GetEmployeeService)
+	e.PATCH("/employees/:loginId", PatchEmployeeService)
+	e.DELETE("/employees/:loginId", SoftDeleteEmployeeService)
+	e.DELETE("/employees/:loginId/purge", PurgeEmployeeService)
+	return e
+}
+
+func employeeRequest(e *echo.Echo, method, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestEmployeeProfileLifecycle(t *testing.T) {
+	store := fakeEmployeeStore{}
+	store.install(t)
+	e := newEmployeeTestServer()
+
+	steps := []struct {
+		method, path, body string
+		status             int
+	}{
+		{http.MethodPost, "/employees", `{"loginId":"jdoe","fullName":"John Doe","isEnabled":true}`, http.StatusCreated},
+		{http.MethodPost, "/employees", `{"loginId":"jdoe","fullName":"Jane Doe"}`, http.StatusConflict},
+		{http.MethodGet, "/employees/jdoe", "", http.StatusOK},
+		{http.MethodPatch, "/employees/jdoe", `{"fullName":"Johnny Doe"}`, http.StatusOK},
+		{http.MethodDelete, "/employees/jdoe", "", http.StatusNoContent},
+		{http.MethodGet, "/employees/jdoe", "", http.StatusNotFound},
+		{http.MethodPatch, "/employees/jdoe", `{"isEnabled":false}`, http.StatusNotFound},
+		{http.MethodDelete, "/employees/jdoe", "", http.StatusNotFound},
+		// a soft deleted profile is created again
+		{http.MethodPost, "/employees", `{"loginId":"jdoe","fullName":"Jane Doe"}`, http.StatusCreated},
+		{http.MethodDelete, "/employees/jdoe/purge", "", http.StatusNoContent},
+		{http.MethodDelete, "/employees/jdoe/purge", "", http.StatusNotFound},
+	}
+	for i, step := range steps {
+		if rec := employeeRequest(e, step.method, step.path, step.body); rec.Code != step.status {
+			t.Fatalf("step %d %s %s = %d, want %d: %s", i, step.method, step.path, rec.Code, step.status, rec.Body)
+		}
+	}
+	if len(store) != 0 {
+		t.Errorf("store = %v, want the profile purged", store)
+	}
+}
+
+func TestEmployeeProfilePatchResponse(t *testing.T) {
+	store := fakeEmployeeStore{"jdoe": {LoginId: "jdoe", FullName: "John Doe", IsEnabled: true}}
+	store.install(t)
+	e := newEmployeeTestServer()
+
+	rec := employeeRequest(e, http.MethodPatch, "/employees/jdoe", `{"isEnabled":false}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	profile := model.EmployeeProfile{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &profile); err != nil {
+		t.Fatal(err)
+	}
+	if profile.FullName != "John Doe" || profile.IsEnabled {
+		t.Errorf("profile = %+v, want only isEnabled changed", profile)
+	}
+}
+
+func TestEmployeeProfileValidation(t *testing.T) {
+	fakeEmployeeStore{}.install(t)
+	e := newEmployeeTestServer()
+
+	for _, step := range []struct{ method, path, body string }{
+		{http.MethodPost, "/employees", `{"fullName":"John Doe"}`},
+		{http.MethodPost, "/employees", `{"loginId":"` + strings.Repeat("x", 65) + `"}`},
+		{http.MethodPost, "/employees", `{"loginId":`},
+		{http.MethodPatch, "/employees/jdoe", `{"fullName":""}`},
+	} {
+		if rec := employeeRequest(e, step.method, step.path, step.body); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s %s %s = %d, want 400", step.method, step.path, step.body, rec.Code)
+		}
+	}
+}
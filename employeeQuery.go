@@ -0,0 +1,266 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	defaultPageLimit = 20
+	maxPageLimit     = 100
+)
+
+// Fields of employee_profile a caller may sort or filter on, with their value kind
+var employeeListFields = map[string]string{
+	"fullName":  "string",
+	"loginId":   "string",
+	"isEnabled": "bool",
+}
+
+// Query string keys which are not filters
+var employeeListReservedKeys = map[string]bool{
+	"limit":  true,
+	"offset": true,
+	"sort":   true,
+	"cursor": true,
+}
+
+// One entry of the sort parameter, "-fullName" is FullName descending
+type sortField struct {
+	Name string
+	Desc bool
+}
+
+// Decoded next page token, the sort values and _id of the last record of the previous page
+type pageCursor struct {
+	Values []interface{} `json:"v"`
+	ID     string        `json:"id"`
+}
+
+// Parsed form of the GetAllRecordsService query string
+type employeeListQuery struct {
+	Limit  int64
+	Offset int64
+	Sort   []sortField
+	Filter bson.M
+	After  *pageCursor
+}
+
+// Response of GetAllRecordsService
+type employeeListPage struct {
+	Records       interface{} `json:"records"`
+	Total         int64       `json:"total"`
+	Limit         int64       `json:"limit"`
+	Offset        int64       `json:"offset"`
+	NextPageToken string      `json:"nextPageToken,omitempty"`
+}
+
+// parseEmployeeListQuery reads limit, offset, sort, cursor and the field filters.
+// "field=value" is an exact match and "field~=prefix" a prefix match on string fields.
+func parseEmployeeListQuery(values url.Values) (employeeListQuery, error) {
+	listQuery := employeeListQuery{Limit: defaultPageLimit, Filter: bson.M{"isDeleted": false}}
+
+	if limit := values.Get("limit"); limit != "" {
+		parsed, err := strconv.ParseInt(limit, 10, 64)
+		if err != nil || parsed < 1 || parsed > maxPageLimit {
+			return listQuery, fmt.Errorf("limit must be a number between 1 and %d", maxPageLimit)
+		}
+		listQuery.Limit = parsed
+	}
+	if offset := values.Get("offset"); offset != "" {
+		parsed, err := strconv.ParseInt(offset, 10, 64)
+		if err != nil || parsed < 0 {
+			return listQuery, fmt.Errorf("offset must be a positive number")
+		}
+		listQuery.Offset = parsed
+	}
+
+	if sort := values.Get("sort"); sort != "" {
+		seen := map[string]bool{}
+		for _, name := range strings.Split(sort, ",") {
+			field := sortField{Name: strings.TrimSpace(name)}
+			if strings.HasPrefix(field.Name, "-") {
+				field.Name, field.Desc = field.Name[1:], true
+			}
+			if _, ok := employeeListFields[field.Name]; !ok {
+				return listQuery, fmt.Errorf("sort on %q is not supported", field.Name)
+			}
+			if seen[field.Name] {
+				return listQuery, fmt.Errorf("sort on %q is repeated", field.Name)
+			}
+			seen[field.Name] = true
+			listQuery.Sort = append(listQuery.Sort, field)
+		}
+	}
+
+	if token := values.Get("cursor"); token != "" {
+		if listQuery.Offset != 0 {
+			return listQuery, fmt.Errorf("cursor and offset can not be used together")
+		}
+		after, err := decodePageCursor(token)
+		if err != nil || len(after.Values) != len(listQuery.Sort) {
+			return listQuery, fmt.Errorf("cursor is not valid for this sort")
+		}
+		for i, field := range listQuery.Sort {
+			value, err := cursorValue(employeeListFields[field.Name], after.Values[i])
+			if err != nil {
+				return listQuery, fmt.Errorf("cursor is not valid for this sort")
+			}
+			after.Values[i] = value
+		}
+		listQuery.After = after
+	}
+
+	for key, filterValues := range values {
+		if employeeListReservedKeys[key] {
+			continue
+		}
+		name := strings.TrimSuffix(key, "~")
+		kind, ok := employeeListFields[name]
+		if !ok {
+			return listQuery, fmt.Errorf("filter on %q is not supported", key)
+		}
+		value := filterValues[0]
+		switch {
+		case name != key && kind != "string":
+			return listQuery, fmt.Errorf("prefix filter on %q is not supported", name)
+		case name != key:
+			listQuery.Filter[name] = bson.M{"$regex": "^" + regexp.QuoteMeta(value)}
+		case kind == "bool":
+			parsed, err := strconv.ParseBool(value)
+			if err != nil {
+				return listQuery, fmt.Errorf("%s must be true or false", name)
+			}
+			listQuery.Filter[name] = parsed
+		default:
+			listQuery.Filter[name] = value
+		}
+	}
+
+	return listQuery, nil
+}
+
+// sortDoc returns the requested sort with _id appended, so pages are stable
+func (listQuery employeeListQuery) sortDoc() bson.D {
+	sortDoc := bson.D{}
+	for _, field := range listQuery.Sort {
+		direction := 1
+		if field.Desc {
+			direction = -1
+		}
+		sortDoc = append(sortDoc, bson.E{Key: field.Name, Value: direction})
+	}
+	return append(sortDoc, bson.E{Key: "_id", Value: 1})
+}
+
+// findFilter returns the filter of the page, restricted to records after the cursor if any
+func (listQuery employeeListQuery) findFilter() (bson.M, error) {
+	if listQuery.After == nil {
+		return listQuery.Filter, nil
+	}
+	afterId, err := primitive.ObjectIDFromHex(listQuery.After.ID)
+	if err != nil {
+		return nil, fmt.Errorf("cursor is not valid for this sort")
+	}
+
+	// (a > x) OR (a = x AND b > y) OR ... OR (a = x AND b = y AND _id > id)
+	keys := append([]sortField{}, listQuery.Sort...)
+	keys = append(keys, sortField{Name: "_id"})
+	values := append(append([]interface{}{}, listQuery.After.Values...), afterId)
+
+	branches := []bson.M{}
+	for i, key := range keys {
+		after, ok := afterCondition(key, values[i])
+		if !ok {
+			continue
+		}
+		branch := bson.M{}
+		for j := 0; j < i; j++ {
+			branch[keys[j].Name] = values[j]
+		}
+		for name, condition := range after {
+			branch[name] = condition
+		}
+		branches = append(branches, branch)
+	}
+	return bson.M{"$and": []bson.M{listQuery.Filter, {"$or": branches}}}, nil
+}
+
+// afterCondition matches the values which come after value in the sort order of key, false when none does.
+// null, the value of a record without the field, sorts before every other value and $gt or $lt never match it.
+func afterCondition(key sortField, value interface{}) (bson.M, bool) {
+	switch {
+	case value == nil && key.Desc:
+		return nil, false
+	case value == nil:
+		return bson.M{key.Name: bson.M{"$ne": nil}}, true
+	case key.Desc:
+		return bson.M{"$or": []bson.M{{key.Name: bson.M{"$lt": value}}, {key.Name: nil}}}, true
+	default:
+		return bson.M{key.Name: bson.M{"$gt": value}}, true
+	}
+}
+
+// nextPageToken returns the token pointing after the given record
+func (listQuery employeeListQuery) nextPageToken(record map[string]interface{}) (string, error) {
+	id, ok := record["_id"].(primitive.ObjectID)
+	if !ok {
+		return "", fmt.Errorf("record has no object id")
+	}
+	after := pageCursor{ID: id.Hex()}
+	for _, field := range listQuery.Sort {
+		after.Values = append(after.Values, record[field.Name])
+	}
+	bs, err := json.Marshal(after)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(bs), nil
+}
+
+// cursorValue checks a decoded cursor value against the kind of its sort field, the values go into the
+// filter as they are so a token must not carry a map or slice like {"$ne": null}.
+// null is the value of a record without the field.
+func cursorValue(kind string, value interface{}) (interface{}, error) {
+	if value == nil {
+		return nil, nil
+	}
+	switch kind {
+	case "string":
+		if s, ok := value.(string); ok {
+			return s, nil
+		}
+	case "bool":
+		if b, ok := value.(bool); ok {
+			return b, nil
+		}
+	case "date":
+		// dates are written to the token as RFC 3339 text by encoding/json
+		if s, ok := value.(string); ok {
+			return time.Parse(time.RFC3339Nano, s)
+		}
+	}
+	return nil, fmt.Errorf("cursor value %v is not a %s", value, kind)
+}
+
+// decodePageCursor is the reverse of nextPageToken
+func decodePageCursor(token string) (*pageCursor, error) {
+	bs, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, err
+	}
+	after := &pageCursor{}
+	if err := json.Unmarshal(bs, after); err != nil {
+		return nil, err
+	}
+	return after, nil
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/base64"
+	"net/url"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestParseEmployeeListQuery(t *testing.T) {
+	values, _ := url.ParseQuery("limit=5&offset=10&sort=fullName,-loginId&isEnabled=true&fullName~=Jo.")
+	listQuery, err := parseEmployeeListQuery(values)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if listQuery.Limit != 5 || listQuery.Offset != 10 {
+		t.Errorf("expected limit 5 offset 10 but got %d %d", listQuery.Limit, listQuery.Offset)
+	}
+	if len(listQuery.Sort) != 2 || listQuery.Sort[0] != (sortField{Name: "fullName"}) || listQuery.Sort[1] != (sortField{Name: "loginId", Desc: true}) {
+		t.Errorf("unexpected sort %+v", listQuery.Sort)
+	}
+	if listQuery.Filter["isDeleted"] != false || listQuery.Filter["isEnabled"] != true {
+		t.Errorf("unexpected filter %+v", listQuery.Filter)
+	}
+	if prefix, _ := listQuery.Filter["fullName"].(bson.M); prefix["$regex"] != `^Jo\.` {
+		t.Errorf("expected escaped prefix regex but got %+v", listQuery.Filter["fullName"])
+	}
+
+	sortDoc := listQuery.sortDoc()
+	if len(sortDoc) != 3 || sortDoc[1].Value != -1 || sortDoc[2].Key != "_id" {
+		t.Errorf("unexpected sort document %+v", sortDoc)
+	}
+}
+
+func TestParseEmployeeListQueryErrors(t *testing.T) {
+	for _, query := range []string{
+		"limit=0",
+		"limit=101",
+		"offset=-1",
+		"sort=password",
+		"sort=fullName,-fullName",
+		"isDeleted=true",
+		"isEnabled~=t",
+		"isEnabled=maybe",
+		"cursor=not-a-token",
+	} {
+		values, _ := url.ParseQuery(query)
+		if _, err := parseEmployeeListQuery(values); err == nil {
+			t.Errorf("expected an error for %q", query)
+		}
+	}
+}
+
+func TestPageTokenRoundTrip(t *testing.T) {
+	values, _ := url.ParseQuery("sort=-fullName")
+	listQuery, _ := parseEmployeeListQuery(values)
+
+	id := primitive.NewObjectID()
+	token, err := listQuery.nextPageToken(map[string]interface{}{"_id": id, "fullName": "Jane"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	values.Set("cursor", token)
+	listQuery, err = parseEmployeeListQuery(values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	filter, err := listQuery.findFilter()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	branches := filter["$and"].([]bson.M)[1]["$or"].([]bson.M)
+	if len(branches) != 2 {
+		t.Fatalf("expected 2 keyset branches but got %d", len(branches))
+	}
+	// records without a fullName come last in a descending sort
+	after := branches[0]["$or"].([]bson.M)
+	if after[0]["fullName"].(bson.M)["$lt"] != "Jane" || after[1]["fullName"] != nil {
+		t.Errorf("expected descending branch on fullName but got %+v", branches[0])
+	}
+	if branches[1]["fullName"] != "Jane" || branches[1]["_id"].(bson.M)["$gt"] != id {
+		t.Errorf("expected tie break on _id but got %+v", branches[1])
+	}
+}
+
+func TestPageCursorAfterNull(t *testing.T) {
+	id := primitive.NewObjectID()
+	for sort, want := range map[string]int{"fullName": 2, "-fullName": 1} {
+		values, _ := url.ParseQuery("sort=" + sort)
+		listQuery, _ := parseEmployeeListQuery(values)
+		// the last record of the page has no fullName
+		token, err := listQuery.nextPageToken(map[string]interface{}{"_id": id})
+		if err != nil {
+			t.Fatal(err)
+		}
+		values.Set("cursor", token)
+		if listQuery, err = parseEmployeeListQuery(values); err != nil {
+			t.Fatal(err)
+		}
+		filter, err := listQuery.findFilter()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		branches := filter["$and"].([]bson.M)[1]["$or"].([]bson.M)
+		if len(branches) != want {
+			t.Fatalf("sort %s: expected %d keyset branches but got %+v", sort, want, branches)
+		}
+		// ascending, every record with a fullName follows, $gt: null would match none of them
+		if want == 2 && branches[0]["fullName"].(bson.M)["$ne"] != nil {
+			t.Errorf("sort %s: expected the records with a fullName but got %+v", sort, branches[0])
+		}
+		// descending, only the records without a fullName and a greater _id follow
+		last := branches[len(branches)-1]
+		if last["fullName"] != nil || last["_id"].(bson.M)["$gt"] != id {
+			t.Errorf("sort %s: expected tie break on _id but got %+v", sort, last)
+		}
+	}
+}
+
+func TestPageCursorRejectsOperators(t *testing.T) {
+	id := primitive.NewObjectID().Hex()
+	for query, values := range map[string]string{
+		"sort=fullName":  `[{"$ne":null}]`,
+		"sort=loginId":   `[["a"]]`,
+		"sort=isEnabled": `["true"]`,
+		"sort=-fullName": `[1]`,
+	} {
+		token := base64.RawURLEncoding.EncodeToString([]byte(`{"v":` + values + `,"id":"` + id + `"}`))
+		urlValues, _ := url.ParseQuery(query)
+		urlValues.Set("cursor", token)
+		if _, err := parseEmployeeListQuery(urlValues); err == nil {
+			t.Errorf("expected an error for %s with cursor values %s", query, values)
+		}
+	}
+
+	// a record without the sort field pages on null
+	token := base64.RawURLEncoding.EncodeToString([]byte(`{"v":[null],"id":"` + id + `"}`))
+	urlValues, _ := url.ParseQuery("sort=isEnabled&cursor=" + token)
+	if _, err := parseEmployeeListQuery(urlValues); err != nil {
+		t.Errorf("expected a null cursor value to be accepted but got %v", err)
+	}
+}
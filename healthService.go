@@ -0,0 +1,43 @@
+package main
+
+import (
+	"TestProject/Server/GolangServer/dbhelper"
+	"context"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const readinessTimeout = 2 * time.Second
+
+// set once shutdown starts so /readyz stops accepting traffic while requests drain
+var shuttingDown int32
+
+//Liveness, the process is up and serving
+func HealthzService(c echo.Context) error {
+	return c.JSON(http.StatusOK, map[string]string{"status": "ok"})
+}
+
+//Readiness, MongoDB answers a ping and the server is not shutting down
+func ReadyzService(c echo.Context) error {
+	if atomic.LoadInt32(&shuttingDown) == 1 {
+		return c.JSON(http.StatusServiceUnavailable, map[string]string{"status": "shutting down"})
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request().Context(), readinessTimeout)
+	defer cancel()
+
+	// connects the shared client on the first call so readiness reflects the real DB
+	if _, err := dbhelper.GetConfiguredMongoClient(); err != nil {
+		return c.JSON(http.StatusServiceUnavailable, map[string]interface{}{"status": "unavailable", "error": err.Error()})
+	}
+	report := dbhelper.Health(ctx)
+	for _, health := range report {
+		if !health.Healthy {
+			return c.JSON(http.StatusServiceUnavailable, map[string]interface{}{"status": "unavailable", "mongo": report})
+		}
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{"status": "ok", "mongo": report})
+}
@@ -1,9 +1,12 @@
 package main
 
 import (
+	"TestProject/Server/GolangServer/secrets"
+	"context"
 	"database/sql"
 	"fmt"
 	"log"
+	"os"
 	"strings"
 
 	_ "github.com/lib/pq"
@@ -16,9 +19,16 @@ const (
 var db *sql.DB
 
 func main() {
-	// Replace these connection parameters with your PostgreSQL credentials
-	connStr := "user=username dbname=mydb sslmode=disable"
-	var err error
+	// Replace these connection parameters with your PostgreSQL credentials,
+	// POSTGRES_CONN_STR may hold references such as password=secret://postgres#password
+	connStr := os.Getenv("POSTGRES_CONN_STR")
+	if connStr == "" {
+		connStr = "user=username dbname=mydb sslmode=disable"
+	}
+	connStr, err := secrets.ResolveString(context.Background(), connStr)
+	if err != nil {
+		log.Fatal(err)
+	}
 	db, err = sql.Open("postgres", connStr)
 	if err != nil {
 		log.Fatal(err)
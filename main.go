@@ -1,72 +1,158 @@
 package main
 
 import (
+	"TestProject/Server/GolangServer/apperrors"
 	"TestProject/Server/GolangServer/collection"
 	"TestProject/Server/GolangServer/confighelper"
 	"TestProject/Server/GolangServer/dbhelper"
 	"TestProject/Server/GolangServer/model"
-	"encoding/json"
+	"TestProject/Server/GolangServer/validation"
+	"digi-data-ingestion-client/audit"
+	mongohelper "digi-data-ingestion-client/clients/mongo"
 
+	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"gopkg.in/mgo.v2/bson"
 
+	"context"
 	"fmt"
-	"io/ioutil"
 	"log"
 	"net/http"
-	"strings"
+	"os"
+	"os/signal"
+	"strconv"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
-	"regexp"
-
 	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
 
-	strip "github.com/grokify/html-strip-tags-go"
 	"github.com/tidwall/gjson"
 	"github.com/tidwall/sjson"
 )
 
 const (
-	RegExp       = `s/<[a-zA-Z\/][^>]*>//g`
-	layoutISO    = "2006-01-02T15:04"
-	layoutUS     = "January 2, 2006"
-	secondRegExp = `[^a-z ^A-Z]`
+	layoutISO = "2006-01-02T15:04"
+	layoutUS  = "January 2, 2006"
 )
 
-var wg sync.WaitGroup
-var primeNumberList []int
+// name of the unique loginId index of the employee profiles, CreateEmployeeDAO relies on it
+const employeeLoginIdIndex = "loginId_unique"
+
+// DAOs of the employee profile services, the tests replace them
+var (
+	createEmployee     = CreateEmployeeDAO
+	getEmployee        = GetEmployeeDAO
+	patchEmployee      = PatchEmployeeDAO
+	softDeleteEmployee = SoftDeleteEmployeeDAO
+	purgeEmployee      = PurgeEmployeeDAO
+)
+
+// databases where the unique loginId index is known to exist
+var (
+	employeeIndexMutex sync.Mutex
+	employeeIndexed    = map[string]bool{}
+)
 
 func main() {
 
-	confighelper.InitViper()
+	cfg, err := confighelper.Load(os.Args[1:])
+	if err != nil {
+		log.Fatal("Error While Loading Config::", err)
+	}
+	if cfg.PrintConfig {
+		if err := confighelper.PrintRedacted(os.Stdout, cfg); err != nil {
+			log.Fatal("Error While Printing Config::", err)
+		}
+		return
+	}
+	if err := confighelper.Watch(); err != nil {
+		log.Print("Config Hot Reload Disabled::", err)
+	}
+	defer dbhelper.WatchConfig()()
+	employeeAudit = audit.NewWriter(auditCollection, audit.DefaultBufferSize, func(err error) {
+		log.Print("Error While Writing Audit Entries::", err)
+	})
+
 	e := echo.New()
+	e.HTTPErrorHandler = apperrors.HTTPErrorHandler
+	e.Validator = validation.NewEchoValidator()
+	e.Use(middleware.Recover())
+	e.Use(middleware.RequestID())
 	e.POST("/getColumns", getColumns)
+	e.POST("/columns/range", ColumnRangeService)
+	e.GET("/columns/index", ColumnIndexService)
+	e.GET("/columns/label", ColumnLabelService)
 	e.POST("/getWordCountService", GetWordCountService)
 	e.POST("/getLastDayOfInputDate", GetLastDayOfInputDate)
+	e.GET("/dates/info", GetDateInfoService)
+	e.POST("/dates/info", GetDateInfoService)
 	e.POST("/getPrimeNumberListService", GetPrimeNumberListService)
 	e.POST("/updateCandidateRecordService", UpdateCandidateRecordService)
 	e.POST("/deleteRecordService", DeleteRecordService)
 	e.GET("/getAllRecordsService", GetAllRecordsService)
-	e.Logger.Fatal(e.Start(":4000"))
+	e.POST("/employees", CreateEmployeeService)
+	e.GET("/employees/:loginId", GetEmployeeService)
+	e.PATCH("/employees/:loginId", PatchEmployeeService)
+	e.DELETE("/employees/:loginId", SoftDeleteEmployeeService)
+	e.DELETE("/employees/:loginId/purge", PurgeEmployeeService)
+	e.GET("/employees/:loginId/history", EmployeeHistoryService)
+	e.GET("/healthz", HealthzService)
+	e.GET("/readyz", ReadyzService)
+
+	e.Server.ReadTimeout = cfg.ServerReadTimeout
+	e.Server.WriteTimeout = cfg.ServerWriteTimeout
+	e.Server.IdleTimeout = cfg.ServerIdleTimeout
+
+	go func() {
+		if err := e.Start(":" + strconv.Itoa(cfg.ServerPort)); err != nil && err != http.ErrServerClosed {
+			e.Logger.Fatal(err)
+		}
+	}()
+
+	// wait for SIGINT/SIGTERM, then drain in-flight requests and close the Mongo clients
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
+	<-quit
+	atomic.StoreInt32(&shuttingDown, 1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ServerShutdownTimeout)
+	defer cancel()
+	if err := e.Shutdown(ctx); err != nil {
+		e.Logger.Error("Error While Shutting Down Server::", err)
+	}
+	if err := employeeAudit.Close(ctx); err != nil {
+		e.Logger.Error("Error While Writing Audit Entries::", err)
+	}
+	if err := dbhelper.DisconnectAll(ctx); err != nil {
+		e.Logger.Error("Error While Disconnecting MongoDB::", err)
+	}
 }
 
 //This service is return the colums and rows by processing input
 func getColumns(c echo.Context) error {
-	body, _ := GetRequestBodyJson(c)
-	columnToStart := body.Get("columnToStart").String()
-	numRows := body.Get("numRows").Int()
-	numCols := body.Get("numCols").Int()
-	res := GetColList(columnToStart, int(numRows), int(numCols))
+	columnsRequest := model.ColumnsRequest{}
+	if err := validation.BindAndValidate(c, &columnsRequest); err != nil {
+		return err
+	}
+	res := GetColList(columnsRequest.ColumnToStart, columnsRequest.NumRows, columnsRequest.NumCols)
 	return c.JSON(http.StatusOK, res)
 }
 
 //Function will return the last day of input date
 func GetLastDayOfInputDate(c echo.Context) error {
-	body, _ := GetRequestBodyJson(c)
+	lastDayOfDateRequest := model.LastDayOfDateRequest{}
+	if err := validation.BindAndValidate(c, &lastDayOfDateRequest); err != nil {
+		return err
+	}
 
-	date := body.Get("Date").String()
-	t, _ := time.Parse(layoutISO, date)
+	date := lastDayOfDateRequest.Date
+	t, err := time.Parse(layoutISO, date)
+	if err != nil {
+		return apperrors.Validation("invalid request", map[string]string{"Date": "Date must be a date in the format " + layoutISO})
+	}
 	now := time.Now()
 	currentYear, currentMonth := t.Year(), t.Month()
 	currentLocation := now.Location()
@@ -78,234 +164,187 @@ func GetLastDayOfInputDate(c echo.Context) error {
 	return c.JSON(http.StatusOK, ldData.Value())
 }
 
-//Read the URL and retun the json string
-func GetRequestBodyJson(c echo.Context) (body gjson.Result, err error) {
-	bb, err := ioutil.ReadAll(c.Request().Body)
-	if err != nil {
-		fmt.Println("Error Reading Request Body")
-		return gjson.Result{}, err
+//to delete the input login Id details PERMENTLY
+func DeleteRecordService(c echo.Context) error {
+	deleteRecordRequest := model.DeleteRecordRequest{}
+	if err := validation.BindAndValidate(c, &deleteRecordRequest); err != nil {
+		return err
 	}
-	return gjson.ParseBytes(bb), nil
-}
-
-func GetColList(columnToStart string, numRows, numCols int) []string {
-	colList := []string{}
-	colList = append(colList, columnToStart)
 
-	// fixed := 0
-	pivot := 0
-	// if len(columnToStart) > 1 {
-	// 	fixed = len(columnToStart) - 2
-	// }
-	//ABC
-	if len(columnToStart) > 0 {
-		pivot = len(columnToStart) - 1
+	_, serviceCallError := DeleteRecordDAO(auditContext(c), deleteRecordRequest.LoginId)
+	if serviceCallError != nil {
+		fmt.Println("Service Update Error")
+		return serviceCallError
 	}
+	return c.JSON(http.StatusOK, true)
+}
 
-	for true {
-		if len(colList) == numCols*numRows {
-			break
-		}
-		currentStr := colList[len(colList)-1]
-		if rune(currentStr[pivot]) == 'Z' {
-			currentStr = handleEndCase(currentStr)
-			colList = append(colList, currentStr)
-			pivot = len(currentStr) - 1
-			// fixed = len(currentStr) - 2
-			continue
-		}
-		colList = append(colList, currentStr[:pivot]+string(rune(currentStr[pivot])+1))
-		currentStr = currentStr[:pivot] + string(rune(currentStr[pivot])+1)
-	}
-	fmt.Println(colList)
+//Update the user details
+func UpdateCandidateRecordService(c echo.Context) error {
 
-	finalRes := []string{}
-	for i := 0; i < len(colList); i++ {
-		fmt.Println(i, i+numCols)
-		finalRes = append(finalRes, strings.Join(colList[i:i+numCols], " "))
-		i += numCols - 1
+	EmployeeProfile := model.EmployeeProfile{}
+	bindError := validation.BindAndValidate(c, &EmployeeProfile)
+	if bindError != nil {
+		fmt.Println("BIND ERROR")
+		return bindError
 	}
-	// fmt.Println(strings.Join(finalRes, ","))
+	loginId := EmployeeProfile.LoginId
 
-	return finalRes
+	_, serviceCallError := UpdateService(auditContext(c), EmployeeProfile, loginId)
+	if serviceCallError != nil {
+		fmt.Println("Service Update Error")
+		return serviceCallError
+	}
+	return c.JSON(http.StatusOK, true)
 }
 
-//Handle the End case
-//AA ZZ
-//AAAAA
-func handleEndCase(cs string) string {
-	pre := ""
-	zCount := 0
-	for i := len(cs) - 1; i >= 0; {
-		if cs[i] == 'Z' {
-			zCount++
-			i--
-			continue
-		}
-		pre = cs[:i] + string(rune(cs[i])+1)
-		i--
-		break
-	}
-	for i := 0; i < zCount; i++ {
-		pre = pre + "A"
+//Create a new employee profile
+func CreateEmployeeService(c echo.Context) error {
+	employeeProfile := model.EmployeeProfile{}
+	bindError := validation.BindAndValidate(c, &employeeProfile)
+	if bindError != nil {
+		fmt.Println("BIND ERROR")
+		return bindError
 	}
-	if zCount == len(cs) {
-		pre = pre + "A"
+
+	serviceCallError := createEmployee(auditContext(c), employeeProfile)
+	if serviceCallError != nil {
+		fmt.Println("Service Create Error")
+		return serviceCallError
 	}
-	return pre
+	return c.JSON(http.StatusCreated, employeeProfile)
 }
 
-//To get the word count
-func GetWordCountService(c echo.Context) error {
+//Get the employee profile of the input login Id
+func GetEmployeeService(c echo.Context) error {
+	loginId := c.Param("loginId")
 
-	body, _ := GetRequestBodyJson(c)
-	url := body.Get("url").String()
-	resp, err := http.Get(url)
-	// handle the error if there is one
-	if err != nil {
-		panic(err)
-	}
-	defer func() {
-		if r := recover(); r != nil {
-			fmt.Println("Recovered in f GetWordCountService", r)
-		}
-	}()
-	// do this now so it won't be forgotten
-	defer resp.Body.Close()
-	// reads html as a slice of bytes
-	html, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		panic(err)
+	employeeProfile, serviceCallError := getEmployee(loginId)
+	if serviceCallError != nil {
+		fmt.Println("Service Get Error")
+		return serviceCallError
 	}
-	defer func() {
-		if r := recover(); r != nil {
-			fmt.Println("Error While Reading data from URL GetWordCountService", r)
-		}
-	}()
-
-	r := regexp.MustCompile(RegExp)
-	stripped := strip.StripTags(string(html))
-	stripped = r.ReplaceAllString(stripped, "")
-	ss := regexp.MustCompile(secondRegExp)
-	stripped = ss.ReplaceAllString(stripped, " ")
-	totalCount := 0
-	list := []interface{}{}
-
-	for index, element := range wordCount(stripped) {
-		totalCount++
-		ldDetails, _ := sjson.Set("{}", "word", index)
-		ldDetails, _ = sjson.Set(ldDetails, "count", element)
-		ldData := gjson.Parse(ldDetails)
-		list = append(list, ldData.Value())
-
-		// fmt.Println(index, "=>", element)
-	}
-	// fmt.Println(":::::::::::::::::::::::", list)
-	return c.JSON(http.StatusOK, list)
+	return c.JSON(http.StatusOK, employeeProfile)
 }
 
-//To get the prime number list
-func GetPrimeNumberListService(c echo.Context) error {
-	primeNumberList = []int{}
-	body, _ := GetRequestBodyJson(c)
-	number := body.Get("number").Int()
-	for i := 0; i <= int(number); i++ {
-		wg.Add(1)
-		go CheckPrime(i)
-		wg.Wait()
-	}
-	return c.JSON(http.StatusOK, primeNumberList)
-}
+//Update only the provided fields of the input login Id
+func PatchEmployeeService(c echo.Context) error {
+	loginId := c.Param("loginId")
 
-//to delete the input login Id details PERMENTLY
-func DeleteRecordService(c echo.Context) error {
-	body, _ := GetRequestBodyJson(c)
-	loginId := body.Get("loginId").String()
+	employeeProfilePatch := model.EmployeeProfilePatch{}
+	bindError := validation.BindAndValidate(c, &employeeProfilePatch)
+	if bindError != nil {
+		fmt.Println("BIND ERROR")
+		return bindError
+	}
 
-	_, serviceCallError := DeleteRecordDAO(loginId)
+	employeeProfile, serviceCallError := patchEmployee(auditContext(c), loginId, employeeProfilePatch)
 	if serviceCallError != nil {
-		fmt.Println("Service Update Error")
-		return c.JSON(http.StatusInternalServerError, serviceCallError)
+		fmt.Println("Service Patch Error")
+		return serviceCallError
 	}
-	return c.JSON(http.StatusOK, true)
+	return c.JSON(http.StatusOK, employeeProfile)
 }
 
-//Update the user details
-func UpdateCandidateRecordService(c echo.Context) error {
+//Mark the input login Id as deleted, the record stays in the collection
+func SoftDeleteEmployeeService(c echo.Context) error {
+	loginId := c.Param("loginId")
 
-	EmployeeProfile := model.EmployeeProfile{}
-	bindError := c.Bind(&EmployeeProfile)
-	if bindError != nil {
-		fmt.Println("BIND ERROR")
-		return c.JSON(http.StatusInternalServerError, bindError)
+	serviceCallError := softDeleteEmployee(auditContext(c), loginId)
+	if serviceCallError != nil {
+		fmt.Println("Service Delete Error")
+		return serviceCallError
 	}
-	loginId := EmployeeProfile.LoginId
+	return c.NoContent(http.StatusNoContent)
+}
+
+//Remove the input login Id PERMENTLY, deleted or not
+func PurgeEmployeeService(c echo.Context) error {
+	loginId := c.Param("loginId")
 
-	_, serviceCallError := UpdateService(EmployeeProfile, loginId)
+	serviceCallError := purgeEmployee(auditContext(c), loginId)
 	if serviceCallError != nil {
-		fmt.Println("Service Update Error")
-		return c.JSON(http.StatusInternalServerError, serviceCallError)
+		fmt.Println("Service Purge Error")
+		return serviceCallError
 	}
-	return c.JSON(http.StatusOK, true)
+	return c.NoContent(http.StatusNoContent)
 }
+
 func GetAllRecordsService(c echo.Context) error {
 
-	EmployeeProfileList := gjson.Result{}
+	listQuery, parseError := parseEmployeeListQuery(c.QueryParams())
+	if parseError != nil {
+		return apperrors.Validation(parseError.Error(), nil)
+	}
 
-	EmployeeProfileList, serviceCallError := GetAllRecordListService()
+	EmployeeProfileList, serviceCallError := GetAllRecordListService(listQuery)
 	if serviceCallError != nil {
 		fmt.Println("Service Update Error")
-		return c.JSON(http.StatusInternalServerError, serviceCallError)
+		return serviceCallError
 	}
-	return c.JSON(http.StatusOK, EmployeeProfileList.Value())
+	return c.JSON(http.StatusOK, EmployeeProfileList)
 }
 
-// This method get all  record  mapping List by calling DAO method.
-func GetAllRecordListService() (gjson.Result, error) {
-	return GetAllRecordListDAO()
+// This method get one page of record mapping List by calling DAO method.
+func GetAllRecordListService(listQuery employeeListQuery) (employeeListPage, error) {
+	return GetAllRecordListDAO(listQuery)
 }
 
-//This Method Get all  recordList, Retrives data from MongoDB.
-func GetAllRecordListDAO() (gjson.Result, error) {
+//This Method Get one page of recordList with the total count, Retrives data from MongoDB.
+func GetAllRecordListDAO(listQuery employeeListQuery) (employeeListPage, error) {
+	page := employeeListPage{Limit: listQuery.Limit, Offset: listQuery.Offset}
 
-	// db, ctx, err := dbhelper.GetMongoDB("dbIP", "DB_PORT", "DBNAME", "USENAME", "PASS", true)
-	fmt.Println("ssss", confighelper.GetConfig("DBNAME"))
-	db, ctx, err := dbhelper.GetMongoDB(confighelper.GetConfig("DBIP"), confighelper.GetConfig("PORT"), confighelper.GetConfig("DBNAME"), "", "", false)
+	db, ctx, cancel, err := dbhelper.GetConfiguredMongoDB()
+	defer cancel()
 	if err != nil {
 		fmt.Println("Log DB COnnection Error")
 		log.Print("Error While Connecting To MongoDB::", err)
-		return gjson.Result{}, err
+		return page, apperrors.Upstream("Error While Connecting To MongoDB", err)
 	}
+	employeeCollection := db.Collection(collection.EMPLOYEE_PROFILE)
 
-	selector := bson.M{"isDeleted": false}
-
-	cursor, err := db.Collection(collection.EMPLOYEE_PROFILE).Find(ctx, selector)
+	page.Total, err = mongohelper.Count(employeeCollection, ctx, listQuery.Filter)
 	if err != nil {
-		log.Fatal(err)
-	}
-	var records []bson.M
-	if err = cursor.All(ctx, &records); err != nil {
-		log.Fatal(err)
+		log.Print("Error While Counting Records::", err)
+		return page, apperrors.Upstream("Error While Counting Records", err)
 	}
 
-	err = cursor.Decode(&records)
+	selector, err := listQuery.findFilter()
 	if err != nil {
-		log.Print(err)
-
+		return page, apperrors.Validation(err.Error(), nil)
+	}
+	// one extra record tells whether a next page exists
+	opts := options.Find().SetSort(listQuery.sortDoc()).SetLimit(listQuery.Limit + 1)
+	if listQuery.After == nil {
+		opts.SetSkip(listQuery.Offset)
 	}
-	bs, err := json.Marshal(records)
+	cursor, err := employeeCollection.Find(ctx, selector, opts)
 	if err != nil {
-		log.Print(err)
+		log.Print("Error While Fetching Records::", err)
+		return page, apperrors.Upstream("Error While Fetching Records", err)
+	}
+	records := []bson.M{}
+	if err = cursor.All(ctx, &records); err != nil {
+		log.Print("Error While Decoding Records::", err)
+		return page, apperrors.Upstream("Error While Decoding Records", err)
+	}
 
-		// continue
+	if int64(len(records)) > listQuery.Limit {
+		records = records[:listQuery.Limit]
+		page.NextPageToken, err = listQuery.nextPageToken(records[len(records)-1])
+		if err != nil {
+			log.Print("Error While Creating Page Token::", err)
+			return page, apperrors.Internal(err)
+		}
 	}
-	return gjson.ParseBytes(bs), nil
+	page.Records = records
+	return page, nil
 }
 
 // This method delete personal information by calling DAO method.
-func DeleteRecordDAO(loginId string) (bool, error) {
+func DeleteRecordDAO(requestCtx context.Context, loginId string) (bool, error) {
 
-	flag, updateServiceError := DeleteDAO(loginId)
+	flag, updateServiceError := DeleteDAO(requestCtx, loginId)
 	if updateServiceError != nil {
 		fmt.Println(" UpdateService Error")
 		return false, updateServiceError
@@ -314,9 +353,9 @@ func DeleteRecordDAO(loginId string) (bool, error) {
 }
 
 // This method update personal information by calling DAO method.
-func UpdateService(employeeProfileObj model.EmployeeProfile, loginId string) (bool, error) {
+func UpdateService(requestCtx context.Context, employeeProfileObj model.EmployeeProfile, loginId string) (bool, error) {
 
-	flag, updateServiceError := UpdateDAO(employeeProfileObj, loginId)
+	flag, updateServiceError := UpdateDAO(requestCtx, employeeProfileObj, loginId)
 	if updateServiceError != nil {
 		fmt.Println(" UpdateService Error")
 		return false, updateServiceError
@@ -324,84 +363,241 @@ func UpdateService(employeeProfileObj model.EmployeeProfile, loginId string) (bo
 	return flag, nil
 }
 
-// This Method Delete personal information, Update data in MongoDB.
-func DeleteDAO(loginId string) (bool, error) {
-	db, ctx, err := dbhelper.GetMongoDB(confighelper.GetConfig("DBIP"), confighelper.GetConfig("PORT"), "sampleTestDatabase", "", "", false)
+// This Method Delete personal information, Update data in MongoDB. The removal is audited with the requestCtx actor.
+func DeleteDAO(requestCtx context.Context, loginId string) (bool, error) {
+	db, ctx, cancel, err := dbhelper.GetConfiguredMongoDB()
+	defer cancel()
 	if err != nil {
 		fmt.Println("Log DB COnnection Error")
 		log.Print("Error While Connecting To MongoDB::", err)
-		return false, err
+		return false, apperrors.Upstream("Error While Connecting To MongoDB", err)
 	}
 	selector := bson.M{"loginId": loginId}
-	_, err = db.Collection(collection.EMPLOYEE_PROFILE).DeleteOne(ctx, selector)
+	before := model.EmployeeProfile{}
+	err = db.Collection(collection.EMPLOYEE_PROFILE).FindOneAndDelete(ctx, selector).Decode(&before)
+	if err == mongo.ErrNoDocuments {
+		return true, nil
+	}
 	if err != nil {
-		log.Fatal("Error While Deleting Record", err)
+		log.Print("Error While Deleting Record::", err)
+		return false, apperrors.Upstream("Error While Deleting Record", err)
 	}
+	recordEmployeeAudit(requestCtx, audit.Delete, loginId, before, nil)
 	return true, nil
 }
 
-// This Method update personal information, Update data in MongoDB.
-func UpdateDAO(templateModelObj model.EmployeeProfile, loginId string) (bool, error) {
-	// db, ctx, err := dbhelper.GetMongoDB("dbIP", "DB_PORT", "DBNAME", "USENAME", "PASS", true)
-	db, ctx, err := dbhelper.GetMongoDB(confighelper.GetConfig("DBIP"), confighelper.GetConfig("PORT"), "sampleTestDatabase", "", "", false)
+// This Method update personal information, Update data in MongoDB. The change is audited with the requestCtx actor.
+func UpdateDAO(requestCtx context.Context, templateModelObj model.EmployeeProfile, loginId string) (bool, error) {
+	db, ctx, cancel, err := dbhelper.GetConfiguredMongoDB()
+	defer cancel()
 	if err != nil {
 		fmt.Println("Log DB COnnection Error")
 		log.Print("Error While Connecting To MongoDB::", err)
-		return false, err
+		return false, apperrors.Upstream("Error While Connecting To MongoDB", err)
 	}
 
-	opts := options.Update().SetUpsert(true)
+	// the record before the update is returned, there is none when it is inserted
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.Before)
 	selector := bson.M{"loginId": loginId}
 	updator := bson.M{"$set": bson.M{
 		"fullName":  templateModelObj.FullName,
 		"isEnabled": templateModelObj.IsEnabled,
 		"isDeleted": templateModelObj.IsDeleted}}
-	result, err := db.Collection(collection.EMPLOYEE_PROFILE).UpdateOne(ctx, selector, updator, opts)
-	if err != nil {
-		log.Fatal(err)
+	before := model.EmployeeProfile{}
+	err = db.Collection(collection.EMPLOYEE_PROFILE).FindOneAndUpdate(ctx, selector, updator, opts).Decode(&before)
+	inserted := err == mongo.ErrNoDocuments
+	if err != nil && !inserted {
+		log.Print("Error While Updating Record::", err)
+		return false, apperrors.Upstream("Error While Updating Record", err)
 	}
 
-	if result.MatchedCount != 0 {
+	after := before
+	after.LoginId = loginId
+	after.FullName = templateModelObj.FullName
+	after.IsEnabled = templateModelObj.IsEnabled
+	after.IsDeleted = templateModelObj.IsDeleted
+	if !inserted {
 		fmt.Println("matched and replaced an existing document")
+		recordEmployeeAudit(requestCtx, audit.Update, loginId, before, after)
 		return false, nil
 	}
-	if result.UpsertedCount != 0 {
-		fmt.Printf("inserted a new document with ID %v\n", result.UpsertedID)
-	}
+	fmt.Println("inserted a new document with login Id", loginId)
+	recordEmployeeAudit(requestCtx, audit.Upsert, loginId, nil, after)
 	return true, nil
 }
-func CheckPrime(number int) {
-	isPrime := true
-	if number == 0 || number == 1 {
-		wg.Done()
-		// fmt.Printf(" %d is not a  prime number\n", number)
-	} else {
-		for i := 2; i <= number/2; i++ {
-			if number%i == 0 {
-				wg.Done()
-				// fmt.Printf(" %d is not a  prime number\n", number)
-				isPrime = false
-				break
-			}
-		}
-		if isPrime == true {
-			// fmt.Printf("%d\t", number)
-			primeNumberList = append(primeNumberList, number)
-			wg.Done()
-		}
+
+// This Method insert a new employee profile, a soft deleted profile with the same login Id is replaced.
+// The creation is audited with the requestCtx actor.
+func CreateEmployeeDAO(requestCtx context.Context, employeeProfileObj model.EmployeeProfile) error {
+	db, ctx, cancel, err := dbhelper.GetConfiguredMongoDB()
+	defer cancel()
+	if err != nil {
+		fmt.Println("Log DB COnnection Error")
+		log.Print("Error While Connecting To MongoDB::", err)
+		return apperrors.Upstream("Error While Connecting To MongoDB", err)
 	}
+	if err := ensureEmployeeIndex(ctx, db); err != nil {
+		log.Print("Error While Creating Index::", err)
+		return apperrors.Upstream("Error While Creating Index", err)
+	}
+
+	// only a soft deleted profile matches, when a live one exists the upsert inserts a second
+	// loginId and the unique index rejects it, so two concurrent creates can not both succeed
+	employeeProfileObj.IsDeleted = false
+	opts := options.FindOneAndReplace().SetUpsert(true).SetReturnDocument(options.Before)
+	selector := bson.M{"loginId": employeeProfileObj.LoginId, "isDeleted": true}
+	replaced := model.EmployeeProfile{}
+	err = db.Collection(collection.EMPLOYEE_PROFILE).FindOneAndReplace(ctx, selector, employeeProfileObj, opts).Decode(&replaced)
+	if mongo.IsDuplicateKeyError(err) {
+		return apperrors.Conflict("record already exists")
+	}
+	if err != nil && err != mongo.ErrNoDocuments {
+		log.Print("Error While Creating Record::", err)
+		return apperrors.Upstream("Error While Creating Record", err)
+	}
+
+	var before interface{}
+	if err == nil {
+		before = replaced
+	}
+	recordEmployeeAudit(requestCtx, audit.Create, employeeProfileObj.LoginId, before, employeeProfileObj)
+	return nil
 }
 
-func wordCount(str string) map[string]int {
-	wordList := strings.Fields(str)
-	counts := make(map[string]int)
-	for _, word := range wordList {
-		_, ok := counts[word]
-		if ok {
-			counts[word]++
-		} else {
-			counts[word] = 1
-		}
+// ensureEmployeeIndex creates the unique loginId index of the employee profiles once per database,
+// it fails while the collection holds the same loginId twice
+func ensureEmployeeIndex(ctx context.Context, db *mongo.Database) error {
+	employeeIndexMutex.Lock()
+	defer employeeIndexMutex.Unlock()
+	if employeeIndexed[db.Name()] {
+		return nil
+	}
+	_, err := db.Collection(collection.EMPLOYEE_PROFILE).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.M{"loginId": 1},
+		Options: options.Index().SetName(employeeLoginIdIndex).SetUnique(true),
+	})
+	if err != nil {
+		return err
+	}
+	employeeIndexed[db.Name()] = true
+	return nil
+}
+
+// This Method get a not deleted employee profile by login Id.
+func GetEmployeeDAO(loginId string) (model.EmployeeProfile, error) {
+	employeeProfile := model.EmployeeProfile{}
+	db, ctx, cancel, err := dbhelper.GetConfiguredMongoDB()
+	defer cancel()
+	if err != nil {
+		fmt.Println("Log DB COnnection Error")
+		log.Print("Error While Connecting To MongoDB::", err)
+		return employeeProfile, apperrors.Upstream("Error While Connecting To MongoDB", err)
+	}
+
+	selector := bson.M{"loginId": loginId, "isDeleted": false}
+	err = db.Collection(collection.EMPLOYEE_PROFILE).FindOne(ctx, selector).Decode(&employeeProfile)
+	if err == mongo.ErrNoDocuments {
+		return employeeProfile, apperrors.NotFound("record not found")
+	}
+	if err != nil {
+		log.Print("Error While Fetching Record::", err)
+		return employeeProfile, apperrors.Upstream("Error While Fetching Record", err)
+	}
+	return employeeProfile, nil
+}
+
+// This Method update the provided fields of a not deleted employee profile and return the updated profile.
+// The change is audited with the requestCtx actor.
+func PatchEmployeeDAO(requestCtx context.Context, loginId string, employeeProfilePatch model.EmployeeProfilePatch) (model.EmployeeProfile, error) {
+	employeeProfile := model.EmployeeProfile{}
+	db, ctx, cancel, err := dbhelper.GetConfiguredMongoDB()
+	defer cancel()
+	if err != nil {
+		fmt.Println("Log DB COnnection Error")
+		log.Print("Error While Connecting To MongoDB::", err)
+		return employeeProfile, apperrors.Upstream("Error While Connecting To MongoDB", err)
+	}
+
+	setFields := bson.M{}
+	if employeeProfilePatch.FullName != nil {
+		setFields["fullName"] = *employeeProfilePatch.FullName
+	}
+	if employeeProfilePatch.IsEnabled != nil {
+		setFields["isEnabled"] = *employeeProfilePatch.IsEnabled
+	}
+	if len(setFields) == 0 {
+		return GetEmployeeDAO(loginId)
+	}
+
+	// the record before the update is returned for the audit, the patch is applied to it for the response
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.Before)
+	selector := bson.M{"loginId": loginId, "isDeleted": false}
+	updator := bson.M{"$set": setFields}
+	before := model.EmployeeProfile{}
+	err = db.Collection(collection.EMPLOYEE_PROFILE).FindOneAndUpdate(ctx, selector, updator, opts).Decode(&before)
+	if err == mongo.ErrNoDocuments {
+		return employeeProfile, apperrors.NotFound("record not found")
+	}
+	if err != nil {
+		log.Print("Error While Updating Record::", err)
+		return employeeProfile, apperrors.Upstream("Error While Updating Record", err)
+	}
+
+	employeeProfile = before
+	if employeeProfilePatch.FullName != nil {
+		employeeProfile.FullName = *employeeProfilePatch.FullName
+	}
+	if employeeProfilePatch.IsEnabled != nil {
+		employeeProfile.IsEnabled = *employeeProfilePatch.IsEnabled
+	}
+	recordEmployeeAudit(requestCtx, audit.Update, loginId, before, employeeProfile)
+	return employeeProfile, nil
+}
+
+// This Method set isDeleted on a not deleted employee profile. The removal is audited with the requestCtx actor.
+func SoftDeleteEmployeeDAO(requestCtx context.Context, loginId string) error {
+	db, ctx, cancel, err := dbhelper.GetConfiguredMongoDB()
+	defer cancel()
+	if err != nil {
+		fmt.Println("Log DB COnnection Error")
+		log.Print("Error While Connecting To MongoDB::", err)
+		return apperrors.Upstream("Error While Connecting To MongoDB", err)
+	}
+
+	selector := bson.M{"loginId": loginId, "isDeleted": false}
+	updator := bson.M{"$set": bson.M{"isDeleted": true}}
+	result, err := db.Collection(collection.EMPLOYEE_PROFILE).UpdateOne(ctx, selector, updator)
+	if err != nil {
+		log.Print("Error While Deleting Record::", err)
+		return apperrors.Upstream("Error While Deleting Record", err)
+	}
+	if result.MatchedCount == 0 {
+		return apperrors.NotFound("record not found")
+	}
+	recordEmployeeAudit(requestCtx, audit.Delete, loginId, bson.M{"isDeleted": false}, bson.M{"isDeleted": true})
+	return nil
+}
+
+// This Method remove the employee profile from MongoDB. The removal is audited with the requestCtx actor.
+func PurgeEmployeeDAO(requestCtx context.Context, loginId string) error {
+	db, ctx, cancel, err := dbhelper.GetConfiguredMongoDB()
+	defer cancel()
+	if err != nil {
+		fmt.Println("Log DB COnnection Error")
+		log.Print("Error While Connecting To MongoDB::", err)
+		return apperrors.Upstream("Error While Connecting To MongoDB", err)
+	}
+
+	selector := bson.M{"loginId": loginId}
+	before := model.EmployeeProfile{}
+	err = db.Collection(collection.EMPLOYEE_PROFILE).FindOneAndDelete(ctx, selector).Decode(&before)
+	if err == mongo.ErrNoDocuments {
+		return apperrors.NotFound("record not found")
+	}
+	if err != nil {
+		log.Print("Error While Purging Record::", err)
+		return apperrors.Upstream("Error While Purging Record", err)
 	}
-	return counts
+	recordEmployeeAudit(requestCtx, audit.Delete, loginId, before, nil)
+	return nil
 }
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"TestProject/Server/GolangServer/confighelper"
+	"digi-model-engine/middlewares"
+	"digi-model-engine/models"
+	redisclient "digi-model-engine/redis"
+	"digi-model-engine/utils/exceptions"
+	"digi-model-engine/validators"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// post-request.go posts to this address
+	metricServiceAddr = ":8080"
+
+	maxMetricsPerRequest = 1000
+	metricWriteTimeout   = 10 * time.Second
+
+	// the Bloom filter is reserved like in bloomInsertDB.go when it does not exist
+	bloomErrorRate = 0.001
+	bloomCapacity  = 1000000
+)
+
+// the status of one metric of a request
+const (
+	MetricInserted  = "inserted"
+	MetricDuplicate = "duplicate"
+	MetricInvalid   = "invalid"
+)
+
+// MetricData is one metric of the request body, the body is one metric or an array of them
+type MetricData struct {
+	MetricId        string   `json:"metricId" binding:"required,max=256"`
+	EntityId        string   `json:"entityId" binding:"required,max=256"`
+	MetricValue     *float64 `json:"metricValue" binding:"required"`
+	MetricTimestamp string   `json:"metricTimestamp" binding:"required,datetime=2006-01-02T15:04:05Z07:00"`
+}
+
+// MetricResult is the outcome of one metric, Index is its position in the request
+type MetricResult struct {
+	Index  int               `json:"index"`
+	Key    string            `json:"key,omitempty"`
+	Status string            `json:"status"`
+	Errors map[string]string `json:"errors,omitempty"`
+}
+
+// metricBatch is the request body, a single metric is read as a batch of one
+type metricBatch []json.RawMessage
+
+func (b *metricBatch) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if string(data) == "null" {
+		return nil
+	}
+	if len(data) > 0 && data[0] == '[' {
+		return json.Unmarshal(data, (*[]json.RawMessage)(b))
+	}
+	*b = metricBatch{append(json.RawMessage(nil), data...)}
+	return nil
+}
+
+type metricService struct {
+	client *redisclient.Client
+	queue  *redisclient.RecordQueue
+}
+
+func newMetricService(client *redisclient.Client) *metricService {
+	return &metricService{client: client, queue: redisclient.NewRecordQueue(client)}
+}
+
+func newMetricRouter(service *metricService) *gin.Engine {
+	router := gin.New()
+	router.Use(gin.Logger(), middlewares.ExceptionHandler())
+	router.POST("/api/insert-metric-data-redis-db", service.InsertMetricData)
+	return router
+}
+
+// InsertMetricData writes every valid metric of the body which is not known yet and returns the result of each.
+// A malformed body fails the request, an invalid metric only fails itself.
+func (s *metricService) InsertMetricData(c *gin.Context) {
+	batch := metricBatch{}
+	validators.ValidateRequest(c, &batch)
+	if len(batch) == 0 || len(batch) > maxMetricsPerRequest {
+		exceptions.BadRequest(map[string]string{"body": "between 1 and " + strconv.Itoa(maxMetricsPerRequest) + " metrics are required"})
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), metricWriteTimeout)
+	defer cancel()
+
+	// the metrics written before a Redis error are duplicates when the client sends the request again
+	results := make([]MetricResult, len(batch))
+	counts := map[string]int{}
+	for i, raw := range batch {
+		result, err := s.insertMetric(ctx, i, raw)
+		if err != nil {
+			exceptions.InternalServerError(err)
+		}
+		results[i] = result
+		counts[result.Status]++
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Success:      true,
+		Message:      "success",
+		ResponseCode: http.StatusOK,
+		Data: gin.H{
+			"results":       results,
+			MetricInserted:  counts[MetricInserted],
+			MetricDuplicate: counts[MetricDuplicate],
+			MetricInvalid:   counts[MetricInvalid],
+		},
+	})
+}
+
+// insertMetric validates and writes one metric, the error is a Redis error
+func (s *metricService) insertMetric(ctx context.Context, index int, raw json.RawMessage) (MetricResult, error) {
+	result := MetricResult{Index: index}
+	metric := MetricData{}
+	if err := json.Unmarshal(raw, &metric); err != nil {
+		result.Status, result.Errors = MetricInvalid, map[string]string{"body": "Request data format is not supported"}
+		return result, nil
+	}
+	if validationErrors := validators.ValidateModel(&metric); validationErrors != nil {
+		result.Status, result.Errors = MetricInvalid, validationErrors
+		return result, nil
+	}
+	key, record, err := metric.record()
+	if err != nil {
+		result.Status, result.Errors = MetricInvalid, map[string]string{"body": err.Error()}
+		return result, nil
+	}
+	result.Key = key
+
+	// a key missing from the filter is new for sure. A hit may be a false positive, so it is a duplicate
+	// once Redis holds the record, which costs one EXISTS and writes nothing.
+	filter := confighelper.Get().BloomFilterName
+	seen, err := s.client.BloomExists(ctx, filter, key)
+	if err != nil {
+		return result, err
+	}
+	if seen {
+		exists, err := s.client.Exists(ctx, key)
+		if err != nil {
+			return result, err
+		}
+		if exists {
+			result.Status = MetricDuplicate
+			return result, nil
+		}
+	}
+	created, err := s.queue.CreateFrom(ctx, key, record)
+	if err != nil {
+		return result, err
+	}
+	// added once the record is written, so a failed write is not taken as a duplicate when it is sent again
+	if !seen {
+		if _, err := s.client.BloomAdd(ctx, filter, key); err != nil {
+			return result, err
+		}
+	}
+	if created {
+		result.Status = MetricInserted
+	} else {
+		result.Status = MetricDuplicate
+	}
+	return result, nil
+}
+
+// record returns the key and the hash of a validated metric. The timestamp is hashed in UTC,
+// so the same instant sent with another offset is the same metric.
+func (metric MetricData) record() (string, redisclient.MetricRecord, error) {
+	timestamp, err := time.Parse(time.RFC3339, metric.MetricTimestamp)
+	if err != nil {
+		return "", redisclient.MetricRecord{}, err
+	}
+	timestamp = timestamp.UTC()
+	hash, err := hashMetricsData(metric.EntityId, metric.MetricId, timestamp.Format(time.RFC3339Nano), *metric.MetricValue)
+	if err != nil {
+		return "", redisclient.MetricRecord{}, err
+	}
+	return redisclient.MetricKeyPrefix + hash, redisclient.MetricRecord{
+		MetricID:        metric.MetricId,
+		EntityID:        metric.EntityId,
+		MetricValue:     *metric.MetricValue,
+		MetricTimestamp: timestamp,
+		CreatedAt:       time.Now(),
+	}, nil
+}
+
+func main() {
+	// REDIS_ADDR, REDIS_PASS and BLOOM_FILTER_NAME come from the config
+	if _, err := confighelper.Load(os.Args[1:]); err != nil {
+		log.Fatalf("Failed to load the config: %v", err)
+	}
+	if err := redisclient.InitRedisDB(); err != nil {
+		log.Fatalf("Failed to initialize Redis client: %v", err)
+	}
+	defer redisclient.WatchConfig()()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	err := redisclient.Default.BloomReserve(ctx, confighelper.Get().BloomFilterName, bloomErrorRate, bloomCapacity)
+	cancel()
+	if err != nil {
+		log.Fatalf("Failed to reserve Bloom filter: %v", err)
+	}
+
+	router := newMetricRouter(newMetricService(redisclient.Default))
+	if err := router.Run(metricServiceAddr); err != nil {
+		log.Fatalf("Failed to start server: %v", err)
+	}
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	redisclient "digi-model-engine/redis"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/alicebob/miniredis/v2/server"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+)
+
+// the service on a Redis which can not be reached, only the metrics which are written need it
+func unreachableMetricRouter(t *testing.T) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	rdb := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1, DialTimeout: time.Second})
+	t.Cleanup(func() { rdb.Close() })
+	return newMetricRouter(newMetricService(redisclient.NewClient(rdb)))
+}
+
+func postMetrics(router *gin.Engine, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/api/insert-metric-data-redis-db", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestInsertMetricDataRejectsBody(t *testing.T) {
+	router := unreachableMetricRouter(t)
+	for _, body := range []string{`{`, `[]`, `null`, ``} {
+		if rec := postMetrics(router, body); rec.Code != http.StatusBadRequest {
+			t.Errorf("body %q gives %d, want 400", body, rec.Code)
+		}
+	}
+}
+
+func TestInsertMetricDataInvalidItems(t *testing.T) {
+	router := unreachableMetricRouter(t)
+	rec := postMetrics(router, `[
+		{"entityId": "e1", "metricValue": 1, "metricTimestamp": "2023-01-01T12:00:00Z"},
+		{"metricId": "m1", "entityId": "e1", "metricValue": 1, "metricTimestamp": "2023-01-01 12:00:00"},
+		{"metricId": "m1", "entityId": "e1", "metricTimestamp": "2023-01-01T12:00:00Z"},
+		{"metricId": "m1", "entityId": "e1", "metricValue": "high", "metricTimestamp": "2023-01-01T12:00:00Z"},
+		null
+	]`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body)
+	}
+	resp := struct {
+		Data struct {
+			Results []MetricResult `json:"results"`
+			Invalid int            `json:"invalid"`
+		} `json:"data"`
+	}{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Data.Invalid != 5 || len(resp.Data.Results) != 5 {
+		t.Fatalf("data = %+v, want 5 invalid results", resp.Data)
+	}
+	for i, field := range []string{"metricId", "metricTimestamp", "metricValue", "body", "metricId"} {
+		result := resp.Data.Results[i]
+		if result.Index != i || result.Status != MetricInvalid || result.Errors[field] == "" {
+			t.Errorf("result %d = %+v, want invalid on %s", i, result, field)
+		}
+	}
+}
+
+func TestInsertMetricDataRedisError(t *testing.T) {
+	router := unreachableMetricRouter(t)
+	rec := postMetrics(router, `{"metricId": "m1", "entityId": "e1", "metricValue": 0, "metricTimestamp": "2023-01-01T12:00:00Z"}`)
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want 500: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestMetricRecordKey(t *testing.T) {
+	value := 3.14
+	metric := MetricData{MetricId: "m1", EntityId: "e1", MetricValue: &value, MetricTimestamp: "2023-01-01T12:00:00Z"}
+	key, record, err := metric.record()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the key format of redisClientMetric.go, a change needs a migration of the stored keys
+	if want := redisclient.MetricKeyPrefix + "50fe2ceb0dae803238aab88a7079811f343ccd47a5b8bd6acc6d9f49ec875db1"; key != want {
+		t.Errorf("key = %q, want %q", key, want)
+	}
+	if record.MetricID != "m1" || record.EntityID != "e1" || record.MetricValue != value || !record.MetricTimestamp.Equal(time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC)) {
+		t.Errorf("record = %+v", record)
+	}
+
+	// the same instant with another offset is the same metric
+	metric.MetricTimestamp = "2023-01-01T13:00:00+01:00"
+	if other, _, _ := metric.record(); other != key {
+		t.Errorf("key at +01:00 = %q, want %q", other, key)
+	}
+}
+
+func TestHashMetricsDataFieldBoundaries(t *testing.T) {
+	joined, _ := hashMetricsData("ab", "c")
+	split, _ := hashMetricsData("a", "bc")
+	if joined == split {
+		t.Error("the fields run together in the hash")
+	}
+}
+
+// commandLog records the name of every command sent by a client
+type commandLog []string
+
+func (l *commandLog) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	*l = append(*l, cmd.Name())
+	return ctx, nil
+}
+
+func (l *commandLog) AfterProcess(ctx context.Context, cmd redis.Cmder) error { return nil }
+
+func (l *commandLog) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	for _, cmd := range cmds {
+		*l = append(*l, cmd.Name())
+	}
+	return ctx, nil
+}
+
+func (l *commandLog) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error { return nil }
+
+// a metric found in the Bloom filter and in Redis is a duplicate without a write
+func TestInsertMetricDataDuplicateWritesNothing(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mr := miniredis.RunT(t)
+	filter := map[string]bool{}
+	mr.Server().Register("BF.EXISTS", func(c *server.Peer, cmd string, args []string) {
+		if filter[args[1]] {
+			c.WriteInt(1)
+		} else {
+			c.WriteInt(0)
+		}
+	})
+	mr.Server().Register("BF.ADD", func(c *server.Peer, cmd string, args []string) {
+		filter[args[1]] = true
+		c.WriteInt(1)
+	})
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+	commands := &commandLog{}
+	rdb.AddHook(commands)
+	router := newMetricRouter(newMetricService(redisclient.NewClient(rdb)))
+
+	body := `{"metricId": "m1", "entityId": "e1", "metricValue": 1, "metricTimestamp": "2023-01-01T12:00:00Z"}`
+	if rec := postMetrics(router, body); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), MetricInserted) {
+		t.Fatalf("first post = %d %s, want inserted", rec.Code, rec.Body)
+	}
+	*commands = nil
+	if rec := postMetrics(router, body); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"status":"`+MetricDuplicate) {
+		t.Fatalf("second post = %d %s, want a duplicate", rec.Code, rec.Body)
+	}
+	if strings.Join(*commands, " ") != "bf.exists exists" {
+		t.Errorf("commands of a duplicate = %v, want only the filter and the key checked", *commands)
+	}
+}
+
+// a Redis whose Bloom filter holds every key, only the records decide what is a duplicate
+func TestInsertMetricDataBloomFalsePositive(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mr := miniredis.RunT(t)
+	added := 0
+	mr.Server().Register("BF.EXISTS", func(c *server.Peer, cmd string, args []string) { c.WriteInt(1) })
+	mr.Server().Register("BF.ADD", func(c *server.Peer, cmd string, args []string) {
+		added++
+		c.WriteInt(1)
+	})
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+	router := newMetricRouter(newMetricService(redisclient.NewClient(rdb)))
+
+	body := `[
+		{"metricId": "m1", "entityId": "e1", "metricValue": 1, "metricTimestamp": "2023-01-01T12:00:00Z"},
+		{"metricId": "m1", "entityId": "e1", "metricValue": 1, "metricTimestamp": "2023-01-01T12:00:00Z"}
+	]`
+	rec := postMetrics(router, body)
+	resp := struct {
+		Data struct {
+			Results []MetricResult `json:"results"`
+		} `json:"data"`
+	}{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusOK || len(resp.Data.Results) != 2 ||
+		resp.Data.Results[0].Status != MetricInserted || resp.Data.Results[1].Status != MetricDuplicate {
+		t.Fatalf("response = %d %s, want the first metric inserted and the second a duplicate", rec.Code, rec.Body)
+	}
+	if !mr.Exists(resp.Data.Results[0].Key) || added != 0 {
+		t.Errorf("record written = %t, keys added to the filter = %d", mr.Exists(resp.Data.Results[0].Key), added)
+	}
+}
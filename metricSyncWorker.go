@@ -0,0 +1,488 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"TestProject/Server/GolangServer/confighelper"
+	"TestProject/Server/GolangServer/secrets"
+	"digi-model-engine/middlewares"
+	redisclient "digi-model-engine/redis"
+
+	"github.com/gin-gonic/gin"
+	_ "github.com/lib/pq"
+)
+
+const (
+	defaultSyncWorkers      = 4
+	defaultSyncBatchSize    = 100
+	defaultSyncPollInterval = time.Second
+	defaultSyncMaxBackoff   = 30 * time.Second
+	defaultSyncMetricsAddr  = ":9090"
+	defaultSyncTable        = "metrics"
+
+	// a row takes len(metricColumns) parameters and a statement at most 65535
+	maxSyncBatchSize = 10000
+)
+
+// the columns of the metrics table, hash_key is the Redis key and the primary key
+var metricColumns = []string{"hash_key", "metric_id", "entity_id", "metric_value", "metric_timestamp", "created_at"}
+
+var tableNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+
+// SyncConfig is read from the METRIC_SYNC_ environment variables, see SyncConfigFromEnv
+type SyncConfig struct {
+	Workers         int
+	BatchSize       int
+	PollInterval    time.Duration
+	MaxBackoff      time.Duration
+	Lease           time.Duration
+	MaxAttempts     int
+	RetryBackoff    time.Duration
+	BackfillPattern string
+	MetricsAddr     string
+	Table           string
+}
+
+// SyncConfigFromEnv reads METRIC_SYNC_WORKERS, METRIC_SYNC_BATCH_SIZE, METRIC_SYNC_POLL_INTERVAL, METRIC_SYNC_MAX_BACKOFF,
+// METRIC_SYNC_LEASE, METRIC_SYNC_MAX_ATTEMPTS, METRIC_SYNC_RETRY_BACKOFF, METRIC_SYNC_BACKFILL_PATTERN ("-" for no backfill),
+// METRIC_SYNC_METRICS_ADDR and METRIC_SYNC_TABLE, the unset ones keep their default
+func SyncConfigFromEnv() (SyncConfig, error) {
+	config := SyncConfig{
+		Workers:         defaultSyncWorkers,
+		BatchSize:       defaultSyncBatchSize,
+		PollInterval:    defaultSyncPollInterval,
+		MaxBackoff:      defaultSyncMaxBackoff,
+		Lease:           redisclient.DefaultLease,
+		MaxAttempts:     redisclient.DefaultMaxAttempts,
+		RetryBackoff:    redisclient.DefaultRetryBackoff,
+		BackfillPattern: redisclient.MetricKeyPrefix + "*",
+		MetricsAddr:     defaultSyncMetricsAddr,
+		Table:           defaultSyncTable,
+	}
+	for _, setting := range []struct {
+		name string
+		into *int
+		max  int
+	}{
+		{"METRIC_SYNC_WORKERS", &config.Workers, 1000},
+		{"METRIC_SYNC_BATCH_SIZE", &config.BatchSize, maxSyncBatchSize},
+		{"METRIC_SYNC_MAX_ATTEMPTS", &config.MaxAttempts, 1000},
+	} {
+		if value := os.Getenv(setting.name); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 || n > setting.max {
+				return config, fmt.Errorf("%s must be a number from 1 to %d", setting.name, setting.max)
+			}
+			*setting.into = n
+		}
+	}
+	for _, setting := range []struct {
+		name string
+		into *time.Duration
+	}{
+		{"METRIC_SYNC_POLL_INTERVAL", &config.PollInterval},
+		{"METRIC_SYNC_MAX_BACKOFF", &config.MaxBackoff},
+		{"METRIC_SYNC_LEASE", &config.Lease},
+		{"METRIC_SYNC_RETRY_BACKOFF", &config.RetryBackoff},
+	} {
+		if value := os.Getenv(setting.name); value != "" {
+			d, err := time.ParseDuration(value)
+			if err != nil || d <= 0 {
+				return config, fmt.Errorf("%s must be a positive duration such as 30s", setting.name)
+			}
+			*setting.into = d
+		}
+	}
+	if config.MaxBackoff < config.PollInterval {
+		return config, fmt.Errorf("METRIC_SYNC_MAX_BACKOFF must not be shorter than METRIC_SYNC_POLL_INTERVAL")
+	}
+	if pattern := os.Getenv("METRIC_SYNC_BACKFILL_PATTERN"); pattern == "-" {
+		config.BackfillPattern = ""
+	} else if pattern != "" {
+		config.BackfillPattern = pattern
+	}
+	if addr := os.Getenv("METRIC_SYNC_METRICS_ADDR"); addr != "" {
+		config.MetricsAddr = addr
+	}
+	if table := os.Getenv("METRIC_SYNC_TABLE"); table != "" {
+		config.Table = table
+	}
+	if !tableNamePattern.MatchString(config.Table) {
+		return config, fmt.Errorf("METRIC_SYNC_TABLE %q is not a table name", config.Table)
+	}
+	return config, nil
+}
+
+// syncMetrics are the counters served on /metrics
+type syncMetrics struct {
+	batches   int64
+	inserted  int64
+	skipped   int64
+	failed    int64
+	leaseLost int64
+	errors    int64
+	busy      int64
+}
+
+// write renders the metrics in the Prometheus text format, pending is left out when it could not be read
+func (m *syncMetrics) write(w io.Writer, workers int, pending int64, pendingErr error) {
+	metric := func(name, kind, help string, value int64) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %d\n", name, help, name, kind, name, value)
+	}
+	metric("metric_sync_batches_total", "counter", "Batches inserted into Postgres.", atomic.LoadInt64(&m.batches))
+	metric("metric_sync_records_inserted_total", "counter", "Records inserted into Postgres.", atomic.LoadInt64(&m.inserted))
+	metric("metric_sync_records_skipped_total", "counter", "Records which were in Postgres already.", atomic.LoadInt64(&m.skipped))
+	metric("metric_sync_records_failed_total", "counter", "Records which failed an attempt.", atomic.LoadInt64(&m.failed))
+	metric("metric_sync_lease_lost_total", "counter", "Records whose claim expired before they were marked inserted.", atomic.LoadInt64(&m.leaseLost))
+	metric("metric_sync_errors_total", "counter", "Batches which failed and made the worker back off.", atomic.LoadInt64(&m.errors))
+	metric("metric_sync_workers", "gauge", "Configured workers.", int64(workers))
+	metric("metric_sync_workers_busy", "gauge", "Workers inserting a batch.", atomic.LoadInt64(&m.busy))
+	if pendingErr == nil {
+		metric("metric_sync_pending_records", "gauge", "Records not inserted yet.", pending)
+	}
+}
+
+// syncRow is a claimed record and its hash
+type syncRow struct {
+	claim  redisclient.Claim
+	record redisclient.MetricRecord
+}
+
+// metricDB is the part of *sql.DB the worker inserts with
+type metricDB interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// syncWorker moves the pending metric records to Postgres. Every record is claimed before it is read, so a record is
+// inserted by one worker at a time. A worker which stops or dies before marking its batch inserted loses the claims
+// when they expire and the records are claimed again, the insert skips the ones which reached Postgres.
+type syncWorker struct {
+	config  SyncConfig
+	queue   *redisclient.RecordQueue
+	db      metricDB
+	owner   string
+	metrics *syncMetrics
+
+	// one worker at a time takes the due records, so the workers of a process do not race for the same ones
+	claimMutex sync.Mutex
+}
+
+func newSyncWorker(config SyncConfig, queue *redisclient.RecordQueue, db metricDB, owner string) *syncWorker {
+	return &syncWorker{config: config, queue: queue, db: db, owner: owner, metrics: &syncMetrics{}}
+}
+
+// Run starts the workers and returns once ctx is done and the batches in flight are finished
+func (w *syncWorker) Run(ctx context.Context) {
+	wg := sync.WaitGroup{}
+	for i := 0; i < w.config.Workers; i++ {
+		wg.Add(1)
+		go func(owner string) {
+			defer wg.Done()
+			w.loop(ctx, owner)
+		}(w.owner + "-" + strconv.Itoa(i))
+	}
+	wg.Wait()
+}
+
+func (w *syncWorker) loop(ctx context.Context, owner string) {
+	backoff := time.Duration(0)
+	for ctx.Err() == nil {
+		synced, err := w.syncBatch(owner)
+		wait := time.Duration(0)
+		switch {
+		case err != nil:
+			atomic.AddInt64(&w.metrics.errors, 1)
+			backoff = nextBackoff(backoff, w.config.PollInterval, w.config.MaxBackoff)
+			wait = backoff
+			log.Printf("Metric sync %s failed, retrying in %s: %v", owner, wait, err)
+		case synced == 0:
+			backoff = 0
+			wait = w.config.PollInterval
+		default:
+			backoff = 0
+		}
+		if wait == 0 {
+			continue
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+// nextBackoff doubles the last backoff, from min up to max
+func nextBackoff(last, min, max time.Duration) time.Duration {
+	if last < min {
+		return min
+	}
+	if last > max/2 {
+		return max
+	}
+	return last * 2
+}
+
+// syncBatch inserts one batch of due records and returns how many reached Postgres. It does not take the context
+// of Run, a stop waits for the batch, which is bounded by the lease of its claims.
+func (w *syncWorker) syncBatch(owner string) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), w.config.Lease)
+	defer cancel()
+
+	claims, claimErr := w.claimDue(ctx, owner)
+	if len(claims) == 0 {
+		return 0, claimErr
+	}
+	atomic.AddInt64(&w.metrics.busy, 1)
+	defer atomic.AddInt64(&w.metrics.busy, -1)
+
+	rows := make([]syncRow, 0, len(claims))
+	for _, claim := range claims {
+		row := syncRow{claim: claim}
+		found, err := w.queue.Client.HGetAllInto(ctx, claim.Key, &row.record)
+		if err == nil && !found {
+			err = fmt.Errorf("record %s is gone", claim.Key)
+		}
+		if err != nil {
+			// an unreadable record fails alone, it is FAILED for good after MaxAttempts
+			w.fail(ctx, claim, err)
+			continue
+		}
+		rows = append(rows, row)
+	}
+	if len(rows) == 0 {
+		return 0, claimErr
+	}
+
+	inserted, err := insertMetricRows(ctx, w.db, w.config.Table, rows)
+	if err != nil {
+		rows, inserted, err = w.insertEach(ctx, rows, err)
+		if len(rows) == 0 {
+			return 0, err
+		}
+	}
+	atomic.AddInt64(&w.metrics.batches, 1)
+	atomic.AddInt64(&w.metrics.inserted, int64(inserted))
+	atomic.AddInt64(&w.metrics.skipped, int64(len(rows)-inserted))
+
+	for _, row := range rows {
+		if err := w.queue.Complete(ctx, row.claim); err != nil {
+			if errors.Is(err, redisclient.ErrLeaseLost) {
+				// the record is in Postgres, whoever claims it next inserts nothing
+				atomic.AddInt64(&w.metrics.leaseLost, 1)
+				continue
+			}
+			// the claim expires and the record is claimed again, the same way
+			return len(rows), err
+		}
+	}
+	return len(rows), claimErr
+}
+
+// insertEach inserts the rows of a failed batch one by one, so a bad row only fails itself. It returns the rows
+// which were inserted and how many of them were not in the table already, batchErr when none was.
+func (w *syncWorker) insertEach(ctx context.Context, rows []syncRow, batchErr error) ([]syncRow, int, error) {
+	log.Printf("Metric batch of %d failed, inserting the records one by one: %v", len(rows), batchErr)
+	done := make([]syncRow, 0, len(rows))
+	inserted := 0
+	for _, row := range rows {
+		n, err := insertMetricRows(ctx, w.db, w.config.Table, []syncRow{row})
+		if err != nil {
+			w.fail(ctx, row.claim, err)
+			continue
+		}
+		done = append(done, row)
+		inserted += n
+	}
+	if len(done) == 0 {
+		return nil, 0, batchErr
+	}
+	return done, inserted, nil
+}
+
+// claimDue claims up to BatchSize due records for owner, the claims made before an error are returned with it
+func (w *syncWorker) claimDue(ctx context.Context, owner string) ([]redisclient.Claim, error) {
+	w.claimMutex.Lock()
+	defer w.claimMutex.Unlock()
+
+	keys, err := w.queue.Due(ctx, w.config.BatchSize)
+	if err != nil {
+		return nil, err
+	}
+	claims := make([]redisclient.Claim, 0, len(keys))
+	for _, key := range keys {
+		claim, err := w.queue.Claim(ctx, key, owner)
+		if err != nil {
+			return claims, err
+		}
+		if claim.Claimed {
+			claims = append(claims, claim)
+		}
+	}
+	return claims, nil
+}
+
+func (w *syncWorker) fail(ctx context.Context, claim redisclient.Claim, cause error) {
+	atomic.AddInt64(&w.metrics.failed, 1)
+	if _, err := w.queue.Fail(ctx, claim, cause); err != nil {
+		// the claim expires and the record is claimed again
+		log.Printf("Failed to mark %s failed: %v", claim.Key, err)
+	}
+}
+
+// MetricsService serves the counters of the worker and the number of pending records
+func (w *syncWorker) MetricsService(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 2*time.Second)
+	defer cancel()
+	pending, err := w.queue.Pending(ctx)
+
+	c.Header("Content-Type", "text/plain; version=0.0.4")
+	c.Status(http.StatusOK)
+	w.metrics.write(c.Writer, w.config.Workers, pending, err)
+}
+
+func newSyncRouter(worker *syncWorker) *gin.Engine {
+	router := gin.New()
+	router.Use(middlewares.ExceptionHandler())
+	router.GET("/health", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"status": "ok"})
+	})
+	router.GET("/metrics", worker.MetricsService)
+	return router
+}
+
+// insertMetricRowsQuery is one INSERT of rows rows, a key which is in the table already is skipped
+func insertMetricRowsQuery(table string, rows int) string {
+	query := strings.Builder{}
+	query.WriteString("INSERT INTO " + table + " (" + strings.Join(metricColumns, ", ") + ") VALUES ")
+	for row := 0; row < rows; row++ {
+		if row > 0 {
+			query.WriteString(", ")
+		}
+		query.WriteString("(")
+		for column := range metricColumns {
+			if column > 0 {
+				query.WriteString(", ")
+			}
+			query.WriteString("$" + strconv.Itoa(row*len(metricColumns)+column+1))
+		}
+		query.WriteString(")")
+	}
+	query.WriteString(" ON CONFLICT (hash_key) DO NOTHING")
+	return query.String()
+}
+
+// insertMetricRows inserts rows in one statement and returns how many were not in the table already
+func insertMetricRows(ctx context.Context, db metricDB, table string, rows []syncRow) (int, error) {
+	args := make([]interface{}, 0, len(rows)*len(metricColumns))
+	for _, row := range rows {
+		args = append(args, row.claim.Key, row.record.MetricID, row.record.EntityID, row.record.MetricValue,
+			row.record.MetricTimestamp, row.record.CreatedAt)
+	}
+	result, err := db.ExecContext(ctx, insertMetricRowsQuery(table, len(rows)), args...)
+	if err != nil {
+		return 0, fmt.Errorf("insert %d metrics into %s: %w", len(rows), table, err)
+	}
+	inserted, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return int(inserted), nil
+}
+
+func createMetricTable(ctx context.Context, db *sql.DB, table string) error {
+	_, err := db.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS "+table+` (
+		hash_key TEXT PRIMARY KEY,
+		metric_id TEXT NOT NULL,
+		entity_id TEXT NOT NULL,
+		metric_value DOUBLE PRECISION NOT NULL,
+		metric_timestamp TIMESTAMPTZ NOT NULL,
+		created_at TIMESTAMPTZ NOT NULL
+	)`)
+	return err
+}
+
+func main() {
+	config, err := SyncConfigFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	// REDIS_ADDR and REDIS_PASS come from the config
+	if _, err := confighelper.Load(os.Args[1:]); err != nil {
+		log.Fatalf("Failed to load the config: %v", err)
+	}
+	if err := redisclient.InitRedisDB(); err != nil {
+		log.Fatalf("Failed to initialize Redis client: %v", err)
+	}
+	defer redisclient.WatchConfig()()
+
+	// POSTGRES_CONN_STR may hold references such as password=secret://postgres#password
+	connStr := os.Getenv("POSTGRES_CONN_STR")
+	if connStr == "" {
+		connStr = "user=postgres dbname=metrics_dashboard sslmode=disable"
+	}
+	connStr, err = secrets.ResolveString(context.Background(), connStr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	db, err := sql.Open("postgres", connStr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(config.Workers)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := createMetricTable(ctx, db, config.Table); err != nil {
+		log.Fatalf("Failed to create table %s: %v", config.Table, err)
+	}
+
+	queue := redisclient.NewRecordQueue(redisclient.Default)
+	queue.Lease, queue.MaxAttempts, queue.RetryBackoff = config.Lease, config.MaxAttempts, config.RetryBackoff
+	if config.BackfillPattern != "" {
+		added, err := queue.Backfill(ctx, config.BackfillPattern)
+		if err != nil {
+			log.Fatalf("Failed to backfill the pending records: %v", err)
+		}
+		log.Printf("Backfilled %d pending records matching %s", added, config.BackfillPattern)
+	}
+
+	hostname, _ := os.Hostname()
+	worker := newSyncWorker(config, queue, db, hostname+"-"+strconv.Itoa(os.Getpid()))
+	server := &http.Server{Addr: config.MetricsAddr, Handler: newSyncRouter(worker)}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("Failed to start the metrics server: %v", err)
+		}
+	}()
+	go queue.RunReaper(ctx, config.Lease, func(err error) {
+		log.Printf("Failed to reap the expired claims: %v", err)
+	})
+
+	log.Printf("Metric sync started with %d workers, metrics on %s", config.Workers, config.MetricsAddr)
+	worker.Run(ctx)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Failed to stop the metrics server: %v", err)
+	}
+	log.Print("Metric sync stopped")
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	redisclient "digi-model-engine/redis"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+)
+
+func TestSyncConfigFromEnv(t *testing.T) {
+	config, err := SyncConfigFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Workers != defaultSyncWorkers || config.BatchSize != defaultSyncBatchSize || config.Lease != redisclient.DefaultLease ||
+		config.BackfillPattern != "metric:*" || config.Table != defaultSyncTable {
+		t.Errorf("config = %+v, want the defaults", config)
+	}
+
+	t.Setenv("METRIC_SYNC_WORKERS", "8")
+	t.Setenv("METRIC_SYNC_POLL_INTERVAL", "250ms")
+	t.Setenv("METRIC_SYNC_BACKFILL_PATTERN", "-")
+	t.Setenv("METRIC_SYNC_TABLE", "public.metric_data")
+	config, err = SyncConfigFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Workers != 8 || config.PollInterval != 250*time.Millisecond || config.BackfillPattern != "" || config.Table != "public.metric_data" {
+		t.Errorf("config = %+v, want the overrides", config)
+	}
+
+	for name, value := range map[string]string{
+		"METRIC_SYNC_BATCH_SIZE":  "20000",
+		"METRIC_SYNC_WORKERS":     "0",
+		"METRIC_SYNC_LEASE":       "30",
+		"METRIC_SYNC_MAX_BACKOFF": "100ms",
+		"METRIC_SYNC_TABLE":       "metrics; DROP TABLE metrics",
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv(name, value)
+			if _, err := SyncConfigFromEnv(); err == nil || !strings.Contains(err.Error(), name) {
+				t.Errorf("%s=%q gives %v, want an error naming it", name, value, err)
+			}
+		})
+	}
+}
+
+func TestNextBackoff(t *testing.T) {
+	backoff := time.Duration(0)
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, 10 * time.Second}
+	for i, w := range want {
+		backoff = nextBackoff(backoff, time.Second, 10*time.Second)
+		if backoff != w {
+			t.Fatalf("backoff %d = %s, want %s", i, backoff, w)
+		}
+	}
+}
+
+func TestInsertMetricRowsQuery(t *testing.T) {
+	want := "INSERT INTO metrics (hash_key, metric_id, entity_id, metric_value, metric_timestamp, created_at) VALUES " +
+		"($1, $2, $3, $4, $5, $6), ($7, $8, $9, $10, $11, $12) ON CONFLICT (hash_key) DO NOTHING"
+	if query := insertMetricRowsQuery("metrics", 2); query != want {
+		t.Errorf("query = %q\nwant %q", query, want)
+	}
+}
+
+func TestSyncWorkerRedisDown(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	rdb := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1, DialTimeout: time.Second})
+	defer rdb.Close()
+	config, err := SyncConfigFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	worker := newSyncWorker(config, redisclient.NewRecordQueue(redisclient.NewClient(rdb)), nil, "test")
+
+	if synced, err := worker.syncBatch("test-0"); synced != 0 || err == nil {
+		t.Errorf("syncBatch = %d, %v, want an error", synced, err)
+	}
+
+	// the counters are served without the pending records which can not be read
+	rec := httptest.NewRecorder()
+	newSyncRouter(worker).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := rec.Body.String()
+	if rec.Code != http.StatusOK || !strings.Contains(body, "metric_sync_workers 4\n") || !strings.Contains(body, "# TYPE metric_sync_records_inserted_total counter") {
+		t.Errorf("metrics = %d %s", rec.Code, body)
+	}
+	if strings.Contains(body, "metric_sync_pending_records") {
+		t.Error("pending records are served without Redis")
+	}
+}
+
+// fakeMetricDB keeps the inserted hash keys, an insert holding a key of bad fails as a whole like in Postgres
+type fakeMetricDB struct {
+	stored map[string]bool
+	bad    map[string]bool
+	down   bool
+	execs  int
+}
+
+func (db *fakeMetricDB) ExecContext(_ context.Context, _ string, args ...interface{}) (sql.Result, error) {
+	db.execs++
+	if db.down {
+		return nil, errors.New("connection refused")
+	}
+	keys := []string{}
+	for i := 0; i < len(args); i += len(metricColumns) {
+		key := args[i].(string)
+		if db.bad[key] {
+			return nil, errors.New("value out of range")
+		}
+		keys = append(keys, key)
+	}
+	inserted := 0
+	for _, key := range keys {
+		if !db.stored[key] {
+			db.stored[key] = true
+			inserted++
+		}
+	}
+	return driverResult(inserted), nil
+}
+
+type driverResult int64
+
+func (r driverResult) LastInsertId() (int64, error) { return 0, nil }
+func (r driverResult) RowsAffected() (int64, error) { return int64(r), nil }
+
+func newTestSyncWorker(t *testing.T, db metricDB, keys ...string) (*syncWorker, *redisclient.RecordQueue) {
+	client := redisclient.NewClient(redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()}))
+	queue := redisclient.NewRecordQueue(client)
+	for _, key := range keys {
+		record := redisclient.MetricRecord{MetricID: "m1", EntityID: key, MetricValue: 1, MetricTimestamp: time.Now().UTC(), CreatedAt: time.Now()}
+		if _, err := queue.CreateFrom(context.Background(), key, record); err != nil {
+			t.Fatal(err)
+		}
+	}
+	config, err := SyncConfigFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return newSyncWorker(config, queue, db, "test"), queue
+}
+
+func recordState(t *testing.T, queue *redisclient.RecordQueue, key string) string {
+	state, _, err := queue.Client.GetField(context.Background(), key, "state")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return state
+}
+
+func TestSyncBatchFailsOnlyTheBadRecord(t *testing.T) {
+	db := &fakeMetricDB{stored: map[string]bool{"metric:b": true}, bad: map[string]bool{"metric:bad": true}}
+	worker, queue := newTestSyncWorker(t, db, "metric:a", "metric:b", "metric:bad")
+
+	synced, err := worker.syncBatch("test-0")
+	if synced != 2 || err != nil {
+		t.Fatalf("syncBatch = %d, %v, want the 2 good records", synced, err)
+	}
+	// the batch, then each record
+	if db.execs != 4 || !db.stored["metric:a"] || db.stored["metric:bad"] {
+		t.Errorf("execs = %d, stored = %v", db.execs, db.stored)
+	}
+	for key, want := range map[string]string{"metric:a": "INSERTED", "metric:b": "INSERTED", "metric:bad": "FAILED"} {
+		if state := recordState(t, queue, key); state != want {
+			t.Errorf("%s is %s, want %s", key, state, want)
+		}
+	}
+	if pending, _ := queue.Pending(context.Background()); pending != 1 {
+		t.Errorf("pending = %d, want the failed record to be retried", pending)
+	}
+	m := worker.metrics
+	if m.batches != 1 || m.inserted != 1 || m.skipped != 1 || m.failed != 1 {
+		t.Errorf("metrics = %+v", *m)
+	}
+}
+
+func TestSyncBatchDatabaseDown(t *testing.T) {
+	db := &fakeMetricDB{down: true}
+	worker, queue := newTestSyncWorker(t, db, "metric:a", "metric:b")
+
+	if synced, err := worker.syncBatch("test-0"); synced != 0 || err == nil {
+		t.Fatalf("syncBatch = %d, %v, want the batch error", synced, err)
+	}
+	for _, key := range []string{"metric:a", "metric:b"} {
+		if state := recordState(t, queue, key); state != "FAILED" {
+			t.Errorf("%s is %s, want FAILED", key, state)
+		}
+	}
+	if worker.metrics.failed != 2 || worker.metrics.batches != 0 {
+		t.Errorf("metrics = %+v", *worker.metrics)
+	}
+}
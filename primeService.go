@@ -0,0 +1,210 @@
+package main
+
+import (
+	"TestProject/Server/GolangServer/apperrors"
+	"TestProject/Server/GolangServer/confighelper"
+	"TestProject/Server/GolangServer/model"
+	"TestProject/Server/GolangServer/validation"
+	"context"
+	"fmt"
+	"net/http"
+	"runtime"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	primeSegmentSize  = 1 << 16
+	ndjsonContentType = "application/x-ndjson"
+)
+
+// To get the prime number list of a range, as JSON, as NDJSON when large or as a count only
+func GetPrimeNumberListService(c echo.Context) error {
+	primeNumberRequest := model.PrimeNumberRequest{}
+	if err := validation.BindAndValidate(c, &primeNumberRequest); err != nil {
+		return err
+	}
+
+	from, to := primeNumberRequest.From, int64(0)
+	switch {
+	case primeNumberRequest.To != nil:
+		to = *primeNumberRequest.To
+	case primeNumberRequest.Number != nil:
+		to = *primeNumberRequest.Number
+	default:
+		return apperrors.Validation("invalid request", map[string]string{"to": "to is a required field"})
+	}
+	if from > to {
+		return apperrors.Validation("invalid request", map[string]string{"from": "from must be less than or equal to to"})
+	}
+	if upperBound := confighelper.Get().PrimeUpperBound; to > upperBound {
+		return apperrors.Validation("invalid request", map[string]string{"to": fmt.Sprintf("to must be %d or less", upperBound)})
+	}
+
+	ctx := c.Request().Context()
+	workers := runtime.NumCPU()
+
+	if primeNumberRequest.CountOnly {
+		count := 0
+		err := generatePrimes(ctx, from, to, workers, func(segment []int64) error {
+			count += len(segment)
+			return nil
+		})
+		if err != nil {
+			return apperrors.Internal(err)
+		}
+		return c.JSON(http.StatusOK, map[string]int64{"from": from, "to": to, "count": int64(count)})
+	}
+
+	if primeNumberRequest.Stream || to-from > confighelper.Get().PrimeStreamAbove {
+		return streamPrimes(ctx, c, from, to, workers)
+	}
+
+	primes := []int64{}
+	err := generatePrimes(ctx, from, to, workers, func(segment []int64) error {
+		primes = append(primes, segment...)
+		return nil
+	})
+	if err != nil {
+		return apperrors.Internal(err)
+	}
+	return c.JSON(http.StatusOK, primes)
+}
+
+// streamPrimes writes one prime per line and flushes after every segment
+func streamPrimes(ctx context.Context, c echo.Context, from, to int64, workers int) error {
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, ndjsonContentType)
+	res.WriteHeader(http.StatusOK)
+
+	line := make([]byte, 0, 24)
+	return generatePrimes(ctx, from, to, workers, func(segment []int64) error {
+		for _, prime := range segment {
+			line = strconv.AppendInt(line[:0], prime, 10)
+			line = append(line, '\n')
+			if _, err := res.Write(line); err != nil {
+				return err
+			}
+		}
+		res.Flush()
+		return nil
+	})
+}
+
+// generatePrimes runs a segmented sieve of Eratosthenes over [from, to].
+// Segments are sieved by up to workers goroutines and handed to emit in ascending order.
+func generatePrimes(ctx context.Context, from, to int64, workers int, emit func(segment []int64) error) error {
+	if from < 2 {
+		from = 2
+	}
+	if to < from {
+		return nil
+	}
+	if workers < 1 {
+		workers = 1
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	basePrimes := simpleSieve(isqrt(to))
+
+	// each pending segment has its own result channel, queued in order; the queue
+	// capacity bounds how many segments are sieved at the same time
+	pending := make(chan chan []int64, workers)
+	go func() {
+		defer close(pending)
+		for low := from; low <= to; low += primeSegmentSize {
+			high := low + primeSegmentSize - 1
+			if high > to || high < low {
+				high = to
+			}
+			result := make(chan []int64, 1)
+			select {
+			case pending <- result:
+			case <-ctx.Done():
+				return
+			}
+			go func(low, high int64) {
+				result <- sieveSegment(low, high, basePrimes)
+			}(low, high)
+			if high == to {
+				return
+			}
+		}
+	}()
+
+	for result := range pending {
+		select {
+		case segment := <-result:
+			if err := emit(segment); err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return ctx.Err()
+}
+
+// simpleSieve returns the primes up to limit
+func simpleSieve(limit int64) []int64 {
+	if limit < 2 {
+		return nil
+	}
+	composite := make([]bool, limit+1)
+	primes := []int64{}
+	for i := int64(2); i <= limit; i++ {
+		if composite[i] {
+			continue
+		}
+		primes = append(primes, i)
+		for j := i * i; j <= limit; j += i {
+			composite[j] = true
+		}
+	}
+	return primes
+}
+
+// sieveSegment returns the primes in [low, high], basePrimes must cover sqrt(high)
+func sieveSegment(low, high int64, basePrimes []int64) []int64 {
+	composite := make([]bool, high-low+1)
+	for _, p := range basePrimes {
+		if p*p > high {
+			break
+		}
+		start := (low + p - 1) / p * p
+		if start < p*p {
+			start = p * p
+		}
+		for j := start; j <= high; j += p {
+			composite[j-low] = true
+		}
+	}
+	primes := []int64{}
+	for i, isComposite := range composite {
+		if n := low + int64(i); !isComposite && n >= 2 {
+			primes = append(primes, n)
+		}
+	}
+	return primes
+}
+
+// isqrt returns the floor of the square root of n
+func isqrt(n int64) int64 {
+	if n < 2 {
+		return n
+	}
+	x := int64(1) << 32
+	if n < x {
+		x = n
+	}
+	for {
+		y := (x + n/x) / 2
+		if y >= x {
+			return x
+		}
+		x = y
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func naivePrimes(from, to int64) []int64 {
+	primes := []int64{}
+	for n := from; n <= to; n++ {
+		isPrime := n >= 2
+		for d := int64(2); d*d <= n && isPrime; d++ {
+			isPrime = n%d != 0
+		}
+		if isPrime {
+			primes = append(primes, n)
+		}
+	}
+	return primes
+}
+
+func TestGeneratePrimes(t *testing.T) {
+	ranges := [][2]int64{{0, 0}, {0, 1}, {0, 2}, {0, 100}, {89, 97}, {90, 96}, {65530, 65560}, {0, 200000}, {199990, 200000}}
+	for _, r := range ranges {
+		got := []int64{}
+		err := generatePrimes(context.Background(), r[0], r[1], 4, func(segment []int64) error {
+			got = append(got, segment...)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := naivePrimes(r[0], r[1]); !reflect.DeepEqual(got, want) {
+			t.Errorf("range %v: got %d primes, want %d", r, len(got), len(want))
+		}
+	}
+}
+
+func TestGeneratePrimesStopsOnEmitError(t *testing.T) {
+	stop := errors.New("client went away")
+	segments := 0
+	err := generatePrimes(context.Background(), 0, 10*primeSegmentSize, 2, func(segment []int64) error {
+		segments++
+		return stop
+	})
+	if err != stop || segments != 1 {
+		t.Errorf("expected to stop after the first segment, got %v after %d segments", err, segments)
+	}
+}
+
+func TestIsqrt(t *testing.T) {
+	for _, n := range []int64{0, 1, 2, 3, 4, 15, 16, 17, 99, 100, 1<<40 - 1, 1 << 40} {
+		r := isqrt(n)
+		if r*r > n || (r+1)*(r+1) <= n {
+			t.Errorf("isqrt(%d) = %d", n, r)
+		}
+	}
+}
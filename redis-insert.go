@@ -1,16 +1,22 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"log"
+	"os"
 	"time"
 
-	"github.com/spf13/viper"
-
-	"your-package-path/redis" // Replace with the actual package path
+	"TestProject/Server/GolangServer/confighelper"
+	"digi-model-engine/redis"
 )
 
 func main() {
+	// REDIS_ADDR and REDIS_PASS come from the config
+	if _, err := confighelper.Load(os.Args[1:]); err != nil {
+		log.Fatalf("Failed to load the config: %v", err)
+	}
+
 	// Initialize Redis client
 	err := redis.InitRedisDB()
 	if err != nil {
@@ -68,7 +74,9 @@ func main() {
 		}
 
 		// Insert key-value pair into Redis
-		err = redis.InsertKeyToRedis(item.RedisKey, string(jsonValue))
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		_, _, err = redis.Default.SetKey(ctx, item.RedisKey, string(jsonValue))
+		cancel()
 		if err != nil {
 			log.Printf("Failed to insert data for key '%s' into Redis: %v", item.RedisKey, err)
 		} else {
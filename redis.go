@@ -1,26 +1,56 @@
 package redis
 
 import (
+	"TestProject/Server/GolangServer/confighelper"
+	"TestProject/Server/GolangServer/secrets"
 	"context"
 	"digi-model-engine/utils/constants"
-	"digi-model-engine/utils/exceptions"
 	"fmt"
 	"log"
+	"sync"
 	"time"
 
 	"github.com/go-redis/redis/v8"
-	"github.com/spf13/viper"
 )
 
+// in-flight commands get this long on a replaced client before it is closed
+const retiredClientGrace = 5 * time.Second
+
 var (
 	RedisClient *redis.Client
+	clientMutex sync.RWMutex
 )
 
 func InitRedisDB() error {
-	// Replace these with your Redis server's connection details.
-	redisAddr := viper.GetString("REDIS_ADDR")     // Redis server address
-	redisPassword := viper.GetString("REDIS_PASS") // Password (leave empty if no password)
-	redisDB := constants.REDIS_DB_NUMBER           // Redis database number
+	cfg := confighelper.Get()
+	return connectRedis(cfg.RedisAddr, cfg.RedisPassword)
+}
+
+// WatchConfig reconnects RedisClient when a reload changes REDIS_ADDR or REDIS_PASS, call the returned func to stop.
+// The old client is kept when the new address can not be reached.
+func WatchConfig() func() {
+	return confighelper.Subscribe(func(event confighelper.ChangeEvent) {
+		if !event.Changed("REDIS_ADDR", "REDIS_PASS") {
+			return
+		}
+		if err := connectRedis(event.New.RedisAddr, event.New.RedisPassword); err != nil {
+			log.Print("Error While Reconnecting Redis, keeping the old client::", err)
+			return
+		}
+		log.Print("Redis Reconnected To::", event.New.RedisAddr)
+	})
+}
+
+// connectRedis replaces RedisClient once the new server answers, redisPassword may be a secret://path#key reference
+func connectRedis(redisAddr, redisPassword string) error {
+	redisDB := constants.REDIS_DB_NUMBER // Redis database number
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	redisPassword, err := secrets.Resolve(ctx, redisPassword)
+	if err != nil {
+		return fmt.Errorf("Failed to resolve the Redis password: %v", err)
+	}
 
 	// Create a Redis client.
 	client := redis.NewClient(&redis.Options{
@@ -30,54 +60,52 @@ func InitRedisDB() error {
 	})
 
 	// Ping the Redis server to test the connection.
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
 	if _, err := client.Ping(ctx).Result(); err != nil {
+		client.Close()
 		return fmt.Errorf("Failed to connect to Redis: %v", err)
 	}
 
 	// Assign the Redis client to the global variable for later use.
+	clientMutex.Lock()
+	old := RedisClient
 	RedisClient = client
+	clientMutex.Unlock()
 
+	if old != nil {
+		time.AfterFunc(retiredClientGrace, func() { old.Close() })
+	}
 	return nil
 }
 
-func FetchFieldFromRedis(key, field string) string {
-	if RedisClient == nil {
-		log.Println("Redis client is not initialized.")
-		return ""
-	}
+// getClient returns the current client, nil before InitRedisDB
+func getClient() *redis.Client {
+	clientMutex.RLock()
+	defer clientMutex.RUnlock()
+	return RedisClient
+}
 
+// FetchFieldFromRedis returns the field of the hash at key, "" when it is missing or can not be read.
+//
+// Deprecated: use Default.GetField, it tells a missing field from an error.
+func FetchFieldFromRedis(key, field string) string {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	val, err := RedisClient.HGet(ctx, key, field).Result()
+	val, _, err := Default.GetField(ctx, key, field)
 	if err != nil {
-		if err == redis.Nil {
-			exceptions.InternalServerError(err)
-		} else {
-			log.Fatalf("Error fetching field '%s' from hash '%s' in Redis: %v\n", field, key, err)
-		}
+		log.Printf("Error fetching field '%s' from hash '%s' in Redis: %v\n", field, key, err)
 		return ""
 	}
-
 	return val
 }
 
+// InsertFieldIntoRedis sets the field of the hash at key.
+//
+// Deprecated: use Default.SetField, it takes the caller context.
 func InsertFieldIntoRedis(key, field, value string) error {
-	if RedisClient == nil {
-		return fmt.Errorf("Redis client is not initialized.")
-	}
-
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	_, err := RedisClient.HSet(ctx, key, field, value).Result()
-	if err != nil {
-		log.Fatalf("Error inserting field '%s' with value '%s' into hash '%s' in Redis: %v\n", field, value, key, err)
-		return err
-	}
-
-	return nil
+	_, _, err := Default.SetField(ctx, key, field, value)
+	return err
 }
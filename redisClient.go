@@ -0,0 +1,233 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// ErrNotInitialized is returned by the Default client before InitRedisDB
+var ErrNotInitialized = errors.New("redis client is not initialized")
+
+// Client wraps a go-redis client. A missing key or field is reported by found, never as an error,
+// and the errors name the command and key which failed.
+type Client struct {
+	client func() *redis.Client
+}
+
+// Default uses RedisClient, so it follows the reconnects done by WatchConfig
+var Default = &Client{client: getClient}
+
+// NewClient wraps rdb
+func NewClient(rdb *redis.Client) *Client {
+	return &Client{client: func() *redis.Client { return rdb }}
+}
+
+// Option changes one call of the client
+type Option func(*callOptions)
+
+type callOptions struct {
+	ttl time.Duration
+}
+
+// WithTTL expires the key after ttl. On a set the key gets the ttl, on a get found keys get it again
+// so they stay while they are read. Without it the expiry of the key is left as it is.
+func WithTTL(ttl time.Duration) Option {
+	return func(o *callOptions) {
+		o.ttl = ttl
+	}
+}
+
+func newCallOptions(opts []Option) callOptions {
+	o := callOptions{}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+func (c *Client) rdb() (*redis.Client, error) {
+	rdb := c.client()
+	if rdb == nil {
+		return nil, ErrNotInitialized
+	}
+	return rdb, nil
+}
+
+// GetKey returns the string value of key
+func (c *Client) GetKey(ctx context.Context, key string, opts ...Option) (string, bool, error) {
+	rdb, err := c.rdb()
+	if err != nil {
+		return "", false, err
+	}
+	value, err := rdb.Get(ctx, key).Result()
+	if err == redis.Nil {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, commandError("get", key, err)
+	}
+	return value, true, c.touch(ctx, rdb, key, newCallOptions(opts))
+}
+
+// Exists reports whether key holds a value of any type
+func (c *Client) Exists(ctx context.Context, key string) (bool, error) {
+	rdb, err := c.rdb()
+	if err != nil {
+		return false, err
+	}
+	n, err := rdb.Exists(ctx, key).Result()
+	if err != nil {
+		return false, commandError("exists", key, err)
+	}
+	return n == 1, nil
+}
+
+// SetKey sets the string value of key and returns the value it replaced. It sends one SET ... GET, so it needs
+// Redis 6.2 or later, and without WithTTL it keeps the expiry of key with KEEPTTL. A key holding another type
+// fails the command and is left as it is.
+func (c *Client) SetKey(ctx context.Context, key, value string, opts ...Option) (string, bool, error) {
+	rdb, err := c.rdb()
+	if err != nil {
+		return "", false, err
+	}
+	o := newCallOptions(opts)
+	args := redis.SetArgs{TTL: o.ttl, KeepTTL: o.ttl <= 0, Get: true}
+
+	// with GET the reply is the previous value, redis.Nil for a new key
+	previous, err := rdb.SetArgs(ctx, key, value, args).Result()
+	if err == redis.Nil {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, commandError("set", key, err)
+	}
+	return previous, true, nil
+}
+
+// GetField returns one field of the hash at key
+func (c *Client) GetField(ctx context.Context, key, field string, opts ...Option) (string, bool, error) {
+	rdb, err := c.rdb()
+	if err != nil {
+		return "", false, err
+	}
+	value, err := rdb.HGet(ctx, key, field).Result()
+	if err == redis.Nil {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, commandError("hget", key+" "+field, err)
+	}
+	return value, true, c.touch(ctx, rdb, key, newCallOptions(opts))
+}
+
+// SetField sets one field of the hash at key and returns the value it replaced
+func (c *Client) SetField(ctx context.Context, key, field, value string, opts ...Option) (string, bool, error) {
+	rdb, err := c.rdb()
+	if err != nil {
+		return "", false, err
+	}
+	o := newCallOptions(opts)
+
+	var previous *redis.StringCmd
+	var set *redis.IntCmd
+	var expire *redis.BoolCmd
+	_, err = rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		previous = pipe.HGet(ctx, key, field)
+		set = pipe.HSet(ctx, key, field, value)
+		if o.ttl > 0 {
+			expire = pipe.Expire(ctx, key, o.ttl)
+		}
+		return nil
+	})
+	// the transaction reports its first error, which is redis.Nil for a new field and hides the later ones
+	if (err != nil && err != redis.Nil) || set.Err() != nil {
+		return "", false, commandError("hset", key+" "+field, firstError(set.Err(), err))
+	}
+	if expire != nil && expire.Err() != nil {
+		return "", false, commandError("expire", key, expire.Err())
+	}
+	return stringResult(previous, "hget", key+" "+field)
+}
+
+// GetHash returns every field of the hash at key, found is false when there is no such hash
+func (c *Client) GetHash(ctx context.Context, key string, opts ...Option) (map[string]string, bool, error) {
+	rdb, err := c.rdb()
+	if err != nil {
+		return nil, false, err
+	}
+	values, err := rdb.HGetAll(ctx, key).Result()
+	if err != nil {
+		return nil, false, commandError("hgetall", key, err)
+	}
+	if len(values) == 0 {
+		return values, false, nil
+	}
+	return values, true, c.touch(ctx, rdb, key, newCallOptions(opts))
+}
+
+// SetHash sets the given fields of the hash at key, the other fields are kept. It returns the hash as it was before.
+func (c *Client) SetHash(ctx context.Context, key string, values map[string]string, opts ...Option) (map[string]string, bool, error) {
+	rdb, err := c.rdb()
+	if err != nil {
+		return nil, false, err
+	}
+	if len(values) == 0 {
+		return nil, false, fmt.Errorf("redis hset %s: no fields to set", key)
+	}
+	o := newCallOptions(opts)
+
+	var previous *redis.StringStringMapCmd
+	_, err = rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		previous = pipe.HGetAll(ctx, key)
+		pipe.HSet(ctx, key, values)
+		if o.ttl > 0 {
+			pipe.Expire(ctx, key, o.ttl)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, false, commandError("hset", key, err)
+	}
+	before := previous.Val()
+	return before, len(before) != 0, nil
+}
+
+// touch gives key the ttl of o, if any
+func (c *Client) touch(ctx context.Context, rdb *redis.Client, key string, o callOptions) error {
+	if o.ttl <= 0 {
+		return nil
+	}
+	if err := rdb.Expire(ctx, key, o.ttl).Err(); err != nil {
+		return commandError("expire", key, err)
+	}
+	return nil
+}
+
+// stringResult reads a get queued in a transaction, redis.Nil is a missing value
+func stringResult(cmd *redis.StringCmd, command, key string) (string, bool, error) {
+	value, err := cmd.Result()
+	if err == redis.Nil {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, commandError(command, key, err)
+	}
+	return value, true, nil
+}
+
+func firstError(errs ...error) error {
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func commandError(command, key string, err error) error {
+	return fmt.Errorf("redis %s %s: %w", command, key, err)
+}
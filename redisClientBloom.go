@@ -0,0 +1,50 @@
+package redis
+
+import (
+	"context"
+	"strings"
+)
+
+// BloomReserve creates the Bloom filter with its false positive rate and capacity, a filter which exists is left as it is.
+// Without it BF.ADD creates the filter with the defaults of the server.
+func (c *Client) BloomReserve(ctx context.Context, filter string, errorRate float64, capacity int64) error {
+	rdb, err := c.rdb()
+	if err != nil {
+		return err
+	}
+	err = rdb.Do(ctx, "BF.RESERVE", filter, errorRate, capacity).Err()
+	if err != nil && !strings.Contains(err.Error(), "item exists") {
+		return commandError("bf.reserve", filter, err)
+	}
+	return nil
+}
+
+// BloomExists tells whether item may have been added to the filter. false is certain, true is wrong
+// at the false positive rate of the filter. A filter which does not exist holds nothing.
+func (c *Client) BloomExists(ctx context.Context, filter, item string) (bool, error) {
+	rdb, err := c.rdb()
+	if err != nil {
+		return false, err
+	}
+	exists, err := rdb.Do(ctx, "BF.EXISTS", filter, item).Int()
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			return false, nil
+		}
+		return false, commandError("bf.exists", filter, err)
+	}
+	return exists == 1, nil
+}
+
+// BloomAdd adds item to the filter, added is false when it may have been added before
+func (c *Client) BloomAdd(ctx context.Context, filter, item string) (bool, error) {
+	rdb, err := c.rdb()
+	if err != nil {
+		return false, err
+	}
+	added, err := rdb.Do(ctx, "BF.ADD", filter, item).Int()
+	if err != nil {
+		return false, commandError("bf.add", filter, err)
+	}
+	return added == 1, nil
+}
@@ -0,0 +1,316 @@
+package redis
+
+import (
+	"context"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HGetAllInto decodes the hash at key into the struct dst points to, found is false when there is no such hash.
+//
+// Only the fields tagged `redis:"name"` are read, each as its Go type: strings as they are, bool with
+// strconv.ParseBool, numbers in base 10, time.Duration as "1m30s" and types implementing encoding.TextUnmarshaler,
+// enums included, with UnmarshalText. time.Time is RFC 3339 unless the tag has layout=<go layout> or unix.
+// Structs, maps and slices, or any field tagged json, hold JSON. A tag with oneof=A|B only accepts these values.
+// Fields missing from the hash are left as they are.
+func (c *Client) HGetAllInto(ctx context.Context, key string, dst interface{}, opts ...Option) (bool, error) {
+	values, found, err := c.GetHash(ctx, key, opts...)
+	if err != nil || !found {
+		return false, err
+	}
+	if err := DecodeHash(values, dst); err != nil {
+		return true, fmt.Errorf("redis hash %s: %w", key, err)
+	}
+	return true, nil
+}
+
+// HSetFrom sets the tagged fields of the struct src, or src points to, in the hash at key, see HGetAllInto
+// for the encoding. Nil pointers and the zero values of fields tagged omitempty are not set.
+func (c *Client) HSetFrom(ctx context.Context, key string, src interface{}, opts ...Option) error {
+	values, err := EncodeHash(src)
+	if err != nil {
+		return fmt.Errorf("redis hash %s: %w", key, err)
+	}
+	_, _, err = c.SetHash(ctx, key, values, opts...)
+	return err
+}
+
+// DecodeHash decodes the fields of a hash into the struct dst points to, see HGetAllInto
+func DecodeHash(values map[string]string, dst interface{}) error {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("decode into %T: a pointer to a struct is required", dst)
+	}
+	fields, err := hashFieldsOf(v.Elem().Type())
+	if err != nil {
+		return err
+	}
+	for _, field := range fields {
+		raw, ok := values[field.name]
+		if !ok {
+			continue
+		}
+		if err := field.decode(v.Elem().FieldByIndex(field.index), raw); err != nil {
+			return fmt.Errorf("field %s: %w", field.name, err)
+		}
+	}
+	return nil
+}
+
+// EncodeHash encodes the tagged fields of the struct src, or src points to, see HSetFrom
+func EncodeHash(src interface{}) (map[string]string, error) {
+	v := reflect.ValueOf(src)
+	if v.Kind() == reflect.Ptr && !v.IsNil() {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("encode %T: a struct is required", src)
+	}
+	fields, err := hashFieldsOf(v.Type())
+	if err != nil {
+		return nil, err
+	}
+	values := map[string]string{}
+	for _, field := range fields {
+		fieldValue := v.FieldByIndex(field.index)
+		if field.omitEmpty && fieldValue.IsZero() {
+			continue
+		}
+		raw, ok, err := field.encode(fieldValue)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", field.name, err)
+		}
+		if ok {
+			values[field.name] = raw
+		}
+	}
+	return values, nil
+}
+
+var (
+	timeType            = reflect.TypeOf(time.Time{})
+	durationType        = reflect.TypeOf(time.Duration(0))
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	textMarshalerType   = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+
+	// struct type to its []hashField
+	hashFieldCache sync.Map
+)
+
+// hashField is one tagged struct field and the options of its tag
+type hashField struct {
+	name      string
+	index     []int
+	omitEmpty bool
+	asJSON    bool
+	unix      bool
+	layout    string
+	oneOf     []string
+}
+
+// hashFieldsOf returns the tagged fields of t, the ones of embedded structs included
+func hashFieldsOf(t reflect.Type) ([]hashField, error) {
+	if cached, ok := hashFieldCache.Load(t); ok {
+		return cached.([]hashField), nil
+	}
+	fields := []hashField{}
+	names := map[string]bool{}
+	for _, structField := range reflect.VisibleFields(t) {
+		tag := structField.Tag.Get("redis")
+		if tag == "" || tag == "-" || structField.Anonymous || !structField.IsExported() || throughPointer(t, structField.Index) {
+			continue
+		}
+		parts := strings.Split(tag, ",")
+		field := hashField{name: parts[0], index: structField.Index}
+		for _, option := range parts[1:] {
+			switch {
+			case option == "omitempty":
+				field.omitEmpty = true
+			case option == "json":
+				field.asJSON = true
+			case option == "unix":
+				field.unix = true
+			case strings.HasPrefix(option, "layout="):
+				field.layout = strings.TrimPrefix(option, "layout=")
+			case strings.HasPrefix(option, "oneof="):
+				field.oneOf = strings.Split(strings.TrimPrefix(option, "oneof="), "|")
+			default:
+				return nil, fmt.Errorf("%s.%s: unknown redis tag option %q", t, structField.Name, option)
+			}
+		}
+		if field.name == "" || names[field.name] {
+			return nil, fmt.Errorf("%s.%s: redis tag %q is empty or repeated", t, structField.Name, tag)
+		}
+		names[field.name] = true
+		fields = append(fields, field)
+	}
+	hashFieldCache.Store(t, fields)
+	return fields, nil
+}
+
+// throughPointer tells whether the field at index is promoted from an embedded pointer, it can not be set through a nil one
+func throughPointer(t reflect.Type, index []int) bool {
+	for _, i := range index[:len(index)-1] {
+		t = t.Field(i).Type
+		if t.Kind() == reflect.Ptr {
+			return true
+		}
+	}
+	return false
+}
+
+func (field hashField) decode(v reflect.Value, raw string) error {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return field.decode(v.Elem(), raw)
+	}
+	if len(field.oneOf) != 0 && !contains(field.oneOf, raw) {
+		return fmt.Errorf("%q is not one of %s", raw, strings.Join(field.oneOf, ", "))
+	}
+	if field.asJSON {
+		return json.Unmarshal([]byte(raw), v.Addr().Interface())
+	}
+
+	switch {
+	case v.Type() == timeType && (field.unix || field.layout != ""):
+		t, err := field.parseTime(raw)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(t))
+		return nil
+	case v.Type() == durationType:
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	case reflect.PtrTo(v.Type()).Implements(textUnmarshalerType):
+		return v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(raw))
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(raw, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(raw, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			v.SetBytes([]byte(raw))
+			return nil
+		}
+		return json.Unmarshal([]byte(raw), v.Addr().Interface())
+	case reflect.Struct, reflect.Map, reflect.Array:
+		return json.Unmarshal([]byte(raw), v.Addr().Interface())
+	default:
+		return fmt.Errorf("type %s is not supported", v.Type())
+	}
+	return nil
+}
+
+// encode returns the text of v, ok is false for a nil pointer
+func (field hashField) encode(v reflect.Value) (raw string, ok bool, err error) {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return "", false, nil
+		}
+		return field.encode(v.Elem())
+	}
+	defer func() {
+		if err == nil && len(field.oneOf) != 0 && !contains(field.oneOf, raw) {
+			err = fmt.Errorf("%q is not one of %s", raw, strings.Join(field.oneOf, ", "))
+		}
+	}()
+	if field.asJSON {
+		bs, err := json.Marshal(v.Interface())
+		return string(bs), err == nil, err
+	}
+
+	switch {
+	case v.Type() == timeType && field.unix:
+		return strconv.FormatInt(v.Interface().(time.Time).Unix(), 10), true, nil
+	case v.Type() == timeType && field.layout != "":
+		return v.Interface().(time.Time).Format(field.layout), true, nil
+	case v.Type() == durationType:
+		return time.Duration(v.Int()).String(), true, nil
+	case v.Type().Implements(textMarshalerType):
+		bs, err := v.Interface().(encoding.TextMarshaler).MarshalText()
+		return string(bs), err == nil, err
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		return v.String(), true, nil
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool()), true, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), true, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10), true, nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'g', -1, v.Type().Bits()), true, nil
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return string(v.Bytes()), true, nil
+		}
+		bs, err := json.Marshal(v.Interface())
+		return string(bs), err == nil, err
+	case reflect.Struct, reflect.Map, reflect.Array:
+		bs, err := json.Marshal(v.Interface())
+		return string(bs), err == nil, err
+	default:
+		return "", false, fmt.Errorf("type %s is not supported", v.Type())
+	}
+}
+
+// parseTime reads a unix second or a time in the layout of the tag, the layout is in local time like the stored dates
+func (field hashField) parseTime(raw string) (time.Time, error) {
+	if field.unix {
+		seconds, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return time.Unix(seconds, 0), nil
+	}
+	return time.ParseInLocation(field.layout, raw, time.Local)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,193 @@
+package redis
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type recordStatus int
+
+const (
+	statusNew recordStatus = iota
+	statusInserted
+)
+
+func (s recordStatus) MarshalText() ([]byte, error) {
+	switch s {
+	case statusNew:
+		return []byte("NEW"), nil
+	case statusInserted:
+		return []byte("INSERTED"), nil
+	}
+	return nil, fmt.Errorf("unknown status %d", int(s))
+}
+
+func (s *recordStatus) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "NEW":
+		*s = statusNew
+	case "INSERTED":
+		*s = statusInserted
+	default:
+		return fmt.Errorf("unknown status %q", text)
+	}
+	return nil
+}
+
+type recordSource struct {
+	Name string `json:"name"`
+	Port int    `json:"port"`
+}
+
+type recordBase struct {
+	EntityID string `redis:"entity_id"`
+}
+
+type testRecord struct {
+	recordBase
+	RedisKey   string            `redis:"redis_key"`
+	Count      int               `redis:"count"`
+	Score      float64           `redis:"score"`
+	IsInserted bool              `redis:"is_inserted"`
+	Status     recordStatus      `redis:"status"`
+	Kind       string            `redis:"kind,oneof=bank|sms"`
+	CreatedAt  time.Time         `redis:"created_at,layout=2006-01-02 15:04:05"`
+	ClaimedAt  time.Time         `redis:"claimed_at,unix"`
+	UpdatedAt  time.Time         `redis:"updated_at"`
+	Lease      time.Duration     `redis:"lease"`
+	Source     recordSource      `redis:"source"`
+	Labels     map[string]string `redis:"labels"`
+	Retries    *int              `redis:"retries"`
+	Note       string            `redis:"note,omitempty"`
+	Ignored    string
+}
+
+func TestDecodeHash(t *testing.T) {
+	values := map[string]string{
+		"entity_id":   "007",
+		"redis_key":   "298815",
+		"count":       "42",
+		"score":       "1.5",
+		"is_inserted": "true",
+		"status":      "INSERTED",
+		"kind":        "sms",
+		"created_at":  "2023-12-06 16:51:58",
+		"claimed_at":  "1700000000",
+		"updated_at":  "2023-12-07T11:59:02Z",
+		"lease":       "30s",
+		"source":      `{"name":"bank","port":8080}`,
+		"labels":      `{"a":"b"}`,
+		"retries":     "2",
+		"unknown":     "x",
+	}
+	record := testRecord{}
+	if err := DecodeHash(values, &record); err != nil {
+		t.Fatal(err)
+	}
+	retries := 2
+	want := testRecord{
+		recordBase: recordBase{EntityID: "007"},
+		RedisKey:   "298815",
+		Count:      42,
+		Score:      1.5,
+		IsInserted: true,
+		Status:     statusInserted,
+		Kind:       "sms",
+		CreatedAt:  time.Date(2023, 12, 6, 16, 51, 58, 0, time.Local),
+		ClaimedAt:  time.Unix(1700000000, 0),
+		UpdatedAt:  time.Date(2023, 12, 7, 11, 59, 2, 0, time.UTC),
+		Lease:      30 * time.Second,
+		Source:     recordSource{Name: "bank", Port: 8080},
+		Labels:     map[string]string{"a": "b"},
+		Retries:    &retries,
+	}
+	if !reflect.DeepEqual(record, want) {
+		t.Errorf("record = %+v\nwant %+v", record, want)
+	}
+
+	for field, raw := range map[string]string{
+		"is_inserted": "",
+		"count":       "4.2",
+		"status":      "DONE",
+		"kind":        "email",
+		"created_at":  "2023-12-06",
+		"source":      "{",
+	} {
+		err := DecodeHash(map[string]string{field: raw}, &testRecord{})
+		if err == nil || !strings.Contains(err.Error(), field) {
+			t.Errorf("%s=%q gives %v, want an error naming the field", field, raw, err)
+		}
+	}
+	if err := DecodeHash(values, record); err == nil {
+		t.Error("decoding into a struct value is accepted")
+	}
+}
+
+func TestEncodeHash(t *testing.T) {
+	record := testRecord{
+		recordBase: recordBase{EntityID: "007"},
+		Count:      42,
+		Status:     statusInserted,
+		Kind:       "bank",
+		CreatedAt:  time.Date(2023, 12, 6, 16, 51, 58, 0, time.Local),
+		ClaimedAt:  time.Unix(1700000000, 0),
+		Source:     recordSource{Name: "bank", Port: 8080},
+	}
+	values, err := EncodeHash(&record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for field, want := range map[string]string{
+		"entity_id":   "007",
+		"count":       "42",
+		"is_inserted": "false",
+		"status":      "INSERTED",
+		"created_at":  "2023-12-06 16:51:58",
+		"claimed_at":  "1700000000",
+		"lease":       "0s",
+		"source":      `{"name":"bank","port":8080}`,
+		"labels":      "null",
+	} {
+		if values[field] != want {
+			t.Errorf("%s = %q, want %q", field, values[field], want)
+		}
+	}
+	for _, field := range []string{"retries", "note", "Ignored"} {
+		if _, ok := values[field]; ok {
+			t.Errorf("%s is encoded", field)
+		}
+	}
+
+	// every encoded value decodes back
+	decoded := testRecord{}
+	if err := DecodeHash(values, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, record) {
+		t.Errorf("round trip = %+v\nwant %+v", decoded, record)
+	}
+
+	record.Kind = "email"
+	if _, err := EncodeHash(record); err == nil {
+		t.Error("a value out of oneof is encoded")
+	}
+}
+
+func TestHashFieldsOfInvalidTag(t *testing.T) {
+	type repeated struct {
+		A string `redis:"a"`
+		B string `redis:"a"`
+	}
+	type unknown struct {
+		A string `redis:"a,compress"`
+	}
+	if _, err := EncodeHash(repeated{}); err == nil {
+		t.Error("a repeated name is accepted")
+	}
+	if _, err := EncodeHash(unknown{}); err == nil {
+		t.Error("an unknown option is accepted")
+	}
+}
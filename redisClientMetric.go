@@ -0,0 +1,17 @@
+package redis
+
+import "time"
+
+// MetricKeyPrefix starts the keys of the metric records, the rest is the SHA-256 of the metric: hashMetricsData
+// of the entity id, the metric id, the timestamp in UTC RFC 3339 and the value, each field after its length.
+// redis-documentation describes the migration of the keys written before this format.
+const MetricKeyPrefix = "metric:"
+
+// MetricRecord is the Redis hash of one metric, a RecordQueue record until it is inserted into Postgres
+type MetricRecord struct {
+	MetricID        string    `redis:"metric_id"`
+	EntityID        string    `redis:"entity_id"`
+	MetricValue     float64   `redis:"metric_value"`
+	MetricTimestamp time.Time `redis:"metric_timestamp"`
+	CreatedAt       time.Time `redis:"created_at,layout=2006-01-02 15:04:05"`
+}
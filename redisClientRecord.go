@@ -0,0 +1,384 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// RecordState is the state field of a record hash, a record moves NEW → CLAIMED → INSERTED and
+// CLAIMED → FAILED → CLAIMED while it has attempts left
+type RecordState string
+
+const (
+	RecordNew      RecordState = "NEW"
+	RecordClaimed  RecordState = "CLAIMED"
+	RecordInserted RecordState = "INSERTED"
+	RecordFailed   RecordState = "FAILED"
+)
+
+const (
+	DefaultClaimsKey    = "records:claims"
+	DefaultPendingKey   = "records:pending"
+	DefaultLease        = 30 * time.Second
+	DefaultMaxAttempts  = 5
+	DefaultRetryBackoff = 10 * time.Second
+	reapBatchSize       = 100
+)
+
+// ErrLeaseLost is returned when a claim expired and the record was reaped or claimed by another worker
+var ErrLeaseLost = errors.New("record claim lease lost")
+
+// the scripts take the time of the server, so the workers agree on the leases whatever their clocks.
+// A record written before the state field exists is INSERTED when its IsInserted flag is set and NEW otherwise.
+const recordNowLua = `
+redis.replicate_commands()
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+`
+
+// KEYS record, claims, pending  ARGV owner, lease ms, max attempts  → {state, attempts, claimed}
+var claimScript = redis.NewScript(recordNowLua + `
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	redis.call('ZREM', KEYS[3], KEYS[1])
+	return {'', 0, 0}
+end
+local state = redis.call('HGET', KEYS[1], 'state')
+if not state then
+	local inserted = redis.call('HGET', KEYS[1], 'IsInserted')
+	if inserted == 'true' or inserted == '1' then state = 'INSERTED' else state = 'NEW' end
+	redis.call('HSET', KEYS[1], 'state', state)
+end
+local attempts = tonumber(redis.call('HGET', KEYS[1], 'attempts') or '0')
+local claimable = state == 'NEW'
+if state == 'CLAIMED' then
+	claimable = attempts < tonumber(ARGV[3]) and tonumber(redis.call('HGET', KEYS[1], 'lease_until') or '0') <= now
+elseif state == 'FAILED' then
+	claimable = attempts < tonumber(ARGV[3]) and tonumber(redis.call('HGET', KEYS[1], 'retry_at') or '0') <= now
+end
+if not claimable then
+	local exhausted = attempts >= tonumber(ARGV[3])
+	if state == 'CLAIMED' and exhausted and tonumber(redis.call('HGET', KEYS[1], 'lease_until') or '0') <= now then
+		redis.call('HSET', KEYS[1], 'state', 'FAILED', 'last_error', 'claim lease expired')
+		redis.call('HDEL', KEYS[1], 'owner', 'lease_until')
+		redis.call('ZREM', KEYS[2], KEYS[1])
+		state = 'FAILED'
+	end
+	if state == 'INSERTED' or (state == 'FAILED' and exhausted) then
+		redis.call('ZREM', KEYS[3], KEYS[1])
+	end
+	return {state, attempts, 0}
+end
+attempts = attempts + 1
+local leaseUntil = now + tonumber(ARGV[2])
+redis.call('HSET', KEYS[1], 'state', 'CLAIMED', 'owner', ARGV[1], 'lease_until', leaseUntil, 'attempts', attempts)
+redis.call('ZADD', KEYS[2], leaseUntil, KEYS[1])
+redis.call('ZADD', KEYS[3], leaseUntil, KEYS[1])
+return {'CLAIMED', attempts, 1}
+`)
+
+// KEYS record, claims, pending  ARGV owner  → 1 when the owner still held the claim
+var completeScript = redis.NewScript(`
+if redis.call('HGET', KEYS[1], 'state') ~= 'CLAIMED' or redis.call('HGET', KEYS[1], 'owner') ~= ARGV[1] then
+	return 0
+end
+redis.call('HSET', KEYS[1], 'state', 'INSERTED', 'IsInserted', 'true')
+redis.call('HDEL', KEYS[1], 'owner', 'lease_until', 'retry_at', 'last_error')
+redis.call('ZREM', KEYS[2], KEYS[1])
+redis.call('ZREM', KEYS[3], KEYS[1])
+return 1
+`)
+
+// KEYS record, claims, pending  ARGV owner, error, backoff ms, max attempts  → attempts made, -1 when the owner lost the claim
+var failScript = redis.NewScript(recordNowLua + `
+if redis.call('HGET', KEYS[1], 'state') ~= 'CLAIMED' or redis.call('HGET', KEYS[1], 'owner') ~= ARGV[1] then
+	return -1
+end
+local attempts = tonumber(redis.call('HGET', KEYS[1], 'attempts') or '1')
+local retryAt = now + attempts * tonumber(ARGV[3])
+redis.call('HSET', KEYS[1], 'state', 'FAILED', 'last_error', ARGV[2], 'retry_at', retryAt)
+redis.call('HDEL', KEYS[1], 'owner', 'lease_until')
+redis.call('ZREM', KEYS[2], KEYS[1])
+if attempts < tonumber(ARGV[4]) then
+	redis.call('ZADD', KEYS[3], retryAt, KEYS[1])
+else
+	redis.call('ZREM', KEYS[3], KEYS[1])
+end
+return attempts
+`)
+
+// KEYS record, claims, pending  ARGV max attempts  → 1 when an expired claim was requeued or failed
+var reapScript = redis.NewScript(recordNowLua + `
+if redis.call('HGET', KEYS[1], 'state') ~= 'CLAIMED' then
+	redis.call('ZREM', KEYS[2], KEYS[1])
+	return 0
+end
+local leaseUntil = tonumber(redis.call('HGET', KEYS[1], 'lease_until') or '0')
+if leaseUntil > now then
+	redis.call('ZADD', KEYS[2], leaseUntil, KEYS[1])
+	return 0
+end
+if tonumber(redis.call('HGET', KEYS[1], 'attempts') or '0') >= tonumber(ARGV[1]) then
+	redis.call('HSET', KEYS[1], 'state', 'FAILED', 'last_error', 'claim lease expired')
+	redis.call('ZREM', KEYS[3], KEYS[1])
+else
+	redis.call('HSET', KEYS[1], 'state', 'NEW')
+	redis.call('ZADD', KEYS[3], now, KEYS[1])
+end
+redis.call('HDEL', KEYS[1], 'owner', 'lease_until')
+redis.call('ZREM', KEYS[2], KEYS[1])
+return 1
+`)
+
+// KEYS record, pending  ARGV field, value, ...  → 1 when the record was created
+var createScript = redis.NewScript(recordNowLua + `
+if redis.call('EXISTS', KEYS[1]) == 1 then
+	return 0
+end
+redis.call('HSET', KEYS[1], 'state', 'NEW', 'IsInserted', 'false', unpack(ARGV))
+redis.call('ZADD', KEYS[2], now, KEYS[1])
+return 1
+`)
+
+// KEYS record, pending  ARGV max attempts  → 1 when the record was added to pending
+var backfillScript = redis.NewScript(recordNowLua + `
+local state = redis.call('HGET', KEYS[1], 'state')
+if not state then
+	local inserted = redis.call('HGET', KEYS[1], 'IsInserted')
+	if inserted == 'true' or inserted == '1' then state = 'INSERTED' else state = 'NEW' end
+end
+if state == 'INSERTED' then
+	return 0
+end
+if state == 'FAILED' and tonumber(redis.call('HGET', KEYS[1], 'attempts') or '0') >= tonumber(ARGV[1]) then
+	return 0
+end
+return redis.call('ZADD', KEYS[2], 'NX', now, KEYS[1])
+`)
+
+// RecordQueue hands the record hashes to one worker at a time. A claim is a lease: a worker which does not
+// complete or fail the record before it expires loses it, Reap puts it back to NEW, or FAILED once MaxAttempts
+// is reached. ClaimsKey is a sorted set of the claimed records by lease deadline, PendingKey one of the records
+// which are not INSERTED yet by the time they can be claimed, see Due.
+type RecordQueue struct {
+	Client       *Client
+	ClaimsKey    string
+	PendingKey   string
+	Lease        time.Duration
+	MaxAttempts  int
+	RetryBackoff time.Duration
+}
+
+// Claim is the outcome of RecordQueue.Claim, State is empty when there is no such record
+type Claim struct {
+	Key      string
+	Owner    string
+	State    RecordState
+	Attempts int
+	Claimed  bool
+}
+
+// NewRecordQueue returns a queue on client with the default key, lease, attempts and backoff
+func NewRecordQueue(client *Client) *RecordQueue {
+	return &RecordQueue{
+		Client:       client,
+		ClaimsKey:    DefaultClaimsKey,
+		PendingKey:   DefaultPendingKey,
+		Lease:        DefaultLease,
+		MaxAttempts:  DefaultMaxAttempts,
+		RetryBackoff: DefaultRetryBackoff,
+	}
+}
+
+// Create adds the record at key as NEW, it returns false when the key exists
+func (q *RecordQueue) Create(ctx context.Context, key string) (bool, error) {
+	return q.create(ctx, key, nil)
+}
+
+// CreateFrom adds the record at key as NEW with the tagged fields of src, see HSetFrom. It returns false
+// and writes nothing when the key exists, so the first of concurrent writers of a record wins.
+func (q *RecordQueue) CreateFrom(ctx context.Context, key string, src interface{}) (bool, error) {
+	values, err := EncodeHash(src)
+	if err != nil {
+		return false, fmt.Errorf("redis hash %s: %w", key, err)
+	}
+	args := make([]interface{}, 0, 2*len(values))
+	for field, value := range values {
+		args = append(args, field, value)
+	}
+	return q.create(ctx, key, args)
+}
+
+func (q *RecordQueue) create(ctx context.Context, key string, fields []interface{}) (bool, error) {
+	rdb, err := q.Client.rdb()
+	if err != nil {
+		return false, err
+	}
+	created, err := createScript.Run(ctx, rdb, []string{key, q.PendingKey}, fields...).Int()
+	if err != nil {
+		return false, commandError("create record", key, err)
+	}
+	return created == 1, nil
+}
+
+// Claim gives the record at key to owner when it is NEW, FAILED and due for a retry, or CLAIMED with an expired lease.
+// Otherwise Claimed is false and State tells why.
+func (q *RecordQueue) Claim(ctx context.Context, key, owner string) (Claim, error) {
+	claim := Claim{Key: key, Owner: owner}
+	rdb, err := q.Client.rdb()
+	if err != nil {
+		return claim, err
+	}
+	res, err := claimScript.Run(ctx, rdb, []string{key, q.ClaimsKey, q.PendingKey}, owner, q.Lease.Milliseconds(), q.MaxAttempts).Slice()
+	if err != nil {
+		return claim, commandError("claim record", key, err)
+	}
+	if len(res) != 3 {
+		return claim, commandError("claim record", key, fmt.Errorf("unexpected reply %v", res))
+	}
+	state, _ := res[0].(string)
+	attempts, _ := res[1].(int64)
+	claimed, _ := res[2].(int64)
+	claim.State, claim.Attempts, claim.Claimed = RecordState(state), int(attempts), claimed == 1
+	return claim, nil
+}
+
+// Complete marks the claimed record INSERTED, it returns ErrLeaseLost when the claim was lost first.
+// The record may then be handed to another worker, so the work done under a claim must be idempotent.
+func (q *RecordQueue) Complete(ctx context.Context, claim Claim) error {
+	rdb, err := q.Client.rdb()
+	if err != nil {
+		return err
+	}
+	done, err := completeScript.Run(ctx, rdb, []string{claim.Key, q.ClaimsKey, q.PendingKey}, claim.Owner).Int()
+	if err != nil {
+		return commandError("complete record", claim.Key, err)
+	}
+	if done != 1 {
+		return fmt.Errorf("complete record %s: %w", claim.Key, ErrLeaseLost)
+	}
+	return nil
+}
+
+// Fail marks the claimed record FAILED with cause. It is claimed again after RetryBackoff times the attempts
+// made, retry is false once MaxAttempts is reached and the record stays FAILED.
+func (q *RecordQueue) Fail(ctx context.Context, claim Claim, cause error) (retry bool, err error) {
+	rdb, err := q.Client.rdb()
+	if err != nil {
+		return false, err
+	}
+	attempts, err := failScript.Run(ctx, rdb, []string{claim.Key, q.ClaimsKey, q.PendingKey}, claim.Owner, cause.Error(), q.RetryBackoff.Milliseconds(), q.MaxAttempts).Int()
+	if err != nil {
+		return false, commandError("fail record", claim.Key, err)
+	}
+	if attempts < 0 {
+		return false, fmt.Errorf("fail record %s: %w", claim.Key, ErrLeaseLost)
+	}
+	return attempts < q.MaxAttempts, nil
+}
+
+// Reap requeues the records whose claim lease expired and returns how many it changed
+func (q *RecordQueue) Reap(ctx context.Context) (int, error) {
+	rdb, err := q.Client.rdb()
+	if err != nil {
+		return 0, err
+	}
+	reaped := 0
+	for {
+		// the scripts check the lease again with the server time
+		keys, err := rdb.ZRangeByScore(ctx, q.ClaimsKey, &redis.ZRangeBy{
+			Min:   "-inf",
+			Max:   fmt.Sprint(time.Now().UnixMilli()),
+			Count: reapBatchSize,
+		}).Result()
+		if err != nil {
+			return reaped, commandError("zrangebyscore", q.ClaimsKey, err)
+		}
+		batchReaped := 0
+		for _, key := range keys {
+			done, err := reapScript.Run(ctx, rdb, []string{key, q.ClaimsKey, q.PendingKey}, q.MaxAttempts).Int()
+			if err != nil {
+				return reaped, commandError("reap record", key, err)
+			}
+			batchReaped += done
+		}
+		reaped += batchReaped
+		// a batch without an expired lease is left for the next run, the clocks may disagree
+		if len(keys) < reapBatchSize || batchReaped == 0 {
+			return reaped, nil
+		}
+	}
+}
+
+// Due returns up to count pending records which can be claimed now, the oldest first. The new records are due
+// when they are created, the failed ones once their backoff is over and the claimed ones when their lease expires.
+// Claim decides, a due record may have been claimed by another worker in between.
+func (q *RecordQueue) Due(ctx context.Context, count int) ([]string, error) {
+	rdb, err := q.Client.rdb()
+	if err != nil {
+		return nil, err
+	}
+	keys, err := rdb.ZRangeByScore(ctx, q.PendingKey, &redis.ZRangeBy{
+		Min:   "-inf",
+		Max:   fmt.Sprint(time.Now().UnixMilli()),
+		Count: int64(count),
+	}).Result()
+	if err != nil {
+		return nil, commandError("zrangebyscore", q.PendingKey, err)
+	}
+	return keys, nil
+}
+
+// Pending returns how many records are not INSERTED yet, due or not
+func (q *RecordQueue) Pending(ctx context.Context) (int64, error) {
+	rdb, err := q.Client.rdb()
+	if err != nil {
+		return 0, err
+	}
+	pending, err := rdb.ZCard(ctx, q.PendingKey).Result()
+	if err != nil {
+		return 0, commandError("zcard", q.PendingKey, err)
+	}
+	return pending, nil
+}
+
+// Backfill adds to pending the record hashes matching pattern which are not INSERTED, such as the ones
+// written before PendingKey was kept. It returns how many it added, running it again adds nothing new.
+func (q *RecordQueue) Backfill(ctx context.Context, pattern string) (int, error) {
+	rdb, err := q.Client.rdb()
+	if err != nil {
+		return 0, err
+	}
+	added := 0
+	iter := rdb.ScanType(ctx, 0, pattern, reapBatchSize, "hash").Iterator()
+	for iter.Next(ctx) {
+		done, err := backfillScript.Run(ctx, rdb, []string{iter.Val(), q.PendingKey}, q.MaxAttempts).Int()
+		if err != nil {
+			return added, commandError("backfill record", iter.Val(), err)
+		}
+		added += done
+	}
+	if err := iter.Err(); err != nil {
+		return added, commandError("scan", pattern, err)
+	}
+	return added, nil
+}
+
+// RunReaper calls Reap every interval until ctx is done, onError receives the failed runs and may be nil
+func (q *RecordQueue) RunReaper(ctx context.Context, interval time.Duration, onError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := q.Reap(ctx); err != nil && onError != nil && ctx.Err() == nil {
+				onError(err)
+			}
+		}
+	}
+}
@@ -0,0 +1,241 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+func TestNewRecordQueue(t *testing.T) {
+	queue := NewRecordQueue(Default)
+	if queue.ClaimsKey != DefaultClaimsKey || queue.PendingKey != DefaultPendingKey || queue.Lease != DefaultLease || queue.MaxAttempts != DefaultMaxAttempts || queue.RetryBackoff != DefaultRetryBackoff {
+		t.Errorf("queue = %+v, want the defaults", queue)
+	}
+}
+
+func TestRecordQueueErrors(t *testing.T) {
+	ctx := context.Background()
+	queue := NewRecordQueue(&Client{client: func() *redis.Client { return nil }})
+	if _, err := queue.Claim(ctx, "key", "worker"); !errors.Is(err, ErrNotInitialized) {
+		t.Errorf("Claim = %v, want ErrNotInitialized", err)
+	}
+	if _, err := queue.Reap(ctx); !errors.Is(err, ErrNotInitialized) {
+		t.Errorf("Reap = %v, want ErrNotInitialized", err)
+	}
+	if _, err := queue.Due(ctx, 10); !errors.Is(err, ErrNotInitialized) {
+		t.Errorf("Due = %v, want ErrNotInitialized", err)
+	}
+	if _, err := queue.Backfill(ctx, MetricKeyPrefix+"*"); !errors.Is(err, ErrNotInitialized) {
+		t.Errorf("Backfill = %v, want ErrNotInitialized", err)
+	}
+	if created, err := queue.CreateFrom(ctx, "key", "not a struct"); created || err == nil || errors.Is(err, ErrNotInitialized) {
+		t.Errorf("CreateFrom of a string = %t, %v, want an encoding error", created, err)
+	}
+
+	rdb := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1, DialTimeout: time.Second})
+	defer rdb.Close()
+	queue = NewRecordQueue(NewClient(rdb))
+	claim, err := queue.Claim(ctx, "key", "worker")
+	if err == nil || claim.Claimed {
+		t.Errorf("Claim on an unreachable server = %+v, %v", claim, err)
+	}
+	if err := queue.Complete(ctx, Claim{Key: "key", Owner: "worker"}); err == nil || errors.Is(err, ErrLeaseLost) {
+		t.Errorf("Complete on an unreachable server = %v, want the transport error", err)
+	}
+	if _, err := NewClient(rdb).BloomExists(ctx, "filter", "item"); err == nil {
+		t.Error("BloomExists on an unreachable server gives no error")
+	}
+}
+
+func newTestRecordQueue(t *testing.T) (*RecordQueue, *miniredis.Miniredis) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+	return NewRecordQueue(NewClient(rdb)), mr
+}
+
+func TestRecordQueueClaimOnce(t *testing.T) {
+	ctx := context.Background()
+	queue, mr := newTestRecordQueue(t)
+	if created, err := queue.Create(ctx, "record:1"); !created || err != nil {
+		t.Fatalf("Create = %t, %v", created, err)
+	}
+	if created, _ := queue.Create(ctx, "record:1"); created {
+		t.Error("a record is created twice")
+	}
+
+	first, err := queue.Claim(ctx, "record:1", "worker-1")
+	if err != nil || !first.Claimed || first.State != RecordClaimed || first.Attempts != 1 {
+		t.Fatalf("first Claim = %+v, %v", first, err)
+	}
+	second, err := queue.Claim(ctx, "record:1", "worker-2")
+	if err != nil || second.Claimed || second.State != RecordClaimed {
+		t.Errorf("second Claim = %+v, %v, want the record held by worker-1", second, err)
+	}
+	if err := queue.Complete(ctx, Claim{Key: "record:1", Owner: "worker-2"}); !errors.Is(err, ErrLeaseLost) {
+		t.Errorf("Complete by another worker = %v, want ErrLeaseLost", err)
+	}
+	if err := queue.Complete(ctx, first); err != nil {
+		t.Fatal(err)
+	}
+	if mr.HGet("record:1", "state") != string(RecordInserted) || mr.HGet("record:1", "IsInserted") != "true" || mr.HGet("record:1", "owner") != "" {
+		t.Errorf("completed record is %s, IsInserted %s", mr.HGet("record:1", "state"), mr.HGet("record:1", "IsInserted"))
+	}
+	if pending, _ := queue.Pending(ctx); pending != 0 || mr.Exists(queue.ClaimsKey) {
+		t.Errorf("pending = %d, claims kept = %t, want both empty", pending, mr.Exists(queue.ClaimsKey))
+	}
+	if claim, _ := queue.Claim(ctx, "record:1", "worker-2"); claim.Claimed || claim.State != RecordInserted {
+		t.Errorf("Claim of an inserted record = %+v", claim)
+	}
+
+	// a record which is gone leaves pending
+	mr.ZAdd(queue.PendingKey, 1, "record:gone")
+	if claim, err := queue.Claim(ctx, "record:gone", "worker-1"); err != nil || claim.Claimed || claim.State != "" {
+		t.Errorf("Claim of a missing record = %+v, %v", claim, err)
+	}
+	if pending, _ := queue.Pending(ctx); pending != 0 {
+		t.Errorf("pending = %d, want the missing record removed", pending)
+	}
+}
+
+func TestRecordQueueLeaseExpiry(t *testing.T) {
+	ctx := context.Background()
+	queue, _ := newTestRecordQueue(t)
+	queue.Lease = 20 * time.Millisecond
+	queue.Create(ctx, "record:1")
+
+	first, err := queue.Claim(ctx, "record:1", "worker-1")
+	if err != nil || !first.Claimed {
+		t.Fatalf("Claim = %+v, %v", first, err)
+	}
+	if due, _ := queue.Due(ctx, 10); len(due) != 0 {
+		t.Errorf("due = %v, want nothing while the lease holds", due)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if due, _ := queue.Due(ctx, 10); len(due) != 1 {
+		t.Errorf("due = %v, want the record once the lease expired", due)
+	}
+
+	second, err := queue.Claim(ctx, "record:1", "worker-2")
+	if err != nil || !second.Claimed || second.Attempts != 2 {
+		t.Fatalf("Claim after the lease = %+v, %v", second, err)
+	}
+	if err := queue.Complete(ctx, first); !errors.Is(err, ErrLeaseLost) {
+		t.Errorf("Complete of the expired claim = %v, want ErrLeaseLost", err)
+	}
+	if _, err := queue.Fail(ctx, first, errors.New("late")); !errors.Is(err, ErrLeaseLost) {
+		t.Errorf("Fail of the expired claim = %v, want ErrLeaseLost", err)
+	}
+	if err := queue.Complete(ctx, second); err != nil {
+		t.Errorf("Complete of the new claim = %v", err)
+	}
+}
+
+func TestRecordQueueReap(t *testing.T) {
+	ctx := context.Background()
+	queue, mr := newTestRecordQueue(t)
+	queue.Lease, queue.MaxAttempts = 20*time.Millisecond, 2
+	queue.Create(ctx, "record:1")
+
+	queue.Claim(ctx, "record:1", "worker-1")
+	if reaped, err := queue.Reap(ctx); reaped != 0 || err != nil {
+		t.Errorf("Reap of a held lease = %d, %v", reaped, err)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if reaped, err := queue.Reap(ctx); reaped != 1 || err != nil {
+		t.Fatalf("Reap = %d, %v", reaped, err)
+	}
+	if mr.HGet("record:1", "state") != string(RecordNew) || mr.HGet("record:1", "owner") != "" || mr.Exists(queue.ClaimsKey) {
+		t.Errorf("reaped record is %s, want NEW without a claim", mr.HGet("record:1", "state"))
+	}
+	if pending, _ := queue.Pending(ctx); pending != 1 {
+		t.Errorf("pending = %d, want the reaped record", pending)
+	}
+
+	// the last attempt expires too, the record is FAILED for good
+	if claim, _ := queue.Claim(ctx, "record:1", "worker-2"); !claim.Claimed || claim.Attempts != 2 {
+		t.Fatalf("Claim after the reap = %+v", claim)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if reaped, _ := queue.Reap(ctx); reaped != 1 {
+		t.Fatalf("Reap of the last attempt = %d", reaped)
+	}
+	if mr.HGet("record:1", "state") != string(RecordFailed) || mr.HGet("record:1", "last_error") != "claim lease expired" {
+		t.Errorf("record is %s, want FAILED", mr.HGet("record:1", "state"))
+	}
+	if pending, _ := queue.Pending(ctx); pending != 0 {
+		t.Errorf("pending = %d, want the failed record removed", pending)
+	}
+	if claim, _ := queue.Claim(ctx, "record:1", "worker-3"); claim.Claimed || claim.State != RecordFailed {
+		t.Errorf("Claim of a failed record = %+v", claim)
+	}
+}
+
+func TestRecordQueueMaxAttempts(t *testing.T) {
+	ctx := context.Background()
+	queue, mr := newTestRecordQueue(t)
+	queue.RetryBackoff, queue.MaxAttempts = 20*time.Millisecond, 2
+	queue.Create(ctx, "record:1")
+
+	claim, _ := queue.Claim(ctx, "record:1", "worker-1")
+	if retry, err := queue.Fail(ctx, claim, errors.New("insert failed")); !retry || err != nil {
+		t.Fatalf("first Fail = %t, %v, want a retry", retry, err)
+	}
+	if mr.HGet("record:1", "state") != string(RecordFailed) || mr.HGet("record:1", "last_error") != "insert failed" {
+		t.Errorf("failed record is %s", mr.HGet("record:1", "state"))
+	}
+	if again, _ := queue.Claim(ctx, "record:1", "worker-2"); again.Claimed {
+		t.Error("a failed record is claimed before its backoff")
+	}
+	time.Sleep(30 * time.Millisecond)
+	if due, _ := queue.Due(ctx, 10); len(due) != 1 {
+		t.Errorf("due = %v, want the record after its backoff", due)
+	}
+
+	claim, _ = queue.Claim(ctx, "record:1", "worker-2")
+	if !claim.Claimed || claim.Attempts != 2 {
+		t.Fatalf("Claim after the backoff = %+v", claim)
+	}
+	if retry, err := queue.Fail(ctx, claim, errors.New("insert failed")); retry || err != nil {
+		t.Errorf("last Fail = %t, %v, want no retry", retry, err)
+	}
+	if pending, _ := queue.Pending(ctx); pending != 0 {
+		t.Errorf("pending = %d, want the exhausted record removed", pending)
+	}
+	if claim, _ := queue.Claim(ctx, "record:1", "worker-3"); claim.Claimed || claim.State != RecordFailed || claim.Attempts != 2 {
+		t.Errorf("Claim of an exhausted record = %+v", claim)
+	}
+}
+
+func TestRecordQueueLegacyRecords(t *testing.T) {
+	ctx := context.Background()
+	queue, mr := newTestRecordQueue(t)
+	// written by the old processRecord, without a state
+	mr.HSet("record:inserted", "IsInserted", "true")
+	mr.HSet("record:new", "IsInserted", "false")
+	mr.Set("record:string", "not a hash")
+
+	if added, err := queue.Backfill(ctx, "record:*"); added != 1 || err != nil {
+		t.Fatalf("Backfill = %d, %v, want the record not inserted", added, err)
+	}
+	if added, _ := queue.Backfill(ctx, "record:*"); added != 0 {
+		t.Errorf("second Backfill = %d, want nothing new", added)
+	}
+	if due, _ := queue.Due(ctx, 10); len(due) != 1 || due[0] != "record:new" {
+		t.Errorf("due = %v", due)
+	}
+
+	if claim, _ := queue.Claim(ctx, "record:inserted", "worker-1"); claim.Claimed || claim.State != RecordInserted {
+		t.Errorf("Claim of an inserted legacy record = %+v", claim)
+	}
+	if mr.HGet("record:inserted", "state") != string(RecordInserted) {
+		t.Error("the state of the inserted legacy record is not written")
+	}
+	if claim, _ := queue.Claim(ctx, "record:new", "worker-1"); !claim.Claimed || claim.Attempts != 1 {
+		t.Errorf("Claim of a new legacy record = %+v", claim)
+	}
+}
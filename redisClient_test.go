@@ -0,0 +1,137 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+func TestClientNotInitialized(t *testing.T) {
+	client := &Client{client: func() *redis.Client { return nil }}
+	ctx := context.Background()
+
+	if _, found, err := client.GetKey(ctx, "key"); found || !errors.Is(err, ErrNotInitialized) {
+		t.Errorf("GetKey = %t, %v, want ErrNotInitialized", found, err)
+	}
+	if _, found, err := client.SetField(ctx, "key", "field", "value"); found || !errors.Is(err, ErrNotInitialized) {
+		t.Errorf("SetField = %t, %v, want ErrNotInitialized", found, err)
+	}
+	if _, found, err := client.GetHash(ctx, "key"); found || !errors.Is(err, ErrNotInitialized) {
+		t.Errorf("GetHash = %t, %v, want ErrNotInitialized", found, err)
+	}
+}
+
+func TestClientUnreachable(t *testing.T) {
+	rdb := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1, DialTimeout: time.Second})
+	defer rdb.Close()
+	client := NewClient(rdb)
+	ctx := context.Background()
+
+	// a transport error is returned, not reported as a missing key
+	if _, found, err := client.GetField(ctx, "key", "field"); found || err == nil {
+		t.Errorf("GetField = %t, %v, want an error", found, err)
+	}
+	if _, found, err := client.SetKey(ctx, "key", "value", WithTTL(time.Minute)); found || err == nil {
+		t.Errorf("SetKey = %t, %v, want an error", found, err)
+	}
+	if _, found, err := client.SetHash(ctx, "key", map[string]string{"field": "value"}); found || err == nil {
+		t.Errorf("SetHash = %t, %v, want an error", found, err)
+	}
+	if _, _, err := client.SetHash(ctx, "key", nil); err == nil {
+		t.Error("SetHash without fields is accepted")
+	}
+}
+
+func TestWithTTL(t *testing.T) {
+	if o := newCallOptions(nil); o.ttl != 0 {
+		t.Errorf("default ttl = %v, want none", o.ttl)
+	}
+	if o := newCallOptions([]Option{WithTTL(time.Hour)}); o.ttl != time.Hour {
+		t.Errorf("ttl = %v, want 1h", o.ttl)
+	}
+}
+
+func TestSetKey(t *testing.T) {
+	server := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	defer rdb.Close()
+	client := NewClient(rdb)
+	ctx := context.Background()
+
+	if previous, found, err := client.SetKey(ctx, "key", "first", WithTTL(time.Minute)); found || err != nil {
+		t.Fatalf("SetKey of a new key = %q, %t, %v", previous, found, err)
+	}
+	// without a ttl the expiry of the key is kept
+	if previous, found, err := client.SetKey(ctx, "key", "second"); previous != "first" || !found || err != nil {
+		t.Errorf("SetKey = %q, %t, %v, want the first value", previous, found, err)
+	}
+	if value, _ := server.Get("key"); value != "second" || server.TTL("key") != time.Minute {
+		t.Errorf("key = %q with ttl %v, want second with 1m", value, server.TTL("key"))
+	}
+
+	if exists, err := client.Exists(ctx, "key"); !exists || err != nil {
+		t.Errorf("Exists = %t, %v, want true", exists, err)
+	}
+	if exists, err := client.Exists(ctx, "missing"); exists || err != nil {
+		t.Errorf("Exists of a missing key = %t, %v", exists, err)
+	}
+
+	// a key of another type is an error and keeps its value
+	server.HSet("hash", "field", "value")
+	if _, found, err := client.SetKey(ctx, "hash", "value"); found || err == nil {
+		t.Errorf("SetKey of a hash = %t, %v, want an error", found, err)
+	}
+	if server.Type("hash") != "hash" || server.HGet("hash", "field") != "value" {
+		t.Error("SetKey of a hash overwrote it")
+	}
+}
+
+// failExpire fails the expire queued in a transaction, as a server rejecting it would
+type failExpire struct{}
+
+func (failExpire) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	return ctx, nil
+}
+
+func (failExpire) AfterProcess(ctx context.Context, cmd redis.Cmder) error { return nil }
+
+func (failExpire) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	return ctx, nil
+}
+
+func (failExpire) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	for _, cmd := range cmds {
+		if cmd.Name() == "expire" {
+			cmd.SetErr(errors.New("expire rejected"))
+		}
+	}
+	return nil
+}
+
+func TestSetField(t *testing.T) {
+	server := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	defer rdb.Close()
+	client := NewClient(rdb)
+	ctx := context.Background()
+
+	if previous, found, err := client.SetField(ctx, "hash", "field", "first", WithTTL(time.Minute)); found || err != nil {
+		t.Fatalf("SetField of a new field = %q, %t, %v", previous, found, err)
+	}
+	if previous, found, err := client.SetField(ctx, "hash", "field", "second"); previous != "first" || !found || err != nil {
+		t.Errorf("SetField = %q, %t, %v, want the first value", previous, found, err)
+	}
+	if server.HGet("hash", "field") != "second" || server.TTL("hash") != time.Minute {
+		t.Errorf("field = %q with ttl %v, want second with 1m", server.HGet("hash", "field"), server.TTL("hash"))
+	}
+
+	// a failed expire of a new field is returned, not hidden by the missing previous value
+	rdb.AddHook(failExpire{})
+	if _, _, err := client.SetField(ctx, "hash", "other", "value", WithTTL(time.Hour)); err == nil {
+		t.Error("SetField hides the failed expire")
+	}
+}
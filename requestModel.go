@@ -0,0 +1,87 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+//Input of getColumns
+type ColumnsRequest struct {
+	ColumnToStart string `json:"columnToStart" validate:"required,alpha,max=13"`
+	NumRows       int    `json:"numRows" validate:"required,min=1,max=1000"`
+	NumCols       int    `json:"numCols" validate:"required,min=1,max=100"`
+}
+
+//Input of ColumnRangeService, either count or the rows x cols layout
+type ColumnRangeRequest struct {
+	Start string `json:"start" validate:"required,alpha,max=13"`
+	Count int64  `json:"count" validate:"min=0"`
+	Rows  int64  `json:"rows" validate:"min=0,max=1000000"`
+	Cols  int64  `json:"cols" validate:"min=0,max=1000000"`
+}
+
+//Input of ColumnIndexService
+type ColumnIndexRequest struct {
+	Label string `json:"label" query:"label" validate:"required,alpha,max=13"`
+}
+
+//Input of ColumnLabelService
+type ColumnLabelRequest struct {
+	Index int64 `json:"index" query:"index" validate:"required,min=1"`
+}
+
+//Input of GetWordCountService, one of url, text or html is counted
+type WordCountRequest struct {
+	URL          string   `json:"url" validate:"required_without_all=Text HTML,omitempty,url"`
+	Text         string   `json:"text"`
+	HTML         string   `json:"html"`
+	Top          int      `json:"top" validate:"min=0,max=10000"`
+	UseStopwords bool     `json:"useStopwords"`
+	Stopwords    []string `json:"stopwords" validate:"max=1000"`
+}
+
+//Input of GetLastDayOfInputDate
+type LastDayOfDateRequest struct {
+	Date string `json:"Date" validate:"required,datetime=2006-01-02T15:04"`
+}
+
+//Input of GetPrimeNumberListService, the range is [from, to] and number is the older name of to.
+//Pointers so that 0 is told apart from missing
+type PrimeNumberRequest struct {
+	Number    *int64 `json:"number" validate:"omitempty,min=0"`
+	From      int64  `json:"from" validate:"min=0"`
+	To        *int64 `json:"to" validate:"omitempty,min=0"`
+	CountOnly bool   `json:"countOnly"`
+	Stream    bool   `json:"stream"`
+}
+
+//Input of DeleteRecordService
+type DeleteRecordRequest struct {
+	LoginId string `json:"loginId" validate:"required"`
+}
+
+//Input of GetDateInfoService
+type DateInfoRequest struct {
+	Date DateInput `json:"date" query:"date" validate:"required"`
+	Zone string    `json:"zone" query:"zone" validate:"omitempty,timezone"`
+}
+
+//A date given as a JSON string or as epoch seconds in a JSON number
+type DateInput string
+
+func (d *DateInput) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		var value string
+		if err := json.Unmarshal(data, &value); err != nil {
+			return err
+		}
+		*d = DateInput(value)
+		return nil
+	}
+	if _, err := strconv.ParseInt(string(data), 10, 64); err != nil {
+		return fmt.Errorf("date must be a string or whole epoch seconds")
+	}
+	*d = DateInput(data)
+	return nil
+}
@@ -0,0 +1,91 @@
+package validation
+
+import (
+	"TestProject/Server/GolangServer/apperrors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+)
+
+// EchoValidator validates bound request structs against their validate tags
+type EchoValidator struct {
+	validate *validator.Validate
+}
+
+// NewEchoValidator returns the validator to set as echo.Echo.Validator
+func NewEchoValidator() *EchoValidator {
+	validate := validator.New()
+	// report fields by their json name, like getFieldJSONTagName does for gin
+	validate.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			return ""
+		}
+		return name
+	})
+	return &EchoValidator{validate: validate}
+}
+
+// Validate returns a validation error carrying one message per invalid field
+func (v *EchoValidator) Validate(i interface{}) error {
+	err := v.validate.Struct(i)
+	if err == nil {
+		return nil
+	}
+	ve, ok := err.(validator.ValidationErrors)
+	if !ok {
+		return apperrors.Internal(err)
+	}
+	validationErrors := make(map[string]string)
+	for _, fieldError := range ve {
+		validationErrors[fieldError.Field()] = ErrorMessage(fieldError, fieldError.Field())
+	}
+	return apperrors.Validation("invalid request", validationErrors)
+}
+
+// BindAndValidate binds the request into req and validates it, req must be a pointer to a struct
+func BindAndValidate(c echo.Context, req interface{}) error {
+	if err := c.Bind(req); err != nil {
+		return apperrors.Validation("Request data format is not supported", map[string]string{"body": "Request data format is not supported"})
+	}
+	return c.Validate(req)
+}
+
+// ErrorMessage returns the message of a failed validate tag, fieldName is the name the client sent.
+// It is shared by the echo and gin validators so both report the same messages.
+func ErrorMessage(fieldError validator.FieldError, fieldName string) string {
+	switch fieldError.Tag() {
+	case "required", "required_without_all":
+		return fmt.Sprintf("%s is a required field", fieldName)
+	case "min":
+		if isLengthKind(fieldError.Kind()) {
+			return fmt.Sprintf("%s must be at least %s characters long", fieldName, fieldError.Param())
+		}
+		return fmt.Sprintf("%s must be %s or greater", fieldName, fieldError.Param())
+	case "max":
+		if isLengthKind(fieldError.Kind()) {
+			return fmt.Sprintf("%s must be at most %s characters long", fieldName, fieldError.Param())
+		}
+		return fmt.Sprintf("%s must be %s or less", fieldName, fieldError.Param())
+	case "oneof":
+		return fmt.Sprintf("%s must be one of [%s]", fieldName, fieldError.Param())
+	case "datetime":
+		return fmt.Sprintf("%s must be a date in the format %s", fieldName, fieldError.Param())
+	case "timezone":
+		return fmt.Sprintf("%s must be an IANA time zone such as Asia/Kolkata", fieldName)
+	case "url":
+		return fmt.Sprintf("%s must be a valid URL", fieldName)
+	case "alpha":
+		return fmt.Sprintf("%s must contain only letters", fieldName)
+	default:
+		return "Request data format is not supported"
+	}
+}
+
+// min and max count characters or items for these kinds
+func isLengthKind(kind reflect.Kind) bool {
+	return kind == reflect.String || kind == reflect.Slice || kind == reflect.Map || kind == reflect.Array
+}
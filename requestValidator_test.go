@@ -0,0 +1,50 @@
+package validation
+
+import (
+	"TestProject/Server/GolangServer/apperrors"
+	"TestProject/Server/GolangServer/model"
+	"errors"
+	"testing"
+)
+
+func fieldErrors(t *testing.T, err error) map[string]string {
+	var appErr *apperrors.Error
+	if !errors.As(err, &appErr) || appErr.Kind != apperrors.KindValidation {
+		t.Fatalf("expected a validation error but got %v", err)
+	}
+	return appErr.Details.(map[string]string)
+}
+
+func TestValidateMessages(t *testing.T) {
+	v := NewEchoValidator()
+
+	details := fieldErrors(t, v.Validate(&model.ColumnsRequest{ColumnToStart: "ABCDEFGHIJKLMN", NumCols: 500}))
+	want := map[string]string{
+		"columnToStart": "columnToStart must be at most 13 characters long",
+		"numRows":       "numRows is a required field",
+		"numCols":       "numCols must be 100 or less",
+	}
+	for field, message := range want {
+		if details[field] != message {
+			t.Errorf("%s: expected %q but got %q", field, message, details[field])
+		}
+	}
+
+	details = fieldErrors(t, v.Validate(&model.LastDayOfDateRequest{Date: "31/01/2020"}))
+	if details["Date"] != "Date must be a date in the format 2006-01-02T15:04" {
+		t.Errorf("unexpected date message %q", details["Date"])
+	}
+}
+
+func TestValidatePointerField(t *testing.T) {
+	v := NewEchoValidator()
+
+	zero, negative := int64(0), int64(-1)
+	if err := v.Validate(&model.PrimeNumberRequest{Number: &zero}); err != nil {
+		t.Errorf("0 is a valid number, got %v", err)
+	}
+	details := fieldErrors(t, v.Validate(&model.PrimeNumberRequest{Number: &negative}))
+	if details["number"] != "number must be 0 or greater" {
+		t.Errorf("unexpected message %q", details["number"])
+	}
+}
@@ -1,12 +1,11 @@
 package mongo
 
 import (
+	"context"
 	"fmt"
 	"os"
 
-	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
@@ -55,6 +54,7 @@ func getDbDumpCollection(client *mongo.Client, collectionName string) *mongo.Col
 
 // Initialize collection objects
 func configure(client *mongo.Client) {
+	dbClient = client
 	AuditCollection = getCollection(client, "audit")
 	CustomerDevicesCollection = getCollection(client, "customer_devices")
 	CustomerLocationsCollection = getCollection(client, "customer_locations")
@@ -91,6 +91,9 @@ func configure(client *mongo.Client) {
 		"CustomerLegalNoticeMessages":   CustomerLegalNoticeMessages,
 	}
 
+	replaceAuditWriter(newAuditWriter())
+	syncIndexesAtStartup(client)
+	startArchiveSchedule()
 }
 
 // Initialize Db Dump collections objects
@@ -98,58 +101,49 @@ func dbDumpConfigure(client *mongo.Client) {
 	INITCUSTOMERMESSAGES = getDbDumpCollection(client, "init_customer_messages")
 }
 
-// Inserts a single document in given collection
-func InsertOne(collection *mongo.Collection, ctx *gin.Context, document interface{}) (primitive.ObjectID, error) {
+// The helpers take a plain context so the logic code can run outside gin handlers, a *gin.Context still satisfies it.
+// They return the errors classified by classify, branch on them with errors.Is. The single document writes and Count
+// go through Repository, use NewRepository directly for typed results.
 
-	req, err := collection.InsertOne(ctx, document)
-	if err != nil {
-		panic(err)
-	}
-	insertedId := req.InsertedID
-	return insertedId.(primitive.ObjectID), nil
+// Inserts a single document in given collection and returns its _id, it is an ObjectID only when the driver generated it
+func InsertOne(collection *mongo.Collection, ctx context.Context, document interface{}) (interface{}, error) {
+
+	return NewRepository[any](collection).Create(ctx, document)
 }
 
 // Updates a single document in given collection
-func UpdateOne(collection *mongo.Collection, ctx *gin.Context, filter interface{}, update interface{}) error {
+func UpdateOne(collection *mongo.Collection, ctx context.Context, filter interface{}, update interface{}) (UpdateCounts, error) {
 
-	_, err := collection.UpdateOne(ctx, filter, update)
-	if err != nil {
-		panic(err)
-	}
-	return nil
+	return NewRepository[any](collection).Update(ctx, filter, update)
 }
 
 // Find multiple documents based on given filters from given collection
-func Find(collection *mongo.Collection, ctx *gin.Context, filter interface{}, opts *options.FindOptions) (*mongo.Cursor, error) {
+func Find(collection *mongo.Collection, ctx context.Context, filter interface{}, opts *options.FindOptions) (*mongo.Cursor, error) {
 
 	cursor, err := collection.Find(ctx, filter, opts)
 	if err != nil {
-		panic(err)
+		return nil, classify("find", err)
 	}
-	return cursor, err
+	return cursor, nil
 }
 
 // Finds a single document from given collection
-func FindOne(collection *mongo.Collection, ctx *gin.Context, filter interface{}, opts ...*options.FindOneOptions) *mongo.SingleResult {
+func FindOne(collection *mongo.Collection, ctx context.Context, filter interface{}, opts ...*options.FindOneOptions) *mongo.SingleResult {
 
 	result := collection.FindOne(ctx, filter, opts...)
 	return result
 }
 
 // Return count of documents from given collection
-func Count(collection *mongo.Collection, ctx *gin.Context, filter interface{}) (int64, error) {
+func Count(collection *mongo.Collection, ctx context.Context, filter interface{}) (int64, error) {
 
-	count, err := collection.CountDocuments(ctx, filter)
-	if err != nil {
-		panic(err)
-	}
-	return count, err
+	return NewRepository[any](collection).Count(ctx, filter)
 }
 
 // FindOne retrieves a document from the collection by its ID with projection.
 // It takes the document ID as input, a projection filter, and a pointer to the variable where the result will be stored.
-// It returns an error if the document is not found or any other error occurs.
-func FindOneWithProjection(collection *mongo.Collection, ctx *gin.Context, filter bson.M, projection bson.M, doc interface{}) error {
+// It returns ErrDocumentNotFound if the document is not found or a classified error if any other error occurs.
+func FindOneWithProjection(collection *mongo.Collection, ctx context.Context, filter bson.M, projection bson.M, doc interface{}) error {
 
 	// Create options for projection
 	opts := options.FindOne().SetProjection(projection)
@@ -160,7 +154,7 @@ func FindOneWithProjection(collection *mongo.Collection, ctx *gin.Context, filte
 		if err == mongo.ErrNoDocuments {
 			return ErrDocumentNotFound
 		}
-		return err
+		return classify("find one", err)
 	}
 
 	return nil
@@ -169,43 +163,48 @@ func FindOneWithProjection(collection *mongo.Collection, ctx *gin.Context, filte
 // Find retrieves documents from the collection based on the provided filter and projection.
 // It takes a filter, projection, and a pointer to a slice where the results will be stored.
 // It returns an error if the find operation fails.
-func FindWithProjection(collection interface{}, ctx *gin.Context, filter bson.M, projection bson.M, results interface{}) error {
+func FindWithProjection(collection interface{}, ctx context.Context, filter bson.M, projection bson.M, results interface{}) error {
 
 	// Create options for projection
 	opts := options.Find().SetProjection(projection)
 
+	coll, ok := collection.(*mongo.Collection)
+	if !ok {
+		return fmt.Errorf("collection is a %T, not a *mongo.Collection", collection)
+	}
+
 	// Find documents with projection and decode them into the provided results variable
-	cur, err := collection.(*mongo.Collection).Find(ctx, filter, opts)
+	cur, err := coll.Find(ctx, filter, opts)
 	if err != nil {
-		return err
+		return classify("find", err)
 	}
 
 	// Decode the results into the provided variable
 	if err := cur.All(ctx, results); err != nil {
-		return err
+		return classify("find", err)
 	}
 
 	return nil
 }
 
 // Updates a Many documents in given collection
-func UpdateMany(collection *mongo.Collection, ctx *gin.Context, filter interface{}, update interface{}) error {
+func UpdateMany(collection *mongo.Collection, ctx context.Context, filter interface{}, update interface{}) (UpdateCounts, error) {
 
-	_, err := collection.UpdateMany(ctx, filter, update)
+	res, err := collection.UpdateMany(ctx, filter, update)
 	if err != nil {
-		panic(err)
+		return UpdateCounts{}, classify("update many", err)
 	}
-	return nil
+	return updateCounts(res), nil
 }
 
 // BulkInsert inserts multiple documents into the collection using InsertMany.
-// It takes a gin.Context, a slice of documents, and the collection where they should be inserted.
+// It takes a context, a slice of documents, and the collection where they should be inserted.
 // It returns an error if the insert operation fails.
-func BulkInsert(ctx *gin.Context, collection *mongo.Collection, documents []interface{}) error {
+func BulkInsert(ctx context.Context, collection *mongo.Collection, documents []interface{}) error {
 	// Perform the bulk insert operation
 	_, err := collection.InsertMany(ctx, documents)
 	if err != nil {
-		return err
+		return classify("bulk insert", err)
 	}
 
 	return nil
@@ -0,0 +1,324 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"digi-data-ingestion-client/utils/logger"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// collection of MONGO_DB_DUMP holding the progress of the unfinished archive runs
+	archiveCheckpointCollection = "archive_checkpoints"
+	defaultArchiveBatchSize     = 500
+	// dates stored as text, like docs_last_updated_datetime, use this layout in local time
+	archiveDateLayout = "2006-01-02 15:04:05"
+	// only text in archiveDateLayout is compared with the text cutoff, "" or "N/A" also sort before it
+	archiveDatePattern = `^[0-9]{4}-[0-9]{2}-[0-9]{2} [0-9]{2}:[0-9]{2}:[0-9]{2}$`
+	minArchiveInterval = time.Minute
+)
+
+var (
+	archiveMutex sync.Mutex
+	// stops the schedule of startArchiveSchedule, nil when archiving is off
+	stopArchive func()
+)
+
+// ErrArchiveVerify is the class of the error returned when the dump does not hold every document of a batch,
+// the batch is then left in the source
+var ErrArchiveVerify = errors.New("archived documents are missing from the dump")
+
+// ArchiveSpec moves the documents of Collection whose DateField is older than OlderThan from MONGO_DB to the
+// collection of the same name in MONGO_DB_DUMP. DateField may hold a date or a text date in archiveDateLayout.
+type ArchiveSpec struct {
+	Collection string
+	DateField  string
+	OlderThan  time.Duration
+}
+
+// ArchiveConfig is what RunArchive moves, read it with ArchiveConfigFromEnv
+type ArchiveConfig struct {
+	Specs     []ArchiveSpec
+	BatchSize int
+	DryRun    bool
+}
+
+// ArchiveResult is the outcome of archiving one collection. Copied and Deleted include the batches of the
+// interrupted run it resumed, a dry run only reports Pending.
+type ArchiveResult struct {
+	Collection string    `json:"collection"`
+	Cutoff     time.Time `json:"cutoff"`
+	Pending    int64     `json:"pending"`
+	Copied     int64     `json:"copied"`
+	Deleted    int64     `json:"deleted"`
+	Resumed    bool      `json:"resumed"`
+	DryRun     bool      `json:"dry_run"`
+}
+
+// progress of an archive run, the cutoff is kept so a resumed run moves the same documents
+type archiveCheckpoint struct {
+	Collection string      `bson:"_id"`
+	Cutoff     time.Time   `bson:"cutoff"`
+	LastID     interface{} `bson:"last_id,omitempty"`
+	Copied     int64       `bson:"copied"`
+	Deleted    int64       `bson:"deleted"`
+	UpdatedAt  time.Time   `bson:"updated_at"`
+}
+
+// ArchiveConfigFromEnv reads MONGO_ARCHIVE_COLLECTIONS, a comma separated list of collection=date_field,
+// MONGO_ARCHIVE_OLDER_THAN_DAYS, MONGO_ARCHIVE_BATCH_SIZE and MONGO_ARCHIVE_DRY_RUN
+func ArchiveConfigFromEnv() (ArchiveConfig, error) {
+	config := ArchiveConfig{BatchSize: defaultArchiveBatchSize, DryRun: os.Getenv("MONGO_ARCHIVE_DRY_RUN") == "true"}
+
+	days, err := strconv.Atoi(os.Getenv("MONGO_ARCHIVE_OLDER_THAN_DAYS"))
+	if err != nil || days < 1 {
+		return config, fmt.Errorf("MONGO_ARCHIVE_OLDER_THAN_DAYS must be a number of days from 1")
+	}
+	if batchSize := os.Getenv("MONGO_ARCHIVE_BATCH_SIZE"); batchSize != "" {
+		config.BatchSize, err = strconv.Atoi(batchSize)
+		if err != nil || config.BatchSize < 1 {
+			return config, fmt.Errorf("MONGO_ARCHIVE_BATCH_SIZE must be a number from 1")
+		}
+	}
+	for _, entry := range strings.Split(os.Getenv("MONGO_ARCHIVE_COLLECTIONS"), ",") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" || strings.TrimSpace(parts[1]) == "" {
+			return config, fmt.Errorf("MONGO_ARCHIVE_COLLECTIONS entry %q is not collection=date_field", entry)
+		}
+		config.Specs = append(config.Specs, ArchiveSpec{
+			Collection: strings.TrimSpace(parts[0]),
+			DateField:  strings.TrimSpace(parts[1]),
+			OlderThan:  time.Duration(days) * 24 * time.Hour,
+		})
+	}
+	if len(config.Specs) == 0 {
+		return config, fmt.Errorf("MONGO_ARCHIVE_COLLECTIONS is required")
+	}
+	return config, nil
+}
+
+// RunArchive archives the collections of config one after the other and stops at the first error,
+// running it again resumes from the last batch done
+func RunArchive(ctx context.Context, config ArchiveConfig) ([]ArchiveResult, error) {
+	results := []ArchiveResult{}
+	for _, spec := range config.Specs {
+		result, err := Archive(ctx, spec, config.BatchSize, config.DryRun)
+		results = append(results, result)
+		if err != nil {
+			return results, err
+		}
+		logger.Info(fmt.Sprintf("archive %s: pending %d, copied %d, deleted %d, dry run %t",
+			result.Collection, result.Pending, result.Copied, result.Deleted, result.DryRun))
+	}
+	return results, nil
+}
+
+// startArchiveSchedule runs RunArchive with the config of ArchiveConfigFromEnv at start and then every
+// MONGO_ARCHIVE_INTERVAL, like 24h. Archiving is off when it is not set, a failed run is logged and the next one
+// resumes it. It replaces the schedule of a previous configure.
+func startArchiveSchedule() {
+	archiveMutex.Lock()
+	defer archiveMutex.Unlock()
+	if stopArchive != nil {
+		stopArchive()
+		stopArchive = nil
+	}
+
+	interval := os.Getenv("MONGO_ARCHIVE_INTERVAL")
+	if interval == "" {
+		return
+	}
+	every, err := time.ParseDuration(interval)
+	if err != nil || every < minArchiveInterval {
+		logger.Error(fmt.Errorf("MONGO_ARCHIVE_INTERVAL must be a duration from %s", minArchiveInterval), "archive is not scheduled")
+		return
+	}
+	config, err := ArchiveConfigFromEnv()
+	if err != nil {
+		logger.Error(err, "archive is not scheduled")
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(every)
+		defer ticker.Stop()
+		for {
+			if _, err := RunArchive(ctx, config); err != nil && ctx.Err() == nil {
+				logger.Error(err, "failed while archiving")
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	stopArchive = func() {
+		cancel()
+		<-done
+	}
+}
+
+// StopArchive stops the archive schedule and waits for a running batch, the next run resumes the collection
+func StopArchive() {
+	archiveMutex.Lock()
+	defer archiveMutex.Unlock()
+	if stopArchive != nil {
+		stopArchive()
+		stopArchive = nil
+	}
+}
+
+// Archive moves the documents of spec in batches of batchSize, ordered by _id. Every batch is upserted into the dump,
+// counted there and only then deleted from the source, with its checkpoint in the same transaction, so archiving needs
+// a replica set. A run interrupted at any point is resumed by the next one with the same cutoff, the checkpoint is
+// removed once nothing is left.
+func Archive(ctx context.Context, spec ArchiveSpec, batchSize int, dryRun bool) (ArchiveResult, error) {
+	result := ArchiveResult{Collection: spec.Collection, DryRun: dryRun}
+	if dbClient == nil {
+		return result, ErrNoClient
+	}
+	if batchSize <= 0 {
+		batchSize = defaultArchiveBatchSize
+	}
+	source := getCollection(dbClient, spec.Collection)
+	dump := getDbDumpCollection(dbClient, spec.Collection)
+	checkpoints := getDbDumpCollection(dbClient, archiveCheckpointCollection)
+
+	checkpoint := archiveCheckpoint{}
+	err := checkpoints.FindOne(ctx, bson.M{"_id": spec.Collection}).Decode(&checkpoint)
+	switch {
+	case err == nil:
+		result.Resumed = true
+	case errors.Is(err, mongo.ErrNoDocuments):
+		// the database keeps milliseconds, the resumed cutoff must be the same
+		checkpoint = archiveCheckpoint{Collection: spec.Collection, Cutoff: time.Now().Add(-spec.OlderThan).UTC().Truncate(time.Millisecond)}
+	default:
+		return result, classify("archive checkpoint", err)
+	}
+	result.Cutoff, result.Copied, result.Deleted = checkpoint.Cutoff, checkpoint.Copied, checkpoint.Deleted
+
+	result.Pending, err = source.CountDocuments(ctx, spec.filter(checkpoint.Cutoff, checkpoint.LastID))
+	if err != nil {
+		return result, classify("archive count "+spec.Collection, err)
+	}
+	if dryRun {
+		return result, nil
+	}
+
+	findOptions := options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}).SetLimit(int64(batchSize))
+	for {
+		// the batch is read, copied, deleted and checkpointed in one transaction. A document updated after
+		// the read fails the delete with a write conflict, and WithTransaction reads the batch again.
+		var documents []bson.Raw
+		next := checkpoint
+		err := WithTransaction(ctx, func(txCtx context.Context) error {
+			cursor, err := source.Find(txCtx, spec.filter(checkpoint.Cutoff, checkpoint.LastID), findOptions)
+			if err != nil {
+				return classify("archive find "+spec.Collection, err)
+			}
+			documents = []bson.Raw{}
+			if err := cursor.All(txCtx, &documents); err != nil {
+				return classify("archive find "+spec.Collection, err)
+			}
+			if len(documents) == 0 {
+				return nil
+			}
+
+			copied, deleted, err := archiveBatch(txCtx, source, dump, documents)
+			if err != nil {
+				return err
+			}
+			next = checkpoint
+			next.LastID = documents[len(documents)-1].Lookup("_id")
+			next.Copied += copied
+			next.Deleted += deleted
+			next.UpdatedAt = time.Now().UTC()
+			if _, err := checkpoints.ReplaceOne(txCtx, bson.M{"_id": spec.Collection}, next, options.Replace().SetUpsert(true)); err != nil {
+				return classify("archive checkpoint", err)
+			}
+			return nil
+		})
+		if err != nil {
+			return result, err
+		}
+		if len(documents) == 0 {
+			break
+		}
+		checkpoint = next
+		result.Copied, result.Deleted = checkpoint.Copied, checkpoint.Deleted
+
+		if len(documents) < batchSize {
+			break
+		}
+	}
+
+	if _, err := checkpoints.DeleteOne(ctx, bson.M{"_id": spec.Collection}); err != nil {
+		return result, classify("archive checkpoint", err)
+	}
+	return result, nil
+}
+
+// archiveBatch upserts documents into dump, checks the dump holds all of them and deletes them from source.
+// The upsert by _id lets a batch interrupted before its delete be copied again.
+func archiveBatch(ctx context.Context, source, dump *mongo.Collection, documents []bson.Raw) (int64, int64, error) {
+	ids := make([]interface{}, 0, len(documents))
+	models := make([]mongo.WriteModel, 0, len(documents))
+	for _, document := range documents {
+		id := document.Lookup("_id")
+		ids = append(ids, id)
+		models = append(models, mongo.NewReplaceOneModel().SetFilter(bson.M{"_id": id}).SetReplacement(document).SetUpsert(true))
+	}
+	if _, err := dump.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false)); err != nil {
+		return 0, 0, classify("archive copy "+dump.Name(), err)
+	}
+
+	byID := bson.M{"_id": bson.M{"$in": ids}}
+	archived, err := dump.CountDocuments(ctx, byID)
+	if err != nil {
+		return 0, 0, classify("archive verify "+dump.Name(), err)
+	}
+	if archived != int64(len(ids)) {
+		return 0, 0, &Error{
+			Op:    "archive verify " + dump.Name(),
+			Class: ErrArchiveVerify,
+			Err:   fmt.Errorf("%d of %d documents found", archived, len(ids)),
+		}
+	}
+
+	res, err := source.DeleteMany(ctx, byID)
+	if err != nil {
+		return archived, 0, classify("archive delete "+source.Name(), err)
+	}
+	return archived, res.DeletedCount, nil
+}
+
+// filter matches the documents older than cutoff after lastID, the date field is compared as a date and as
+// a text date since a $lt only matches values of its own type. The text has to be in archiveDateLayout,
+// other text is left in the source.
+func (spec ArchiveSpec) filter(cutoff time.Time, lastID interface{}) bson.M {
+	filter := bson.M{"$or": bson.A{
+		bson.M{spec.DateField: bson.M{"$lt": cutoff}},
+		bson.M{spec.DateField: bson.M{"$lt": cutoff.Local().Format(archiveDateLayout), "$regex": archiveDatePattern}},
+	}}
+	if lastID != nil {
+		filter["_id"] = bson.M{"$gt": lastID}
+	}
+	return filter
+}
@@ -0,0 +1,111 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestArchiveConfigFromEnv(t *testing.T) {
+	t.Setenv("MONGO_ARCHIVE_COLLECTIONS", "customer_messages=created_at, customer_apps = docs_last_updated_datetime,")
+	t.Setenv("MONGO_ARCHIVE_OLDER_THAN_DAYS", "90")
+	t.Setenv("MONGO_ARCHIVE_BATCH_SIZE", "200")
+	t.Setenv("MONGO_ARCHIVE_DRY_RUN", "true")
+
+	config, err := ArchiveConfigFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ArchiveSpec{
+		{Collection: "customer_messages", DateField: "created_at", OlderThan: 90 * 24 * time.Hour},
+		{Collection: "customer_apps", DateField: "docs_last_updated_datetime", OlderThan: 90 * 24 * time.Hour},
+	}
+	if len(config.Specs) != len(want) || config.Specs[0] != want[0] || config.Specs[1] != want[1] {
+		t.Errorf("specs = %+v, want %+v", config.Specs, want)
+	}
+	if config.BatchSize != 200 || !config.DryRun {
+		t.Errorf("batch size, dry run = %d, %t", config.BatchSize, config.DryRun)
+	}
+
+	for key, value := range map[string]string{
+		"MONGO_ARCHIVE_COLLECTIONS":     "customer_messages",
+		"MONGO_ARCHIVE_OLDER_THAN_DAYS": "0",
+		"MONGO_ARCHIVE_BATCH_SIZE":      "many",
+	} {
+		t.Run(key, func(t *testing.T) {
+			t.Setenv(key, value)
+			if _, err := ArchiveConfigFromEnv(); err == nil {
+				t.Errorf("%s=%s is accepted", key, value)
+			}
+		})
+	}
+}
+
+func TestArchiveSpecFilter(t *testing.T) {
+	cutoff := time.Date(2024, 1, 2, 3, 4, 5, 0, time.Local)
+	spec := ArchiveSpec{Collection: "customer_messages", DateField: "created_at"}
+
+	filter := spec.filter(cutoff, nil)
+	if _, ok := filter["_id"]; ok {
+		t.Error("a first run filters on _id")
+	}
+	branches := filter["$or"].(bson.A)
+	text := branches[1].(bson.M)["created_at"].(bson.M)
+	if branches[0].(bson.M)["created_at"].(bson.M)["$lt"] != cutoff || text["$lt"] != "2024-01-02 03:04:05" {
+		t.Errorf("filter = %v, want the cutoff as a date and as text", filter)
+	}
+	// text sorting before the cutoff but not in archiveDateLayout is not archived
+	pattern := regexp.MustCompile(text["$regex"].(string))
+	for value, want := range map[string]bool{
+		"2023-12-31 23:59:59":  true,
+		"":                     false,
+		"N/A":                  false,
+		"01/02/2024":           false,
+		"2023-12-31":           false,
+		"2023-12-31 23:59:59x": false,
+	} {
+		if pattern.MatchString(value) != want {
+			t.Errorf("text date %q matched = %t, want %t", value, !want, want)
+		}
+	}
+
+	filter = spec.filter(cutoff, "last")
+	if filter["_id"].(bson.M)["$gt"] != "last" {
+		t.Errorf("resumed filter = %v, want the documents after the checkpoint", filter)
+	}
+}
+
+func TestArchiveWithoutClient(t *testing.T) {
+	if _, err := Archive(context.Background(), ArchiveSpec{Collection: "customer_messages"}, 10, true); !errors.Is(err, ErrNoClient) {
+		t.Errorf("Archive without a client = %v", err)
+	}
+}
+
+func TestArchiveSchedule(t *testing.T) {
+	t.Setenv("MONGO_ARCHIVE_COLLECTIONS", "customer_messages=created_at")
+	t.Setenv("MONGO_ARCHIVE_OLDER_THAN_DAYS", "90")
+	for _, interval := range []string{"", "daily", "1s"} {
+		t.Setenv("MONGO_ARCHIVE_INTERVAL", interval)
+		startArchiveSchedule()
+		if stopArchive != nil {
+			StopArchive()
+			t.Errorf("MONGO_ARCHIVE_INTERVAL=%q schedules the archive", interval)
+		}
+	}
+
+	// without a client every run fails and the schedule keeps going until it is stopped
+	t.Setenv("MONGO_ARCHIVE_INTERVAL", "1h")
+	startArchiveSchedule()
+	if stopArchive == nil {
+		t.Fatal("the archive is not scheduled")
+	}
+	startArchiveSchedule()
+	StopArchive()
+	if stopArchive != nil {
+		t.Error("the schedule is not stopped")
+	}
+}
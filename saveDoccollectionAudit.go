@@ -0,0 +1,91 @@
+package mongo
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"digi-data-ingestion-client/audit"
+	"digi-data-ingestion-client/utils/logger"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// how long a writer replaced by configure has to store its buffered entries
+const auditCloseTimeout = 10 * time.Second
+
+var (
+	auditWriterMutex sync.RWMutex
+	auditWriter      *audit.Writer
+)
+
+// newAuditWriter returns a writer on AuditCollection logging the failed writes
+func newAuditWriter() *audit.Writer {
+	collection := func() (*mongo.Collection, error) { return AuditCollection, nil }
+	return audit.NewWriter(collection, audit.DefaultBufferSize, func(err error) {
+		logger.Error(classify("write audit entries", err), "failed while writing the audit entries")
+	})
+}
+
+// replaceAuditWriter sets w and closes the previous writer in the background, so its buffered entries are
+// written and its goroutine ends without holding up configure
+func replaceAuditWriter(w *audit.Writer) {
+	previous := SetAuditWriter(w)
+	if previous == nil {
+		return
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), auditCloseTimeout)
+		defer cancel()
+		if err := previous.Close(ctx); err != nil {
+			logger.Error(err, "failed while closing the replaced audit writer")
+		}
+	}()
+}
+
+// SetAuditWriter makes w the writer of RecordAudit and returns the previous one,
+// which the caller closes
+func SetAuditWriter(w *audit.Writer) *audit.Writer {
+	auditWriterMutex.Lock()
+	defer auditWriterMutex.Unlock()
+	previous := auditWriter
+	auditWriter = w
+	return previous
+}
+
+func defaultAuditWriter() *audit.Writer {
+	auditWriterMutex.RLock()
+	defer auditWriterMutex.RUnlock()
+	return auditWriter
+}
+
+// RecordAudit queues entry on the writer set by SetAuditWriter, it returns false when there is none or the entry was dropped
+func RecordAudit(ctx context.Context, entry audit.Entry) bool {
+	w := defaultAuditWriter()
+	if w == nil {
+		return false
+	}
+	return w.Record(ctx, entry)
+}
+
+// AuditHistory returns one page of the entries of a record from AuditCollection, the latest first
+func AuditHistory(ctx context.Context, collection, recordID string, page Page) ([]audit.Entry, error) {
+	if AuditCollection == nil {
+		return nil, ErrNoClient
+	}
+	return NewRepository[audit.Entry](AuditCollection).List(ctx, ListOptions{
+		Filter: bson.M{"collection": collection, "record_id": recordID},
+		Sort:   bson.D{{Key: "at", Value: -1}, {Key: "_id", Value: -1}},
+		Page:   page,
+	})
+}
+
+// CloseAuditWriter closes the writer set by SetAuditWriter, see audit.Writer.Close
+func CloseAuditWriter(ctx context.Context) error {
+	w := SetAuditWriter(nil)
+	if w == nil {
+		return nil
+	}
+	return w.Close(ctx)
+}
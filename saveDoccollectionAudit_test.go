@@ -0,0 +1,47 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"digi-data-ingestion-client/audit"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestAuditWithoutConfigure(t *testing.T) {
+	ctx := audit.WithActor(context.Background(), "admin", "req-1", false)
+	if RecordAudit(ctx, audit.Entry{}) {
+		t.Error("RecordAudit without a writer accepts entries")
+	}
+	if _, err := AuditHistory(ctx, "customers", "ref", Page{}); !errors.Is(err, ErrNoClient) {
+		t.Errorf("AuditHistory without a client = %v", err)
+	}
+}
+
+func TestReplaceAuditWriterClosesPrevious(t *testing.T) {
+	collection := func() (*mongo.Collection, error) { return nil, errors.New("no database") }
+	previous := audit.NewWriter(collection, 1, nil)
+	replaceAuditWriter(previous)
+	replaceAuditWriter(audit.NewWriter(collection, 1, nil))
+	defer CloseAuditWriter(context.Background())
+
+	// the previous writer is closed in the background
+	deadline := time.Now().Add(time.Second)
+	for previous.Record(context.Background(), audit.Entry{}) {
+		if time.Now().After(deadline) {
+			t.Fatal("the replaced writer is not closed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	// a full buffer drops too, it is written at once
+	time.Sleep(50 * time.Millisecond)
+	if previous.Record(context.Background(), audit.Entry{}) {
+		t.Error("the replaced writer accepts entries")
+	}
+	if !RecordAudit(context.Background(), audit.Entry{}) {
+		t.Error("the new writer does not accept entries")
+	}
+}
@@ -0,0 +1,98 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Classes of the errors returned by the helpers, test them with errors.Is
+var (
+	ErrDuplicateKey  = errors.New("duplicate key")
+	ErrWriteConflict = errors.New("write conflict")
+	ErrTimeout       = errors.New("operation timed out")
+	ErrNetwork       = errors.New("network error")
+	ErrValidation    = errors.New("document failed validation")
+)
+
+// server error codes which are not covered by the driver helpers
+const (
+	writeConflictCode             = 112
+	documentValidationFailureCode = 121
+)
+
+// Error is a failed operation, errors.Is matches both its class and the driver error
+type Error struct {
+	Op    string
+	Class error
+	Err   error
+}
+
+func (e *Error) Error() string {
+	if e.Class == nil {
+		return "mongo " + e.Op + ": " + e.Err.Error()
+	}
+	return "mongo " + e.Op + ": " + e.Class.Error() + ": " + e.Err.Error()
+}
+
+// Unwrap returns the driver error
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is the class of e
+func (e *Error) Is(target error) bool {
+	return e.Class != nil && target == e.Class
+}
+
+// UpdateCounts is the outcome of an update helper
+type UpdateCounts struct {
+	Matched    int64
+	Modified   int64
+	Upserted   int64
+	UpsertedID interface{}
+}
+
+func updateCounts(res *mongo.UpdateResult) UpdateCounts {
+	if res == nil {
+		return UpdateCounts{}
+	}
+	return UpdateCounts{
+		Matched:    res.MatchedCount,
+		Modified:   res.ModifiedCount,
+		Upserted:   res.UpsertedCount,
+		UpsertedID: res.UpsertedID,
+	}
+}
+
+// classify wraps err of the operation op with its class, nil and errors classified already are returned as they are
+func classify(op string, err error) error {
+	var classified *Error
+	if err == nil || errors.As(err, &classified) {
+		return err
+	}
+	return &Error{Op: op, Class: errorClass(err), Err: err}
+}
+
+func errorClass(err error) error {
+	var serverError mongo.ServerError
+	isServerError := errors.As(err, &serverError)
+	switch {
+	case errors.Is(err, mongo.ErrNoDocuments):
+		return ErrDocumentNotFound
+	case mongo.IsDuplicateKeyError(err):
+		return ErrDuplicateKey
+	case isServerError && serverError.HasErrorCode(writeConflictCode):
+		return ErrWriteConflict
+	case mongo.IsTimeout(err), errors.Is(err, context.DeadlineExceeded):
+		return ErrTimeout
+	case mongo.IsNetworkError(err):
+		return ErrNetwork
+	case isServerError && serverError.HasErrorCode(documentValidationFailureCode),
+		errors.Is(err, mongo.ErrNilDocument), errors.Is(err, mongo.ErrEmptySlice), errors.Is(err, mongo.ErrNilValue):
+		return ErrValidation
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,51 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestClassify(t *testing.T) {
+	duplicate := mongo.WriteException{WriteErrors: []mongo.WriteError{{Code: 11000, Message: "E11000 duplicate key"}}}
+	cases := []struct {
+		name  string
+		err   error
+		class error
+	}{
+		{"duplicate key", duplicate, ErrDuplicateKey},
+		{"write conflict", mongo.CommandError{Code: 112, Name: "WriteConflict"}, ErrWriteConflict},
+		{"deadline", fmt.Errorf("count: %w", context.DeadlineExceeded), ErrTimeout},
+		{"network", mongo.CommandError{Labels: []string{"NetworkError"}}, ErrNetwork},
+		{"schema validation", mongo.WriteException{WriteErrors: []mongo.WriteError{{Code: 121}}}, ErrValidation},
+		{"nil document", mongo.ErrNilDocument, ErrValidation},
+		{"no documents", mongo.ErrNoDocuments, ErrDocumentNotFound},
+	}
+	for _, c := range cases {
+		err := classify("test", c.err)
+		if !errors.Is(err, c.class) {
+			t.Errorf("%s: errors.Is(%v, %v) = false", c.name, err, c.class)
+		}
+		var mongoErr *Error
+		if !errors.As(err, &mongoErr) || mongoErr.Op != "test" || errors.Unwrap(err) == nil {
+			t.Errorf("%s: the driver error is not wrapped", c.name)
+		}
+	}
+
+	if err := classify("test", mongo.ErrNilDocument); !errors.Is(err, mongo.ErrNilDocument) {
+		t.Errorf("errors.Is does not match the driver error of %v", err)
+	}
+
+	err := classify("test", errors.New("unknown"))
+	for _, class := range []error{ErrDuplicateKey, ErrWriteConflict, ErrTimeout, ErrNetwork, ErrValidation, ErrDocumentNotFound} {
+		if errors.Is(err, class) {
+			t.Errorf("an unknown error matches %v", class)
+		}
+	}
+	if classify("test", nil) != nil {
+		t.Error("classify(nil) is not nil")
+	}
+}
@@ -0,0 +1,409 @@
+package mongo
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"digi-data-ingestion-client/utils/logger"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// listIndexes fails with it on a collection which does not exist
+	namespaceNotFoundCode = 26
+	indexSyncTimeout      = 2 * time.Minute
+)
+
+// IndexSpec declares one index of a collection, indexes are matched to the database by Name
+type IndexSpec struct {
+	Name string
+	Keys bson.D
+	// Unique indexes are only created once no two documents share the keys, see createIndex
+	Unique bool
+	// TTL removes the documents this long after the date in the single key, zero means no expiry
+	TTL time.Duration
+	// Partial only indexes the documents matching this filter
+	Partial bson.D
+}
+
+// IndexSyncMode tells SyncIndexes what to change
+type IndexSyncMode int
+
+const (
+	// IndexDryRun only reports the diff
+	IndexDryRun IndexSyncMode = iota
+	// IndexCreate creates the missing indexes and reports the changed ones
+	IndexCreate
+	// IndexRebuild also drops and creates the changed indexes again. The collection has no such index in between,
+	// a unique one does not hold and a query using it scans, so it is only done when asked for.
+	IndexRebuild
+)
+
+// indexSyncModeFromEnv reads MONGO_INDEX_DRY_RUN and MONGO_INDEX_REBUILD, the dry run wins
+func indexSyncModeFromEnv() IndexSyncMode {
+	switch {
+	case os.Getenv("MONGO_INDEX_DRY_RUN") == "true":
+		return IndexDryRun
+	case os.Getenv("MONGO_INDEX_REBUILD") == "true":
+		return IndexRebuild
+	default:
+		return IndexCreate
+	}
+}
+
+// IndexDiff is what SyncIndexes found for one collection
+type IndexDiff struct {
+	Collection string
+	// Missing are declared and not in the database
+	Missing []IndexSpec
+	// Changed are in the database under the same name with another definition, only IndexRebuild drops and
+	// creates them again
+	Changed []IndexSpec
+	// Extra are in the database and not declared, sync leaves them alone
+	Extra []string
+}
+
+// Empty tells whether the collection matches its specs
+func (d IndexDiff) Empty() bool {
+	return len(d.Missing) == 0 && len(d.Changed) == 0 && len(d.Extra) == 0
+}
+
+func (d IndexDiff) String() string {
+	parts := []string{}
+	for _, spec := range d.Missing {
+		parts = append(parts, "missing "+spec.Name)
+	}
+	for _, spec := range d.Changed {
+		parts = append(parts, "changed "+spec.Name)
+	}
+	for _, name := range d.Extra {
+		parts = append(parts, "extra "+name)
+	}
+	return d.Collection + ": " + strings.Join(parts, ", ")
+}
+
+// index as listed by the database
+type existingIndex struct {
+	Name                    string `bson:"name"`
+	Key                     bson.D `bson:"key"`
+	Unique                  bool   `bson:"unique"`
+	ExpireAfterSeconds      *int64 `bson:"expireAfterSeconds"`
+	PartialFilterExpression bson.D `bson:"partialFilterExpression"`
+}
+
+var (
+	// one startup sync runs at a time
+	indexSyncMutex     sync.Mutex
+	indexRegistryMutex sync.Mutex
+	// collection name in MONGO_DB to its indexes
+	indexRegistry = map[string][]IndexSpec{
+		"customers": {
+			// SaveCustomerDocuments updates the customer by its reference number
+			{
+				Name:    "user_reference_number_unique",
+				Keys:    bson.D{{Key: "user_reference_number", Value: 1}},
+				Unique:  true,
+				Partial: bson.D{{Key: "user_reference_number", Value: bson.D{{Key: "$type", Value: "string"}}}},
+			},
+			// SaveCustomerDocuments finds the customer by the android and device id of one of its phones
+			{
+				Name: "phones_android_id_device_id",
+				Keys: bson.D{{Key: "phones.android_id", Value: 1}, {Key: "phones.device_id", Value: 1}},
+			},
+		},
+		"audit": {
+			// AuditHistory lists the entries of one record, the latest first
+			{
+				Name: "collection_record_id_at",
+				Keys: bson.D{{Key: "collection", Value: 1}, {Key: "record_id", Value: 1}, {Key: "at", Value: -1}},
+			},
+		},
+	}
+)
+
+// RegisterIndexes adds or replaces the specs of collection, call it before SyncIndexes
+func RegisterIndexes(collection string, specs ...IndexSpec) {
+	indexRegistryMutex.Lock()
+	defer indexRegistryMutex.Unlock()
+	registered := indexRegistry[collection]
+	for _, spec := range specs {
+		replaced := false
+		for i := range registered {
+			if registered[i].Name == spec.Name {
+				registered[i], replaced = spec, true
+			}
+		}
+		if !replaced {
+			registered = append(registered, spec)
+		}
+	}
+	indexRegistry[collection] = registered
+}
+
+// SyncIndexes compares the registered indexes with db and changes what mode allows. It is safe to run at every
+// startup, the extra indexes are only reported. The returned diffs describe the state before the sync,
+// collections already in sync are left out.
+func SyncIndexes(ctx context.Context, db *mongo.Database, mode IndexSyncMode) ([]IndexDiff, error) {
+	indexRegistryMutex.Lock()
+	collections := make([]string, 0, len(indexRegistry))
+	registry := make(map[string][]IndexSpec, len(indexRegistry))
+	for name, specs := range indexRegistry {
+		collections = append(collections, name)
+		registry[name] = append([]IndexSpec(nil), specs...)
+	}
+	indexRegistryMutex.Unlock()
+	sort.Strings(collections)
+
+	diffs := []IndexDiff{}
+	for _, name := range collections {
+		collection := db.Collection(name)
+		existing, err := listIndexes(ctx, collection)
+		if err != nil {
+			return diffs, err
+		}
+		diff := diffIndexes(name, registry[name], existing)
+		if diff.Empty() {
+			continue
+		}
+		diffs = append(diffs, diff)
+		if mode == IndexDryRun {
+			continue
+		}
+		if err := applyIndexDiff(ctx, collection, diff, mode == IndexRebuild); err != nil {
+			return diffs, err
+		}
+	}
+	return diffs, nil
+}
+
+// syncIndexesAtStartup runs SyncIndexes on the MONGO_DB of client in the background, so building the indexes
+// does not hold up the connect. A failure is logged and does not stop the service. The missing indexes are
+// created, set MONGO_INDEX_DRY_RUN=true to only log the diff or MONGO_INDEX_REBUILD=true to rebuild the changed ones.
+func syncIndexesAtStartup(client *mongo.Client) {
+	mode := indexSyncModeFromEnv()
+	db := client.Database(os.Getenv("MONGO_DB"))
+	go func() {
+		// a reconfigure waits for the sync of the previous client
+		indexSyncMutex.Lock()
+		defer indexSyncMutex.Unlock()
+		ctx, cancel := context.WithTimeout(context.Background(), indexSyncTimeout)
+		defer cancel()
+		diffs, err := SyncIndexes(ctx, db, mode)
+		for _, diff := range diffs {
+			switch {
+			case mode == IndexDryRun:
+				logger.Info("index dry run " + diff.String())
+			case mode == IndexCreate && len(diff.Changed) != 0:
+				logger.Info("index sync " + diff.String() + ", set MONGO_INDEX_REBUILD=true to rebuild the changed ones")
+			default:
+				logger.Info("index sync " + diff.String())
+			}
+		}
+		if err != nil {
+			logger.Error(err, "failed while syncing the indexes")
+		}
+	}()
+}
+
+func listIndexes(ctx context.Context, collection *mongo.Collection) ([]existingIndex, error) {
+	cursor, err := collection.Indexes().List(ctx)
+	if err != nil {
+		// a collection which does not exist yet has no indexes
+		var serverError mongo.ServerError
+		if errors.As(err, &serverError) && serverError.HasErrorCode(namespaceNotFoundCode) {
+			return nil, nil
+		}
+		return nil, classify("list indexes", err)
+	}
+	existing := []existingIndex{}
+	if err := cursor.All(ctx, &existing); err != nil {
+		return nil, classify("list indexes", err)
+	}
+	return existing, nil
+}
+
+// applyIndexDiff creates the missing indexes, and the changed ones again when rebuild is set. Each index is created
+// on its own, one which fails does not hold up the others and the returned error names every failed index.
+func applyIndexDiff(ctx context.Context, collection *mongo.Collection, diff IndexDiff, rebuild bool) error {
+	failed := []error{}
+	for _, spec := range diff.Missing {
+		if err := createIndex(ctx, collection, spec, false); err != nil {
+			failed = append(failed, err)
+		}
+	}
+	if rebuild {
+		for _, spec := range diff.Changed {
+			if err := createIndex(ctx, collection, spec, true); err != nil {
+				failed = append(failed, err)
+			}
+		}
+	}
+	return errors.Join(failed...)
+}
+
+// createIndex creates the index of spec, dropping the one with its name first when drop is set. A unique index is
+// not created, and with drop the old one is kept, while the collection has documents sharing its keys, the error
+// gives the keys of one such group. Remove or merge those documents and the next sync creates it.
+func createIndex(ctx context.Context, collection *mongo.Collection, spec IndexSpec, drop bool) error {
+	op := "create index " + spec.Name + " on " + collection.Name()
+	if spec.Unique {
+		duplicate, err := findDuplicateKeys(ctx, collection, spec)
+		if err != nil {
+			return classify(op, err)
+		}
+		if duplicate != nil {
+			return &Error{Op: op, Class: ErrDuplicateKey, Err: fmt.Errorf("existing documents share the keys %v", duplicate)}
+		}
+	}
+	if drop {
+		if _, err := collection.Indexes().DropOne(ctx, spec.Name); err != nil {
+			return classify("drop index "+spec.Name+" on "+collection.Name(), err)
+		}
+	}
+	if _, err := collection.Indexes().CreateOne(ctx, spec.model()); err != nil {
+		return classify(op, err)
+	}
+	return nil
+}
+
+// findDuplicateKeys returns the keys shared by several documents the unique index of spec covers, nil when there are none
+func findDuplicateKeys(ctx context.Context, collection *mongo.Collection, spec IndexSpec) (bson.M, error) {
+	cursor, err := collection.Aggregate(ctx, duplicateKeysPipeline(spec), options.Aggregate().SetAllowDiskUse(true))
+	if err != nil {
+		return nil, err
+	}
+	duplicates := []bson.M{}
+	if err := cursor.All(ctx, &duplicates); err != nil {
+		return nil, err
+	}
+	if len(duplicates) == 0 {
+		return nil, nil
+	}
+	return duplicates[0], nil
+}
+
+// duplicateKeysPipeline groups the documents the index of spec covers by its keys and keeps the first group of
+// more than one. The keys are named by their position, a group key can not hold the dots of a nested field.
+func duplicateKeysPipeline(spec IndexSpec) mongo.Pipeline {
+	match := spec.Partial
+	if match == nil {
+		match = bson.D{}
+	}
+	keys := bson.D{}
+	for i, key := range spec.Keys {
+		keys = append(keys, bson.E{Key: fmt.Sprintf("k%d", i), Value: "$" + key.Key})
+	}
+	return mongo.Pipeline{
+		{{Key: "$match", Value: match}},
+		{{Key: "$group", Value: bson.D{{Key: "_id", Value: keys}, {Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}}}}},
+		{{Key: "$match", Value: bson.D{{Key: "count", Value: bson.D{{Key: "$gt", Value: 1}}}}}},
+		{{Key: "$limit", Value: 1}},
+	}
+}
+
+// diffIndexes compares the specs of collection with its existing indexes, the _id index is never extra
+func diffIndexes(collection string, specs []IndexSpec, existing []existingIndex) IndexDiff {
+	diff := IndexDiff{Collection: collection}
+	byName := map[string]existingIndex{}
+	for _, index := range existing {
+		byName[index.Name] = index
+	}
+	declared := map[string]bool{}
+	for _, spec := range specs {
+		declared[spec.Name] = true
+		index, ok := byName[spec.Name]
+		switch {
+		case !ok:
+			diff.Missing = append(diff.Missing, spec)
+		case !spec.matches(index):
+			diff.Changed = append(diff.Changed, spec)
+		}
+	}
+	for _, index := range existing {
+		if !declared[index.Name] && index.Name != "_id_" {
+			diff.Extra = append(diff.Extra, index.Name)
+		}
+	}
+	return diff
+}
+
+// model converts the spec to the driver index model
+func (spec IndexSpec) model() mongo.IndexModel {
+	indexOptions := options.Index().SetName(spec.Name)
+	if spec.Unique {
+		indexOptions.SetUnique(true)
+	}
+	if spec.TTL > 0 {
+		indexOptions.SetExpireAfterSeconds(int32(spec.TTL / time.Second))
+	}
+	if len(spec.Partial) != 0 {
+		indexOptions.SetPartialFilterExpression(spec.Partial)
+	}
+	return mongo.IndexModel{Keys: spec.Keys, Options: indexOptions}
+}
+
+// matches compares the keys, in order, and the options of the spec with an existing index
+func (spec IndexSpec) matches(index existingIndex) bool {
+	if len(spec.Keys) != len(index.Key) || spec.Unique != index.Unique {
+		return false
+	}
+	for i, key := range spec.Keys {
+		if key.Key != index.Key[i].Key || fmt.Sprint(indexKeyValue(key.Value)) != fmt.Sprint(indexKeyValue(index.Key[i].Value)) {
+			return false
+		}
+	}
+	expireAfter := int64(0)
+	if index.ExpireAfterSeconds != nil {
+		expireAfter = *index.ExpireAfterSeconds
+	}
+	if int64(spec.TTL/time.Second) != expireAfter {
+		return false
+	}
+	return sameDocument(spec.Partial, index.PartialFilterExpression)
+}
+
+// indexKeyValue makes 1, int32(1) and 1.0 equal, the database may return any of them
+func indexKeyValue(value interface{}) interface{} {
+	switch number := value.(type) {
+	case int:
+		return float64(number)
+	case int32:
+		return float64(number)
+	case int64:
+		return float64(number)
+	case float64:
+		return number
+	default:
+		return value
+	}
+}
+
+// sameDocument compares two documents by their encoding after a round trip, so the number types do not matter
+func sameDocument(a, b bson.D) bool {
+	if len(a) == 0 || len(b) == 0 {
+		return len(a) == len(b)
+	}
+	normalize := func(d bson.D) []byte {
+		bs, err := bson.Marshal(d)
+		if err != nil {
+			return nil
+		}
+		var m bson.D
+		if err := bson.Unmarshal(bs, &m); err != nil {
+			return nil
+		}
+		bs, _ = bson.MarshalExtJSON(m, false, false)
+		return bs
+	}
+	return bytes.Equal(normalize(a), normalize(b))
+}
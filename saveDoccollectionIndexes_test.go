@@ -0,0 +1,137 @@
+package mongo
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestDiffIndexes(t *testing.T) {
+	ttl := int64(3600)
+	specs := []IndexSpec{
+		{Name: "ref", Keys: bson.D{{Key: "ref", Value: 1}}, Unique: true,
+			Partial: bson.D{{Key: "ref", Value: bson.D{{Key: "$type", Value: "string"}}}}},
+		{Name: "phone", Keys: bson.D{{Key: "phones.android_id", Value: 1}, {Key: "phones.device_id", Value: 1}}},
+		{Name: "created", Keys: bson.D{{Key: "created_at", Value: 1}}, TTL: time.Hour},
+		{Name: "missing", Keys: bson.D{{Key: "missing", Value: -1}}},
+	}
+	existing := []existingIndex{
+		{Name: "_id_", Key: bson.D{{Key: "_id", Value: int32(1)}}},
+		// the database returns other number types, they must still match
+		{Name: "ref", Key: bson.D{{Key: "ref", Value: 1.0}}, Unique: true,
+			PartialFilterExpression: bson.D{{Key: "ref", Value: bson.D{{Key: "$type", Value: "string"}}}}},
+		// the keys are in the wrong order
+		{Name: "phone", Key: bson.D{{Key: "phones.device_id", Value: int32(1)}, {Key: "phones.android_id", Value: int32(1)}}},
+		{Name: "created", Key: bson.D{{Key: "created_at", Value: int32(1)}}, ExpireAfterSeconds: &ttl},
+		{Name: "old", Key: bson.D{{Key: "old", Value: int32(1)}}},
+	}
+
+	diff := diffIndexes("customers", specs, existing)
+	if len(diff.Missing) != 1 || diff.Missing[0].Name != "missing" {
+		t.Errorf("missing = %v, want missing", diff.Missing)
+	}
+	if len(diff.Changed) != 1 || diff.Changed[0].Name != "phone" {
+		t.Errorf("changed = %v, want phone", diff.Changed)
+	}
+	if len(diff.Extra) != 1 || diff.Extra[0] != "old" {
+		t.Errorf("extra = %v, want old", diff.Extra)
+	}
+	if diff.String() != "customers: missing missing, changed phone, extra old" {
+		t.Errorf("String() = %q", diff.String())
+	}
+
+	if diff := diffIndexes("customers", specs[2:3], existing[3:4]); !diff.Empty() {
+		t.Errorf("a matching TTL index gives %s", diff)
+	}
+	changedTTL := int64(60)
+	if diff := diffIndexes("customers", specs[2:3], []existingIndex{{Name: "created", Key: existing[3].Key, ExpireAfterSeconds: &changedTTL}}); len(diff.Changed) != 1 {
+		t.Errorf("a changed TTL gives %s", diff)
+	}
+	if diff := diffIndexes("customers", specs[:1], []existingIndex{{Name: "ref", Key: existing[1].Key, Unique: true}}); len(diff.Changed) != 1 {
+		t.Errorf("a missing partial filter gives %s", diff)
+	}
+}
+
+func TestIndexSyncModeFromEnv(t *testing.T) {
+	for _, c := range []struct {
+		dryRun, rebuild string
+		mode            IndexSyncMode
+	}{
+		{"", "", IndexCreate},
+		{"true", "", IndexDryRun},
+		{"", "true", IndexRebuild},
+		{"true", "true", IndexDryRun},
+		{"false", "yes", IndexCreate},
+	} {
+		t.Setenv("MONGO_INDEX_DRY_RUN", c.dryRun)
+		t.Setenv("MONGO_INDEX_REBUILD", c.rebuild)
+		if mode := indexSyncModeFromEnv(); mode != c.mode {
+			t.Errorf("dry run %q, rebuild %q gives mode %d, want %d", c.dryRun, c.rebuild, mode, c.mode)
+		}
+	}
+}
+
+func TestRegisterIndexes(t *testing.T) {
+	defer delete(indexRegistry, "test")
+
+	RegisterIndexes("test", IndexSpec{Name: "a", Keys: bson.D{{Key: "a", Value: 1}}})
+	RegisterIndexes("test", IndexSpec{Name: "a", Keys: bson.D{{Key: "a", Value: -1}}}, IndexSpec{Name: "b"})
+	specs := indexRegistry["test"]
+	if len(specs) != 2 || specs[0].Keys[0].Value != -1 || specs[1].Name != "b" {
+		t.Errorf("registry = %v, want a replaced and b added", specs)
+	}
+}
+
+func TestIndexSpecModel(t *testing.T) {
+	model := IndexSpec{Name: "created", Keys: bson.D{{Key: "created_at", Value: 1}}, Unique: true, TTL: 90 * time.Second,
+		Partial: bson.D{{Key: "kind", Value: "x"}}}.model()
+	if *model.Options.Name != "created" || !*model.Options.Unique || *model.Options.ExpireAfterSeconds != 90 || model.Options.PartialFilterExpression == nil {
+		t.Errorf("options = %+v", model.Options)
+	}
+	model = IndexSpec{Name: "plain", Keys: bson.D{{Key: "a", Value: 1}}}.model()
+	if model.Options.Unique != nil || model.Options.ExpireAfterSeconds != nil || model.Options.PartialFilterExpression != nil {
+		t.Errorf("a plain spec sets options %+v", model.Options)
+	}
+}
+
+func TestDuplicateKeysPipeline(t *testing.T) {
+	spec := indexRegistry["customers"][0]
+	pipeline := duplicateKeysPipeline(spec)
+	raw, err := bson.Marshal(bson.D{{Key: "pipeline", Value: pipeline}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// only the documents of the partial index are grouped, by the keys of the index
+	for _, want := range []string{`{"$match": {"user_reference_number": {"$type": "string"}}}`, `"_id": {"k0": "$user_reference_number"}`, `{"$gt": {"$numberInt":"1"}}`} {
+		if !strings.Contains(bson.Raw(raw).String(), want) {
+			t.Errorf("pipeline %s does not contain %s", bson.Raw(raw), want)
+		}
+	}
+	if match := duplicateKeysPipeline(IndexSpec{Keys: bson.D{{Key: "a", Value: 1}}})[0][0].Value; match == nil {
+		t.Error("a spec without a partial filter matches nil")
+	}
+}
+
+func TestApplyIndexDiffNamesEveryFailure(t *testing.T) {
+	// the driver connects lazily, every index fails on server selection
+	client, err := mongo.Connect(context.Background(), options.Client().ApplyURI("mongodb://127.0.0.1:1").SetServerSelectionTimeout(50*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Disconnect(context.Background())
+	diff := IndexDiff{Collection: "customers", Missing: indexRegistry["customers"]}
+
+	err = applyIndexDiff(context.Background(), client.Database("test").Collection("customers"), diff, false)
+	// the unique index failing does not stop the next one from being tried
+	if !isOp(err, "create index user_reference_number_unique on customers") {
+		t.Errorf("applyIndexDiff = %v, want the unique index named", err)
+	}
+	if err == nil || !strings.Contains(err.Error(), "create index phones_android_id_device_id on customers") {
+		t.Errorf("applyIndexDiff = %v, want the phones index named", err)
+	}
+}
@@ -0,0 +1,125 @@
+package mongo
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Page selects one page of a List, Number starts at 1 and a zero Size returns every document
+type Page struct {
+	Number int64
+	Size   int64
+}
+
+// ListOptions are the filter, projection, sort and page of a List, a nil Filter matches every document
+type ListOptions struct {
+	Filter     interface{}
+	Projection interface{}
+	Sort       bson.D
+	Page       Page
+}
+
+// Repository reads and writes the documents of one collection as values of T
+type Repository[T any] struct {
+	collection *mongo.Collection
+}
+
+// NewRepository returns the repository of collection, T must decode the documents of the collection
+func NewRepository[T any](collection *mongo.Collection) *Repository[T] {
+	return &Repository[T]{collection: collection}
+}
+
+// Collection returns the collection for the operations the repository does not cover
+func (r *Repository[T]) Collection() *mongo.Collection {
+	return r.collection
+}
+
+// Create inserts document and returns its _id
+func (r *Repository[T]) Create(ctx context.Context, document T) (interface{}, error) {
+	res, err := r.collection.InsertOne(ctx, document)
+	if err != nil {
+		return nil, classify("create", err)
+	}
+	return res.InsertedID, nil
+}
+
+// Get returns the first document matching filter, the error matches ErrDocumentNotFound when there is none
+func (r *Repository[T]) Get(ctx context.Context, filter interface{}, opts ...*options.FindOneOptions) (T, error) {
+	var document T
+	err := r.collection.FindOne(ctx, filter, opts...).Decode(&document)
+	return document, classify("get", err)
+}
+
+// List returns the documents matching the options, an empty slice when there is none
+func (r *Repository[T]) List(ctx context.Context, listOptions ListOptions) ([]T, error) {
+	cursor, err := r.collection.Find(ctx, listOptions.filter(), listOptions.findOptions())
+	if err != nil {
+		return nil, classify("list", err)
+	}
+	documents := []T{}
+	if err := cursor.All(ctx, &documents); err != nil {
+		return nil, classify("list", err)
+	}
+	return documents, nil
+}
+
+// Update applies update to the first document matching filter
+func (r *Repository[T]) Update(ctx context.Context, filter interface{}, update interface{}) (UpdateCounts, error) {
+	res, err := r.collection.UpdateOne(ctx, filter, update)
+	return updateCounts(res), classify("update", err)
+}
+
+// Upsert applies update to the first document matching filter, it inserts one when there is none
+func (r *Repository[T]) Upsert(ctx context.Context, filter interface{}, update interface{}) (UpdateCounts, error) {
+	res, err := r.collection.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	return updateCounts(res), classify("upsert", err)
+}
+
+// Delete removes the first document matching filter and returns the number of documents deleted
+func (r *Repository[T]) Delete(ctx context.Context, filter interface{}) (int64, error) {
+	res, err := r.collection.DeleteOne(ctx, filter)
+	if err != nil {
+		return 0, classify("delete", err)
+	}
+	return res.DeletedCount, nil
+}
+
+// Count returns the number of documents matching filter
+func (r *Repository[T]) Count(ctx context.Context, filter interface{}) (int64, error) {
+	count, err := r.collection.CountDocuments(ctx, listFilter(filter))
+	return count, classify("count", err)
+}
+
+func (o ListOptions) filter() interface{} {
+	return listFilter(o.Filter)
+}
+
+// findOptions converts the projection, sort and page to the driver options
+func (o ListOptions) findOptions() *options.FindOptions {
+	findOptions := options.Find()
+	if o.Projection != nil {
+		findOptions.SetProjection(o.Projection)
+	}
+	if len(o.Sort) != 0 {
+		findOptions.SetSort(o.Sort)
+	}
+	if o.Page.Size > 0 {
+		number := o.Page.Number
+		if number < 1 {
+			number = 1
+		}
+		findOptions.SetSkip((number - 1) * o.Page.Size).SetLimit(o.Page.Size)
+	}
+	return findOptions
+}
+
+// the driver rejects a nil filter, it means every document here
+func listFilter(filter interface{}) interface{} {
+	if filter == nil {
+		return bson.M{}
+	}
+	return filter
+}
@@ -0,0 +1,82 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestListOptionsFindOptions(t *testing.T) {
+	listOptions := ListOptions{
+		Projection: bson.M{"docs": 1},
+		Sort:       bson.D{{Key: "created_at", Value: -1}},
+		Page:       Page{Number: 3, Size: 20},
+	}
+	findOptions := listOptions.findOptions()
+	if *findOptions.Skip != 40 || *findOptions.Limit != 20 {
+		t.Errorf("skip, limit = %d, %d, want 40, 20", *findOptions.Skip, *findOptions.Limit)
+	}
+	if findOptions.Projection == nil || findOptions.Sort == nil {
+		t.Error("projection or sort is not set")
+	}
+
+	findOptions = ListOptions{Page: Page{Size: 10}}.findOptions()
+	if *findOptions.Skip != 0 || *findOptions.Limit != 10 {
+		t.Errorf("page 0 skip, limit = %d, %d, want the first page", *findOptions.Skip, *findOptions.Limit)
+	}
+	findOptions = ListOptions{}.findOptions()
+	if findOptions.Skip != nil || findOptions.Limit != nil || findOptions.Projection != nil {
+		t.Error("an empty ListOptions sets options")
+	}
+	if _, ok := (ListOptions{}).filter().(bson.M); !ok {
+		t.Error("a nil filter is not replaced by an empty document")
+	}
+}
+
+func TestRepositoryErrors(t *testing.T) {
+	// the driver connects lazily, every operation fails on server selection
+	client, err := mongo.Connect(context.Background(), options.Client().ApplyURI("mongodb://127.0.0.1:1").SetServerSelectionTimeout(50*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Disconnect(context.Background())
+	type profile struct {
+		Name string `bson:"name"`
+	}
+	repository := NewRepository[profile](client.Database("test").Collection("profiles"))
+	ctx := context.Background()
+
+	if _, err := repository.Create(ctx, profile{Name: "Ann"}); !isOp(err, "create") {
+		t.Errorf("Create = %v", err)
+	}
+	if _, err := repository.Get(ctx, bson.M{"name": "Ann"}); !isOp(err, "get") {
+		t.Errorf("Get = %v", err)
+	}
+	if documents, err := repository.List(ctx, ListOptions{}); documents != nil || !isOp(err, "list") {
+		t.Errorf("List = %v, %v", documents, err)
+	}
+	if _, err := repository.Upsert(ctx, bson.M{"name": "Ann"}, bson.M{"$set": bson.M{"name": "Bob"}}); !isOp(err, "upsert") {
+		t.Errorf("Upsert = %v", err)
+	}
+	if _, err := repository.Delete(ctx, bson.M{"name": "Ann"}); !isOp(err, "delete") {
+		t.Errorf("Delete = %v", err)
+	}
+	// the untyped helpers go through the repository
+	if _, err := UpdateOne(repository.Collection(), ctx, bson.M{}, bson.M{"$set": bson.M{"name": "Bob"}}); !isOp(err, "update") {
+		t.Errorf("UpdateOne = %v", err)
+	}
+	if _, err := Count(repository.Collection(), ctx, nil); !isOp(err, "count") {
+		t.Errorf("Count = %v", err)
+	}
+}
+
+// isOp reports whether err is a classified error of op
+func isOp(err error, op string) bool {
+	var mongoErr *Error
+	return errors.As(err, &mongoErr) && mongoErr.Op == op
+}
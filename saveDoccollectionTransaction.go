@@ -0,0 +1,89 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readconcern"
+	"go.mongodb.org/mongo-driver/mongo/writeconcern"
+)
+
+const (
+	maxTransactionAttempts  = 5
+	transactionRetryBackoff = 50 * time.Millisecond
+	abortTimeout            = 5 * time.Second
+
+	transientTransactionLabel = "TransientTransactionError"
+	unknownCommitResultLabel  = "UnknownTransactionCommitResult"
+)
+
+// ErrNoClient is returned by WithTransaction before configure gave the package a client
+var ErrNoClient = errors.New("mongo client is not configured")
+
+// client the collections were configured with, transactions start their session on it
+var dbClient *mongo.Client
+
+// WithTransaction runs fn in a multi-document transaction and commits it when fn returns nil.
+// The ctx given to fn carries the session, pass it to the helpers so their writes join the transaction.
+// The whole transaction is retried on TransientTransactionError and the commit on UnknownTransactionCommitResult,
+// so fn must be safe to run again. Transactions need a replica set or a sharded cluster.
+func WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if dbClient == nil {
+		return ErrNoClient
+	}
+	session, err := dbClient.StartSession()
+	if err != nil {
+		return classify("start session", err)
+	}
+	defer session.EndSession(context.Background())
+
+	return classify("transaction", retryTransient(ctx, transientTransactionLabel, func() error {
+		return runTransaction(ctx, session, fn)
+	}))
+}
+
+// runTransaction runs fn once in a new transaction of session
+func runTransaction(ctx context.Context, session mongo.Session, fn func(ctx context.Context) error) error {
+	transactionOptions := options.Transaction().
+		SetReadConcern(readconcern.Snapshot()).
+		SetWriteConcern(writeconcern.Majority())
+	if err := session.StartTransaction(transactionOptions); err != nil {
+		return err
+	}
+
+	sessionCtx := mongo.NewSessionContext(ctx, session)
+	if err := fn(sessionCtx); err != nil {
+		// abort with its own deadline, ctx may be the reason fn failed
+		abortCtx, cancel := context.WithTimeout(context.Background(), abortTimeout)
+		defer cancel()
+		session.AbortTransaction(abortCtx)
+		return err
+	}
+	return retryTransient(ctx, unknownCommitResultLabel, func() error {
+		return session.CommitTransaction(sessionCtx)
+	})
+}
+
+// retryTransient calls run until it succeeds, fails without label or maxTransactionAttempts is reached
+func retryTransient(ctx context.Context, label string, run func() error) error {
+	var err error
+	for attempt := 1; attempt <= maxTransactionAttempts; attempt++ {
+		if err = run(); err == nil || !hasErrorLabel(err, label) {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(time.Duration(attempt) * transactionRetryBackoff):
+		}
+	}
+	return err
+}
+
+func hasErrorLabel(err error, label string) bool {
+	var serverError mongo.ServerError
+	return errors.As(err, &serverError) && serverError.HasErrorLabel(label)
+}
@@ -0,0 +1,50 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestRetryTransient(t *testing.T) {
+	transient := classify("update one", mongo.CommandError{Code: 112, Labels: []string{transientTransactionLabel}})
+
+	attempts := 0
+	err := retryTransient(context.Background(), transientTransactionLabel, func() error {
+		if attempts++; attempts < 3 {
+			return transient
+		}
+		return nil
+	})
+	if err != nil || attempts != 3 {
+		t.Errorf("retryTransient() = %v after %d attempts, want success after 3", err, attempts)
+	}
+
+	attempts = 0
+	err = retryTransient(context.Background(), transientTransactionLabel, func() error {
+		attempts++
+		return transient
+	})
+	if !errors.Is(err, ErrWriteConflict) || attempts != maxTransactionAttempts {
+		t.Errorf("retryTransient() = %v after %d attempts, want a write conflict after %d", err, attempts, maxTransactionAttempts)
+	}
+
+	attempts = 0
+	permanent := classify("update one", mongo.WriteException{WriteErrors: []mongo.WriteError{{Code: 11000}}})
+	err = retryTransient(context.Background(), transientTransactionLabel, func() error {
+		attempts++
+		return permanent
+	})
+	if !errors.Is(err, ErrDuplicateKey) || attempts != 1 {
+		t.Errorf("retryTransient() = %v after %d attempts, want no retry", err, attempts)
+	}
+}
+
+func TestWithTransactionWithoutClient(t *testing.T) {
+	err := WithTransaction(context.Background(), func(ctx context.Context) error { return nil })
+	if !errors.Is(err, ErrNoClient) {
+		t.Errorf("WithTransaction() = %v, want ErrNoClient", err)
+	}
+}
@@ -1,25 +1,59 @@
 package logic
 
 import (
-	"fmt"
+	"context"
+	"errors"
 	"net/http"
+	"reflect"
+	"strings"
 	"time"
 
+	"digi-data-ingestion-client/audit"
 	"digi-data-ingestion-client/clients/mongo"
 	"digi-data-ingestion-client/models"
 	"digi-data-ingestion-client/utils/logger"
 
-	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	mongoD "go.mongodb.org/mongo-driver/mongo"
 )
 
 var UpdateDocData = mongo.UpdateOne
 var FindDocData = mongo.FindOne
+var WithDocTransaction = mongo.WithTransaction
 
-func SaveCustomerDocuments(ctx *gin.Context, data []models.DocumentData, userRef string, CustomerId, DeviceId primitive.ObjectID, AndroidId string) (response models.SaveCustomerDocResponse) {
-	newDocCount := 0
+// bson names of the models.DocumentData fields a document is identified by, read from its tags
+var (
+	docNumberKey = bsonFieldName(models.DocumentData{}, "Number")
+	docTypeKey   = bsonFieldName(models.DocumentData{}, "DocType")
+)
+
+// errCustomerNotFound ends the transaction when no customer has the user reference number
+var errCustomerNotFound = errors.New("customer not found")
+
+// bsonFieldName returns the name the bson encoder gives to field of v, the lowercased field name without a tag
+func bsonFieldName(v interface{}, field string) string {
+	structField, ok := reflect.TypeOf(v).FieldByName(field)
+	if !ok {
+		panic("models.DocumentData has no field " + field)
+	}
+	if name := strings.Split(structField.Tag.Get("bson"), ",")[0]; name != "" {
+		return name
+	}
+	return strings.ToLower(field)
+}
+
+// SavedDocsData is the Data of a SaveCustomerDocuments response, it lists the numbers added and rejected as duplicates
+type SavedDocsData struct {
+	models.Data
+	AddedDocNumbers     []string `json:"added_doc_numbers"`
+	DuplicateDocNumbers []string `json:"duplicate_doc_numbers"`
+}
 
+// SaveCustomerDocuments appends the new documents of the customer, it only needs a context so it also runs outside gin handlers.
+// A document is a duplicate when the customer has one with the same number and type, the check is done by the database
+// so concurrent uploads can not add the same document twice. No customer with userRef is a 404 and adds nothing.
+func SaveCustomerDocuments(ctx context.Context, data []models.DocumentData, userRef string, CustomerId, DeviceId primitive.ObjectID, AndroidId string) (response models.SaveCustomerDocResponse) {
 	query := bson.M{
 		"_id": CustomerId,
 		"phones": bson.M{
@@ -57,116 +91,157 @@ func SaveCustomerDocuments(ctx *gin.Context, data []models.DocumentData, userRef
 		return response
 	}
 
-	var duplicateDocFound bool
-	mapOfDoc := make(map[string]models.DocumentData)
-
-	if len(result.Docs) != 0 {
-		for _, v := range result.Docs {
-			if v.Number != "" {
-				mapOfDoc[v.Number] = v
-			}
+	if len(data) == 0 {
+		response = models.SaveCustomerDocResponse{
+			Message:      "Docs are required.",
+			ResponseCode: http.StatusOK,
+			Success:      false,
+			Data:         nil,
 		}
+		return response
 	}
 
-	var arrOfDoc []models.DocumentData
-	for _, v := range data {
-		if _, isFound := mapOfDoc[v.Number]; !isFound {
-			mapOfDoc[v.Number] = v
-			arrOfDoc = append(arrOfDoc, v)
-			newDocCount++
-		} else {
-			logger.Info(fmt.Sprintf("Duplicate entry found for document with number: %s", v.Number))
-			duplicateDocFound = true
-			continue
+	// Check for an empty document in the data slice
+	isEmptyDoc := true
+	for _, doc := range data {
+		if !isEmptyDocument(doc) {
+			isEmptyDoc = false
+			break
 		}
 	}
+	if isEmptyDoc {
+		response = models.SaveCustomerDocResponse{
+			Message:      "No docs found to insert",
+			ResponseCode: 0,
+			Success:      false,
+			Data:         nil,
+		}
+		return response
+	}
 
 	now := time.Now()
 	date := now.Format("2006-01-02 15:04:05")
 
-	if len(arrOfDoc) >= 1 {
-		// Check for an empty document in the arrOfDoc slice
-		isEmptyDoc := true
-		for _, doc := range arrOfDoc {
-			if !isEmptyDocument(doc) {
-				isEmptyDoc = false
-				break
-			}
-		}
+	var addedNumbers, duplicateNumbers []string
+	var addedDocs []models.DocumentData
+	var failedMessage string
+	err := WithDocTransaction(ctx, func(txCtx context.Context) error {
+		// the transaction may run again, start from scratch
+		addedNumbers, duplicateNumbers, addedDocs = []string{}, []string{}, []models.DocumentData{}
 
-		if isEmptyDoc {
-			response = models.SaveCustomerDocResponse{
-				Message:      "No docs found to insert",
-				ResponseCode: 0,
-				Success:      false,
-				Data:         nil,
+		for _, doc := range data {
+			if isEmptyDocument(doc) {
+				continue
+			}
+			failedMessage = "failed while updating document details in DB"
+			counts, err := UpdateDocData(mongo.CustomersCollection, txCtx, bson.M{"user_reference_number": userRef}, pushDocUpdate(doc, date))
+			if err != nil {
+				return err
+			}
+			if counts.Matched == 0 {
+				return errCustomerNotFound
+			}
+			if counts.Modified == 0 {
+				logger.Info("Duplicate entry found for document with number: " + doc.Number)
+				duplicateNumbers = append(duplicateNumbers, doc.Number)
+			} else {
+				addedNumbers = append(addedNumbers, doc.Number)
+				addedDocs = append(addedDocs, doc)
 			}
-			return response
 		}
-
-		filter := bson.M{"user_reference_number": userRef}
-		update := bson.M{
-			"$push": bson.M{"docs": bson.M{"$each": arrOfDoc}},
-			"$set":  bson.M{"docs_last_updated_datetime": date},
+		if len(addedNumbers) == 0 {
+			return nil
 		}
 
-		err := UpdateDocData(mongo.CustomersCollection, ctx, filter, update)
 		deviceUpdateFilter := bson.M{"_id": DeviceId}
 		deviceUpdateUpdate := bson.M{"$set": bson.M{"docs_last_updated_datetime": date}}
-
-		deviceUpdateErr := UpdateDocData(mongo.CustomerDevicesCollection, ctx, deviceUpdateFilter, deviceUpdateUpdate)
-		if deviceUpdateErr != nil {
-			logger.Error(deviceUpdateErr, "Error updating document details in DB")
-
-			response = models.SaveCustomerDocResponse{
-				Message:      "failed while updating docs_last_updated_datetime details in customer device collection",
-				ResponseCode: http.StatusInternalServerError,
-				Success:      false,
-				Data:         models.Data{},
-			}
-			return response
+		failedMessage = "failed while updating docs_last_updated_datetime details in customer device collection"
+		if _, err := UpdateDocData(mongo.CustomerDevicesCollection, txCtx, deviceUpdateFilter, deviceUpdateUpdate); err != nil {
+			return err
 		}
-		if err != nil {
-			logger.Error(err, "Error updating document details in DB")
-
-			response = models.SaveCustomerDocResponse{
-				Message:      "failed while updating document details in DB",
-				ResponseCode: http.StatusInternalServerError,
-				Success:      false,
-				Data:         models.Data{},
-			}
-			return response
-		}
-
+		failedMessage = "failed while committing document details in DB"
+		return nil
+	})
+	if errors.Is(err, errCustomerNotFound) {
+		logger.Info("No customer found with user reference number: " + userRef)
 		response = models.SaveCustomerDocResponse{
-			Message:      "Docs saved successfully",
-			ResponseCode: http.StatusOK,
-			Success:      true,
-			Data: models.Data{
-				TotalAdded:              newDocCount,
-				DocsLastUpdatedDatetime: date,
-			},
+			Message:      "customer not found",
+			ResponseCode: http.StatusNotFound,
+			Success:      false,
+			Data:         models.Data{},
 		}
-	} else if duplicateDocFound {
+		return response
+	}
+	if err != nil {
+		logger.Error(err, "Error updating document details in DB")
+
 		response = models.SaveCustomerDocResponse{
-			Message:      "Duplicate documents found.",
-			ResponseCode: http.StatusOK,
+			Message:      failedMessage,
+			ResponseCode: http.StatusInternalServerError,
 			Success:      false,
-			Data:         nil,
+			Data:         models.Data{},
 		}
-	} else {
+		return response
+	}
+
+	// audit after the commit, a retried transaction would otherwise record its documents twice.
+	// userRef is sent by the client, so the actor is recorded unverified.
+	for _, doc := range addedDocs {
+		mongo.RecordAudit(ctx, audit.Entry{
+			Actor:      userRef,
+			Action:     audit.Push,
+			Collection: mongo.CustomersCollection.Name(),
+			RecordID:   userRef,
+			Changes:    []audit.Change{{Field: "docs", After: doc}},
+		})
+	}
+
+	if len(addedNumbers) == 0 {
 		response = models.SaveCustomerDocResponse{
-			Message:      "Docs are required.",
+			Message:      "Duplicate documents found.",
 			ResponseCode: http.StatusOK,
 			Success:      false,
-			Data:         nil,
+			Data:         SavedDocsData{AddedDocNumbers: addedNumbers, DuplicateDocNumbers: duplicateNumbers},
 		}
 		return response
 	}
 
+	response = models.SaveCustomerDocResponse{
+		Message:      "Docs saved successfully",
+		ResponseCode: http.StatusOK,
+		Success:      true,
+		Data: SavedDocsData{
+			Data: models.Data{
+				TotalAdded:              len(addedNumbers),
+				DocsLastUpdatedDatetime: date,
+			},
+			AddedDocNumbers:     addedNumbers,
+			DuplicateDocNumbers: duplicateNumbers,
+		},
+	}
 	return response
 }
 
+// pushDocUpdate appends doc to the docs of the customer unless one has the same number and type. The check runs in
+// the update, so the customer matches either way and only a new document modifies it. doc is a $literal,
+// a value starting with $ is not read as a field path.
+func pushDocUpdate(doc models.DocumentData, date string) mongoD.Pipeline {
+	docs := bson.M{"$ifNull": bson.A{"$docs", bson.A{}}}
+	duplicate := bson.M{"$anyElementTrue": bson.A{bson.M{"$map": bson.M{
+		"input": docs,
+		"as":    "doc",
+		"in": bson.M{"$and": bson.A{
+			bson.M{"$eq": bson.A{"$$doc." + docNumberKey, bson.M{"$literal": doc.Number}}},
+			bson.M{"$eq": bson.A{"$$doc." + docTypeKey, bson.M{"$literal": doc.DocType}}},
+		}},
+	}}}}
+	added := bson.M{"$concatArrays": bson.A{docs, bson.A{bson.M{"$literal": doc}}}}
+	return mongoD.Pipeline{{{Key: "$set", Value: bson.M{
+		"docs":                       bson.M{"$cond": bson.A{duplicate, "$docs", added}},
+		"docs_last_updated_datetime": bson.M{"$cond": bson.A{duplicate, "$docs_last_updated_datetime", date}},
+	}}}}
+}
+
 // Function to check if a document is empty
 func isEmptyDocument(doc models.DocumentData) bool {
 	return (doc.Number == "" && doc.DocType == "")
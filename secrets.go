@@ -0,0 +1,362 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Scheme starts a secret reference, secret://mongo#password is the password key of the mongo secret
+const Scheme = "secret://"
+
+// ErrNotFound is returned when the secret or its key does not exist
+var ErrNotFound = errors.New("secret not found")
+
+// references embedded in a larger value such as a postgres connection string
+var referencePattern = regexp.MustCompile(`secret://[A-Za-z0-9_./-]+#[A-Za-z0-9_.-]+`)
+
+// Secret is the key values stored at one path
+type Secret struct {
+	Data map[string]string
+	// LeaseDuration is how long the values may be used, 0 means until the next read
+	LeaseDuration time.Duration
+	LeaseID       string
+	Renewable     bool
+}
+
+// Provider reads the secret stored at path
+type Provider interface {
+	Get(ctx context.Context, path string) (Secret, error)
+}
+
+// Renewer is implemented by the providers whose leases can be extended without reading the secret again
+type Renewer interface {
+	Renew(ctx context.Context, secret Secret) (Secret, error)
+}
+
+// Reference is a parsed secret://path#key
+type Reference struct {
+	Path string
+	Key  string
+}
+
+func (r Reference) String() string {
+	return Scheme + r.Path + "#" + r.Key
+}
+
+// IsReference tells whether value is a secret reference
+func IsReference(value string) bool {
+	return strings.HasPrefix(value, Scheme)
+}
+
+// ParseReference parses secret://path#key, both the path and the key are required
+func ParseReference(value string) (Reference, error) {
+	if !IsReference(value) {
+		return Reference{}, fmt.Errorf("secret reference must start with %s", Scheme)
+	}
+	parts := strings.SplitN(strings.TrimPrefix(value, Scheme), "#", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return Reference{}, fmt.Errorf("secret reference %q must be %spath#key", value, Scheme)
+	}
+	return Reference{Path: strings.Trim(parts[0], "/"), Key: parts[1]}, nil
+}
+
+// Lookup returns the value of the key referenced by ref
+func Lookup(ctx context.Context, provider Provider, ref Reference) (string, error) {
+	secret, err := provider.Get(ctx, ref.Path)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", ref, err)
+	}
+	value, ok := secret.Data[ref.Key]
+	if !ok {
+		return "", fmt.Errorf("%s: %w", ref, ErrNotFound)
+	}
+	return value, nil
+}
+
+// EnvProvider reads secret://mongo#password from the MONGO_PASSWORD environment variable
+type EnvProvider struct{}
+
+// Get returns every environment variable prefixed by the path, the keys are lower case
+func (EnvProvider) Get(ctx context.Context, path string) (Secret, error) {
+	prefix := envName(path) + "_"
+	secret := Secret{Data: map[string]string{}}
+	for _, env := range os.Environ() {
+		parts := strings.SplitN(env, "=", 2)
+		if strings.HasPrefix(parts[0], prefix) && len(parts) == 2 {
+			secret.Data[strings.ToLower(strings.TrimPrefix(parts[0], prefix))] = parts[1]
+		}
+	}
+	if len(secret.Data) == 0 {
+		return Secret{}, ErrNotFound
+	}
+	return secret, nil
+}
+
+// envName turns a path such as db/mongo into DB_MONGO
+func envName(path string) string {
+	return strings.ToUpper(strings.NewReplacer("/", "_", "-", "_", ".", "_").Replace(path))
+}
+
+// FileProvider reads secrets below Dir. A directory is one secret with a file per key, like a
+// docker or kubernetes secret mount, and a file is one secret holding a JSON object.
+type FileProvider struct {
+	Dir string
+}
+
+// Get reads Dir/path, or Dir/path.json when Dir/path does not exist
+func (p FileProvider) Get(ctx context.Context, path string) (Secret, error) {
+	fullPath := filepath.Join(p.Dir, filepath.FromSlash(path))
+	info, err := os.Stat(fullPath)
+	if os.IsNotExist(err) {
+		fullPath += ".json"
+		info, err = os.Stat(fullPath)
+	}
+	if os.IsNotExist(err) {
+		return Secret{}, ErrNotFound
+	}
+	if err != nil {
+		return Secret{}, err
+	}
+
+	secret := Secret{Data: map[string]string{}}
+	if !info.IsDir() {
+		bs, err := ioutil.ReadFile(fullPath)
+		if err != nil {
+			return Secret{}, err
+		}
+		if err := json.Unmarshal(bs, &secret.Data); err != nil {
+			return Secret{}, fmt.Errorf("secret file %s must be a JSON object of strings: %v", fullPath, err)
+		}
+		return secret, nil
+	}
+
+	files, err := ioutil.ReadDir(fullPath)
+	if err != nil {
+		return Secret{}, err
+	}
+	for _, file := range files {
+		if file.IsDir() || strings.HasPrefix(file.Name(), ".") {
+			continue
+		}
+		bs, err := ioutil.ReadFile(filepath.Join(fullPath, file.Name()))
+		if err != nil {
+			return Secret{}, err
+		}
+		secret.Data[file.Name()] = strings.TrimRight(string(bs), "\r\n")
+	}
+	return secret, nil
+}
+
+type cacheEntry struct {
+	secret  Secret
+	fetched time.Time
+}
+
+// CachingProvider keeps the secrets of another provider until their lease runs out,
+// Start renews the leases in the background before they expire.
+type CachingProvider struct {
+	provider Provider
+	ttl      time.Duration
+
+	mutex   sync.Mutex
+	entries map[string]cacheEntry
+}
+
+// NewCachingProvider caches the secrets of provider, ttl is used for the secrets without a lease
+func NewCachingProvider(provider Provider, ttl time.Duration) *CachingProvider {
+	return &CachingProvider{provider: provider, ttl: ttl, entries: map[string]cacheEntry{}}
+}
+
+// Get returns the cached secret while its lease is valid, otherwise it reads it again
+func (p *CachingProvider) Get(ctx context.Context, path string) (Secret, error) {
+	p.mutex.Lock()
+	entry, ok := p.entries[path]
+	p.mutex.Unlock()
+	if ok && time.Now().Before(entry.fetched.Add(p.lifetime(entry.secret))) {
+		return entry.secret, nil
+	}
+
+	secret, err := p.provider.Get(ctx, path)
+	if err != nil {
+		return Secret{}, err
+	}
+	p.store(path, secret)
+	return secret, nil
+}
+
+// Start renews the cached leases which are two thirds through their lifetime, until ctx is done
+func (p *CachingProvider) Start(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				p.renewDue(ctx)
+			}
+		}
+	}()
+}
+
+// renewDue renews or reads again every secret past two thirds of its lifetime, a failure keeps the old value until it expires
+func (p *CachingProvider) renewDue(ctx context.Context) {
+	p.mutex.Lock()
+	due := map[string]Secret{}
+	for path, entry := range p.entries {
+		if time.Since(entry.fetched) >= p.lifetime(entry.secret)*2/3 {
+			due[path] = entry.secret
+		}
+	}
+	p.mutex.Unlock()
+
+	for path, secret := range due {
+		var renewed Secret
+		var err error
+		if renewer, ok := p.provider.(Renewer); ok && secret.Renewable && secret.LeaseID != "" {
+			renewed, err = renewer.Renew(ctx, secret)
+		} else {
+			renewed, err = p.provider.Get(ctx, path)
+		}
+		if err != nil {
+			log.Print("Error While Renewing Secret "+path+"::", err)
+			continue
+		}
+		p.store(path, renewed)
+	}
+}
+
+func (p *CachingProvider) store(path string, secret Secret) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.entries[path] = cacheEntry{secret: secret, fetched: time.Now()}
+}
+
+func (p *CachingProvider) lifetime(secret Secret) time.Duration {
+	if secret.LeaseDuration > 0 {
+		return secret.LeaseDuration
+	}
+	return p.ttl
+}
+
+var (
+	defaultMutex    sync.Mutex
+	defaultProvider Provider
+)
+
+// SetDefault replaces the provider used by Resolve
+func SetDefault(provider Provider) {
+	defaultMutex.Lock()
+	defer defaultMutex.Unlock()
+	defaultProvider = provider
+}
+
+// Default returns the provider used by Resolve, it is built by FromEnv on the first call
+func Default() (Provider, error) {
+	defaultMutex.Lock()
+	defer defaultMutex.Unlock()
+	if defaultProvider == nil {
+		provider, err := FromEnv()
+		if err != nil {
+			return nil, err
+		}
+		defaultProvider = provider
+	}
+	return defaultProvider, nil
+}
+
+// FromEnv builds a cached provider from SECRETS_PROVIDER (env, file or vault, env by default),
+// SECRETS_DIR for file, VAULT_ADDR, VAULT_TOKEN, VAULT_KV_MOUNT and VAULT_KV_VERSION for vault
+// and SECRETS_CACHE_TTL. The settings come from the environment because the config file may hold references.
+func FromEnv() (Provider, error) {
+	ttl := 5 * time.Minute
+	if value := os.Getenv("SECRETS_CACHE_TTL"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, fmt.Errorf("SECRETS_CACHE_TTL: %v", err)
+		}
+		ttl = parsed
+	}
+
+	var provider Provider
+	switch kind := os.Getenv("SECRETS_PROVIDER"); kind {
+	case "", "env":
+		provider = EnvProvider{}
+	case "file":
+		provider = FileProvider{Dir: os.Getenv("SECRETS_DIR")}
+	case "vault":
+		vault := NewVaultProvider(os.Getenv("VAULT_ADDR"), os.Getenv("VAULT_TOKEN"))
+		if mount := os.Getenv("VAULT_KV_MOUNT"); mount != "" {
+			vault.Mount = mount
+		}
+		if version := os.Getenv("VAULT_KV_VERSION"); version != "" {
+			parsed, err := strconv.Atoi(version)
+			if err != nil || (parsed != 1 && parsed != 2) {
+				return nil, fmt.Errorf("VAULT_KV_VERSION must be 1 or 2")
+			}
+			vault.KVVersion = parsed
+		}
+		provider = vault
+	default:
+		return nil, fmt.Errorf("SECRETS_PROVIDER must be env, file or vault, not %q", kind)
+	}
+
+	cache := NewCachingProvider(provider, ttl)
+	cache.Start(context.Background(), renewInterval(ttl))
+	return cache, nil
+}
+
+func renewInterval(ttl time.Duration) time.Duration {
+	if interval := ttl / 6; interval > time.Second {
+		return interval
+	}
+	return time.Second
+}
+
+// Resolve returns value unchanged, or the referenced secret when value is a secret:// reference
+func Resolve(ctx context.Context, value string) (string, error) {
+	if !IsReference(value) {
+		return value, nil
+	}
+	ref, err := ParseReference(value)
+	if err != nil {
+		return "", err
+	}
+	provider, err := Default()
+	if err != nil {
+		return "", err
+	}
+	return Lookup(ctx, provider, ref)
+}
+
+// ResolveString replaces every secret reference inside value, such as the password of a connection string
+func ResolveString(ctx context.Context, value string) (string, error) {
+	var resolveErr error
+	resolved := referencePattern.ReplaceAllStringFunc(value, func(reference string) string {
+		if resolveErr != nil {
+			return reference
+		}
+		secretValue, err := Resolve(ctx, reference)
+		if err != nil {
+			resolveErr = err
+			return reference
+		}
+		return secretValue
+	})
+	if resolveErr != nil {
+		return "", resolveErr
+	}
+	return resolved, nil
+}
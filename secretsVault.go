@@ -0,0 +1,147 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// VaultProvider reads a HashiCorp Vault KV secrets engine over its HTTP API
+type VaultProvider struct {
+	Address   string
+	Token     string
+	Mount     string
+	KVVersion int
+	Client    *http.Client
+}
+
+// vaultResponse is the part of a Vault answer used here, KV v2 nests the values in data.data
+type vaultResponse struct {
+	LeaseID       string          `json:"lease_id"`
+	LeaseDuration int             `json:"lease_duration"`
+	Renewable     bool            `json:"renewable"`
+	Data          json.RawMessage `json:"data"`
+	Errors        []string        `json:"errors"`
+}
+
+// NewVaultProvider reads the KV v2 engine mounted at secret
+func NewVaultProvider(address, token string) *VaultProvider {
+	return &VaultProvider{
+		Address:   strings.TrimRight(address, "/"),
+		Token:     token,
+		Mount:     "secret",
+		KVVersion: 2,
+		Client:    &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Get reads the latest version of the secret at path
+func (p *VaultProvider) Get(ctx context.Context, path string) (Secret, error) {
+	apiPath := p.Mount + "/" + strings.Trim(path, "/")
+	if p.KVVersion == 2 {
+		apiPath = p.Mount + "/data/" + strings.Trim(path, "/")
+	}
+	res, err := p.do(ctx, http.MethodGet, apiPath, nil)
+	if err != nil {
+		return Secret{}, err
+	}
+
+	data := res.Data
+	if p.KVVersion == 2 {
+		var versioned struct {
+			Data json.RawMessage `json:"data"`
+		}
+		if err := json.Unmarshal(res.Data, &versioned); err != nil {
+			return Secret{}, fmt.Errorf("vault %s: %v", apiPath, err)
+		}
+		data = versioned.Data
+	}
+	values := map[string]interface{}{}
+	if err := json.Unmarshal(data, &values); err != nil {
+		return Secret{}, fmt.Errorf("vault %s: %v", apiPath, err)
+	}
+
+	secret := res.secret()
+	for key, value := range values {
+		if text, ok := value.(string); ok {
+			secret.Data[key] = text
+		} else {
+			bs, _ := json.Marshal(value)
+			secret.Data[key] = string(bs)
+		}
+	}
+	return secret, nil
+}
+
+// Renew extends the lease of a dynamic secret, the values are kept
+func (p *VaultProvider) Renew(ctx context.Context, secret Secret) (Secret, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"lease_id":  secret.LeaseID,
+		"increment": int(secret.LeaseDuration / time.Second),
+	})
+	if err != nil {
+		return Secret{}, err
+	}
+	res, err := p.do(ctx, http.MethodPut, "sys/leases/renew", bytes.NewReader(body))
+	if err != nil {
+		return Secret{}, err
+	}
+	renewed := res.secret()
+	renewed.Data = secret.Data
+	return renewed, nil
+}
+
+// do calls the Vault API below /v1, a 404 is ErrNotFound
+func (p *VaultProvider) do(ctx context.Context, method, apiPath string, body io.Reader) (vaultResponse, error) {
+	res := vaultResponse{}
+	req, err := http.NewRequestWithContext(ctx, method, p.Address+"/v1/"+apiPath, body)
+	if err != nil {
+		return res, err
+	}
+	req.Header.Set("X-Vault-Token", p.Token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	client := p.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	httpRes, err := client.Do(req)
+	if err != nil {
+		return res, fmt.Errorf("vault %s: %v", apiPath, err)
+	}
+	defer httpRes.Body.Close()
+	bs, err := ioutil.ReadAll(io.LimitReader(httpRes.Body, 1<<20))
+	if err != nil {
+		return res, fmt.Errorf("vault %s: %v", apiPath, err)
+	}
+
+	if httpRes.StatusCode == http.StatusNotFound {
+		return res, ErrNotFound
+	}
+	if len(bs) != 0 {
+		if err := json.Unmarshal(bs, &res); err != nil {
+			return res, fmt.Errorf("vault %s: %v", apiPath, err)
+		}
+	}
+	if httpRes.StatusCode >= 300 {
+		return res, fmt.Errorf("vault %s: status %d %s", apiPath, httpRes.StatusCode, strings.Join(res.Errors, ", "))
+	}
+	return res, nil
+}
+
+func (res vaultResponse) secret() Secret {
+	return Secret{
+		Data:          map[string]string{},
+		LeaseID:       res.LeaseID,
+		LeaseDuration: time.Duration(res.LeaseDuration) * time.Second,
+		Renewable:     res.Renewable,
+	}
+}
@@ -0,0 +1,157 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParseReference(t *testing.T) {
+	ref, err := ParseReference("secret://db/mongo#password")
+	if err != nil || ref.Path != "db/mongo" || ref.Key != "password" {
+		t.Errorf("ParseReference() = %+v, %v", ref, err)
+	}
+	for _, value := range []string{"mongo#password", "secret://mongo", "secret://#password", "secret://mongo#"} {
+		if _, err := ParseReference(value); err == nil {
+			t.Errorf("ParseReference(%q) want an error", value)
+		}
+	}
+}
+
+func TestEnvProvider(t *testing.T) {
+	t.Setenv("DB_MONGO_PASSWORD", "hunter2")
+	value, err := Lookup(context.Background(), EnvProvider{}, Reference{Path: "db/mongo", Key: "password"})
+	if err != nil || value != "hunter2" {
+		t.Errorf("Lookup() = %q, %v", value, err)
+	}
+	if _, err := Lookup(context.Background(), EnvProvider{}, Reference{Path: "db/mongo", Key: "user"}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Lookup() of a missing key error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestFileProvider(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "redis"), 0700)
+	os.WriteFile(filepath.Join(dir, "redis", "password"), []byte("fromdir\n"), 0600)
+	os.WriteFile(filepath.Join(dir, "postgres.json"), []byte(`{"password": "fromjson"}`), 0600)
+	provider := FileProvider{Dir: dir}
+
+	if value, err := Lookup(context.Background(), provider, Reference{Path: "redis", Key: "password"}); err != nil || value != "fromdir" {
+		t.Errorf("Lookup(redis) = %q, %v", value, err)
+	}
+	if value, err := Lookup(context.Background(), provider, Reference{Path: "postgres", Key: "password"}); err != nil || value != "fromjson" {
+		t.Errorf("Lookup(postgres) = %q, %v", value, err)
+	}
+	if _, err := provider.Get(context.Background(), "mongo"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get(mongo) error = %v, want ErrNotFound", err)
+	}
+}
+
+// vaultStub answers like Vault for the KV v2 secret secret/mongo and renews the lease of every secret
+func vaultStub(t *testing.T, reads, renewals *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "test-token" {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"errors": ["permission denied"]}`))
+			return
+		}
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/v1/secret/data/mongo":
+			atomic.AddInt32(reads, 1)
+			w.Write([]byte(`{"lease_id": "mongo-lease", "lease_duration": 60, "renewable": true,
+				"data": {"data": {"username": "app", "password": "hunter2", "port": 27017}, "metadata": {"version": 3}}}`))
+		case r.Method == http.MethodPut && r.URL.Path == "/v1/sys/leases/renew":
+			atomic.AddInt32(renewals, 1)
+			body := map[string]interface{}{}
+			json.NewDecoder(r.Body).Decode(&body)
+			if body["lease_id"] != "mongo-lease" {
+				t.Errorf("renewed lease %v", body["lease_id"])
+			}
+			w.Write([]byte(`{"lease_id": "mongo-lease", "lease_duration": 120, "renewable": true}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"errors": []}`))
+		}
+	}))
+}
+
+func TestVaultProvider(t *testing.T) {
+	var reads, renewals int32
+	server := vaultStub(t, &reads, &renewals)
+	defer server.Close()
+	vault := NewVaultProvider(server.URL, "test-token")
+
+	secret, err := vault.Get(context.Background(), "mongo")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if secret.Data["password"] != "hunter2" || secret.Data["port"] != "27017" || secret.LeaseDuration != time.Minute || !secret.Renewable {
+		t.Errorf("Get() = %+v", secret)
+	}
+	if _, err := vault.Get(context.Background(), "redis"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get(redis) error = %v, want ErrNotFound", err)
+	}
+	if _, err := NewVaultProvider(server.URL, "bad-token").Get(context.Background(), "mongo"); err == nil {
+		t.Error("Get() with a bad token want an error")
+	}
+
+	renewed, err := vault.Renew(context.Background(), secret)
+	if err != nil || renewed.LeaseDuration != 2*time.Minute || renewed.Data["password"] != "hunter2" {
+		t.Errorf("Renew() = %+v, %v", renewed, err)
+	}
+}
+
+func TestCachingProviderRenewsLeases(t *testing.T) {
+	var reads, renewals int32
+	server := vaultStub(t, &reads, &renewals)
+	defer server.Close()
+	cache := NewCachingProvider(NewVaultProvider(server.URL, "test-token"), time.Minute)
+
+	for i := 0; i < 3; i++ {
+		if value, err := Lookup(context.Background(), cache, Reference{Path: "mongo", Key: "password"}); err != nil || value != "hunter2" {
+			t.Fatalf("Lookup() = %q, %v", value, err)
+		}
+	}
+	if reads != 1 {
+		t.Errorf("vault reads = %d, want 1 while the lease is valid", reads)
+	}
+
+	// age the entry past two thirds of its 60s lease
+	cache.mutex.Lock()
+	entry := cache.entries["mongo"]
+	entry.fetched = time.Now().Add(-45 * time.Second)
+	cache.entries["mongo"] = entry
+	cache.mutex.Unlock()
+	cache.renewDue(context.Background())
+
+	if renewals != 1 || reads != 1 {
+		t.Errorf("renewals, reads = %d, %d, want 1, 1", renewals, reads)
+	}
+	if secret, _ := cache.Get(context.Background(), "mongo"); secret.LeaseDuration != 2*time.Minute || secret.Data["username"] != "app" {
+		t.Errorf("renewed secret = %+v", secret)
+	}
+}
+
+func TestResolveString(t *testing.T) {
+	SetDefault(EnvProvider{})
+	defer SetDefault(nil)
+	t.Setenv("POSTGRES_PASSWORD", "hunter2")
+
+	resolved, err := ResolveString(context.Background(), "user=app password=secret://postgres#password dbname=mydb")
+	if err != nil || resolved != "user=app password=hunter2 dbname=mydb" {
+		t.Errorf("ResolveString() = %q, %v", resolved, err)
+	}
+	if value, err := Resolve(context.Background(), "plain"); err != nil || value != "plain" {
+		t.Errorf("Resolve(plain) = %q, %v", value, err)
+	}
+	if _, err := ResolveString(context.Background(), "password=secret://postgres#missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("ResolveString() error = %v, want ErrNotFound", err)
+	}
+}
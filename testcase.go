@@ -2,77 +2,122 @@
 package logic
 
 import (
+	"context"
 	"net/http"
 	"testing"
 
-	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 
+	mongohelper "digi-data-ingestion-client/clients/mongo"
 	"digi-data-ingestion-client/models"
-
-	mongoD "go.mongodb.org/mongo-driver/mongo"
 )
 
-// Mock the mongo functions for testing
-var mockUpdateDocData = func(collection *mongo.Collection, ctx *gin.Context, filter interface{}, update interface{}) error {
-	// Mock implementation
-	return nil
+// update is one call of the mocked UpdateDocData
+type update struct {
+	collection *mongo.Collection
+	filter     interface{}
+	update     interface{}
 }
 
-var mockFindDocData = func(collection *mongo.Collection, ctx *gin.Context, filter interface{}, opts ...*options.FindOneOptions) *mongo.SingleResult {
-	// Mock implementation
-	// You can customize the mock behavior based on your test cases
-	return &mongo.SingleResult{}
+// mockDocData replaces the mongo functions, every update of the customer gets customerCounts
+func mockDocData(t *testing.T, customerCounts mongohelper.UpdateCounts) *[]update {
+	// the driver connects lazily, the collections are only named
+	client, err := mongo.Connect(context.Background(), options.Client().ApplyURI("mongodb://127.0.0.1:1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mongohelper.CustomersCollection = client.Database("test").Collection("customers")
+	mongohelper.CustomerDevicesCollection = client.Database("test").Collection("customer_devices")
+
+	updates := &[]update{}
+	FindDocData = func(collection *mongo.Collection, ctx context.Context, filter interface{}, opts ...*options.FindOneOptions) *mongo.SingleResult {
+		return mongo.NewSingleResultFromDocument(bson.M{"docs": bson.A{}}, nil, nil)
+	}
+	UpdateDocData = func(collection *mongo.Collection, ctx context.Context, filter interface{}, change interface{}) (mongohelper.UpdateCounts, error) {
+		*updates = append(*updates, update{collection, filter, change})
+		if collection == mongohelper.CustomersCollection {
+			return customerCounts, nil
+		}
+		return mongohelper.UpdateCounts{Matched: 1, Modified: 1}, nil
+	}
+	WithDocTransaction = func(ctx context.Context, fn func(ctx context.Context) error) error {
+		return fn(ctx)
+	}
+	t.Cleanup(func() {
+		UpdateDocData, FindDocData, WithDocTransaction = mongohelper.UpdateOne, mongohelper.FindOne, mongohelper.WithTransaction
+		client.Disconnect(context.Background())
+	})
+	return updates
 }
 
 func TestSaveCustomerDocuments(t *testing.T) {
-	// Mock the mongo functions
-	UpdateDocData = mockUpdateDocData
-	FindDocData = mockFindDocData
-
-	// Test Case 1: Save documents successfully
-	ctx := &gin.Context{} // Mock Gin context
-	data := []models.DocumentData{
-		// Provide your test data
-	}
+	ctx := context.Background()
+	data := []models.DocumentData{{Number: "A1", DocType: "pan"}, {}, {Number: "B2", DocType: "aadhaar"}}
 	userRef := "testUserRef"
 	customerID := primitive.NewObjectID()
 	deviceID := primitive.NewObjectID()
 	androidID := "testAndroidID"
 
+	// Test Case 1: Save documents successfully
+	updates := mockDocData(t, mongohelper.UpdateCounts{Matched: 1, Modified: 1})
 	response := SaveCustomerDocuments(ctx, data, userRef, customerID, deviceID, androidID)
 
 	assert.True(t, response.Success)
 	assert.Equal(t, http.StatusOK, response.ResponseCode)
-
-	// Test Case 2: Duplicate documents
-	// Set up mock function to simulate finding existing documents
-	mockFindDocData = func(collection *mongoD.Collection, ctx *gin.Context, filter interface{}, opts ...*options.FindOneOptions) *mongoD.SingleResult {
-		return &mongoD.SingleResult{} // Simulate finding existing documents
+	assert.Equal(t, []string{"A1", "B2"}, response.Data.(SavedDocsData).AddedDocNumbers)
+	// one update per document, the empty one is skipped, then the device
+	if assert.Len(t, *updates, 3) {
+		assert.Equal(t, bson.M{"user_reference_number": userRef}, (*updates)[0].filter)
+		assert.Equal(t, mongohelper.CustomerDevicesCollection, (*updates)[2].collection)
 	}
-	FindDocData = mockFindDocData
 
-	// Call the function again with duplicate documents
+	// Test Case 2: Duplicate documents
+	updates = mockDocData(t, mongohelper.UpdateCounts{Matched: 1, Modified: 0})
 	response = SaveCustomerDocuments(ctx, data, userRef, customerID, deviceID, androidID)
 
 	assert.False(t, response.Success)
 	assert.Equal(t, http.StatusOK, response.ResponseCode)
 	assert.Contains(t, response.Message, "Duplicate documents found.")
+	assert.Equal(t, []string{"A1", "B2"}, response.Data.(SavedDocsData).DuplicateDocNumbers)
+	assert.Len(t, *updates, 2, "the device is not updated without a new document")
 
-	// Test Case 3: Empty documents
-	// Modify the mock function to simulate finding no existing documents
-	mockFindDocData = func(collection *mongoD.Collection, ctx *gin.Context, filter interface{}, opts ...*options.FindOneOptions) *mongoD.SingleResult {
-		return nil // Simulate not finding any existing documents
-	}
-	FindDocData = mockFindDocData
+	// Test Case 3: No customer with the user reference number
+	mockDocData(t, mongohelper.UpdateCounts{})
+	response = SaveCustomerDocuments(ctx, data, userRef, customerID, deviceID, androidID)
+
+	assert.False(t, response.Success)
+	assert.Equal(t, http.StatusNotFound, response.ResponseCode)
 
-	// Call the function with empty documents
-	response = SaveCustomerDocuments(ctx, []models.DocumentData{}, userRef, customerID, deviceID, androidID)
+	// Test Case 4: Empty documents
+	response = SaveCustomerDocuments(ctx, []models.DocumentData{{}}, userRef, customerID, deviceID, androidID)
 
 	assert.False(t, response.Success)
-	assert.Equal(t, http.StatusOK, response.ResponseCode)            // Update expected status code
-	assert.Contains(t, response.Message, "No docs found to insert.") // Update expected error message
+	assert.Contains(t, response.Message, "No docs found to insert")
+}
+
+func TestDocKeys(t *testing.T) {
+	// the keys of the duplicate check must be the ones DocumentData is stored with
+	raw, err := bson.Marshal(models.DocumentData{Number: "A1", DocType: "pan"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored := bson.M{}
+	if err := bson.Unmarshal(raw, &stored); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "A1", stored[docNumberKey])
+	assert.Equal(t, "pan", stored[docTypeKey])
+
+	// the documents are compared and pushed as literals
+	pipeline := pushDocUpdate(models.DocumentData{Number: "$A1", DocType: "pan"}, "2024-01-02 03:04:05")
+	raw, err = bson.Marshal(pipeline[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Contains(t, bson.Raw(raw).String(), `{"$literal": "$A1"}`)
+	assert.Contains(t, bson.Raw(raw).String(), `"$$doc.`+docNumberKey+`"`)
 }
@@ -1,38 +1,46 @@
 package validators
 
 import (
+	"TestProject/Server/GolangServer/validation"
 	"digi-model-engine/utils/exceptions"
-	"fmt"
 	"reflect"
 	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 	"github.com/go-playground/validator/v10"
 )
 
 // bind request data against the provided structs.
 func ValidateRequest(c *gin.Context, model interface{}) {
 
-	if err := c.ShouldBindJSON(&model); err != nil {
-		validationErrors := make(map[string]string)
-		if ve, ok := err.(validator.ValidationErrors); ok {
-			for _, fieldError := range ve {
-				fieldName := getFieldJSONTagName(model, fieldError.Field())
-				validationErrors[fieldName] = getErrorMsg(fieldError.Tag(), fieldName)
-			}
-			exceptions.BadRequest(validationErrors)
-		}
+	if err := c.ShouldBindJSON(model); err != nil {
+		exceptions.BadRequest(getValidationErrors(model, err))
 	}
 }
 
-// check validation error type to return proper error message
-func getErrorMsg(tag, fieldName string) string {
-	switch tag {
-	case "required":
-		return fmt.Sprintf("%s is a required field", fieldName)
-	default:
-		return "Request data format is not supported"
+// validate a model the caller decoded, as one item of a batch, and return its errors instead of failing the request.
+// nil means the model is valid.
+func ValidateModel(model interface{}) map[string]string {
+	if err := binding.Validator.ValidateStruct(model); err != nil {
+		return getValidationErrors(model, err)
+	}
+	return nil
+}
+
+// map the error of binding or validating model to error messages by json field name
+func getValidationErrors(model interface{}, err error) map[string]string {
+	validationErrors := make(map[string]string)
+	if ve, ok := err.(validator.ValidationErrors); ok {
+		for _, fieldError := range ve {
+			fieldName := getFieldJSONTagName(model, fieldError.Field())
+			validationErrors[fieldName] = validation.ErrorMessage(fieldError, fieldName)
+		}
+	} else {
+		// malformed json or a value of the wrong type
+		validationErrors["body"] = "Request data format is not supported"
 	}
+	return validationErrors
 }
 
 // return json tag name
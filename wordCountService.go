@@ -0,0 +1,222 @@
+package main
+
+import (
+	"TestProject/Server/GolangServer/apperrors"
+	"TestProject/Server/GolangServer/confighelper"
+	"TestProject/Server/GolangServer/model"
+	"TestProject/Server/GolangServer/validation"
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/labstack/echo/v4"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"golang.org/x/text/cases"
+)
+
+// Words left out when useStopwords is set
+var englishStopwords = []string{
+	"a", "about", "after", "all", "also", "an", "and", "any", "are", "as", "at", "be", "because", "been",
+	"but", "by", "can", "could", "did", "do", "does", "for", "from", "had", "has", "have", "he", "her",
+	"his", "how", "i", "if", "in", "into", "is", "it", "its", "just", "me", "more", "my", "no", "not",
+	"of", "on", "one", "or", "our", "out", "she", "so", "some", "than", "that", "the", "their", "them",
+	"then", "there", "these", "they", "this", "to", "up", "us", "was", "we", "were", "what", "when",
+	"which", "who", "will", "with", "would", "you", "your",
+}
+
+// Elements whose text is not page content
+var wordCountSkippedElements = map[atom.Atom]bool{
+	atom.Script:   true,
+	atom.Style:    true,
+	atom.Noscript: true,
+	atom.Template: true,
+}
+
+// One entry of the GetWordCountService response
+type wordFrequency struct {
+	Word  string `json:"word"`
+	Count int    `json:"count"`
+}
+
+// To get the word count of a URL, of the posted text or html, or of a raw text/plain or text/html body
+func GetWordCountService(c echo.Context) error {
+	maxBodyBytes := confighelper.Get().WordCountMaxBodyBytes
+	wordCountRequest := model.WordCountRequest{}
+
+	// the body is limited before anything reads it, a body without a length fails its read past the limit
+	if c.Request().ContentLength > maxBodyBytes {
+		return apperrors.Validation("invalid request", map[string]string{"body": fmt.Sprintf("content is larger than %d bytes", maxBodyBytes)})
+	}
+	c.Request().Body = http.MaxBytesReader(c.Response(), c.Request().Body, maxBodyBytes)
+
+	var content []byte
+	isHTML := false
+	mediaType, _, _ := mime.ParseMediaType(c.Request().Header.Get(echo.HeaderContentType))
+	switch mediaType {
+	case echo.MIMETextPlain, echo.MIMETextHTML:
+		body, err := readLimited(c.Request().Body, maxBodyBytes)
+		if err != nil {
+			return apperrors.Validation("invalid request", map[string]string{"body": err.Error()})
+		}
+		content, isHTML = body, mediaType == echo.MIMETextHTML
+	default:
+		if err := validation.BindAndValidate(c, &wordCountRequest); err != nil {
+			return err
+		}
+		switch {
+		case wordCountRequest.URL != "":
+			fetched, fetchedHTML, err := fetchWordCountPage(c, wordCountRequest.URL, maxBodyBytes)
+			if err != nil {
+				return err
+			}
+			content, isHTML = fetched, fetchedHTML
+		case wordCountRequest.HTML != "":
+			content, isHTML = []byte(wordCountRequest.HTML), true
+		default:
+			content = []byte(wordCountRequest.Text)
+		}
+		if int64(len(content)) > maxBodyBytes {
+			return apperrors.Validation("invalid request", map[string]string{"body": fmt.Sprintf("content is larger than %d bytes", maxBodyBytes)})
+		}
+	}
+
+	// top and useStopwords may also be given in the query string, mainly for raw bodies
+	top := wordCountRequest.Top
+	if value := c.QueryParam("top"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			return apperrors.Validation("invalid request", map[string]string{"top": "top must be 0 or greater"})
+		}
+		top = parsed
+	}
+	stopwords := map[string]bool{}
+	if wordCountRequest.UseStopwords || c.QueryParam("useStopwords") == "true" {
+		for _, word := range englishStopwords {
+			stopwords[word] = true
+		}
+	}
+	for _, word := range wordCountRequest.Stopwords {
+		stopwords[foldWord(word)] = true
+	}
+
+	text := string(content)
+	if isHTML {
+		text = extractHTMLText(bytes.NewReader(content))
+	}
+	return c.JSON(http.StatusOK, topWords(countWords(text, stopwords), top))
+}
+
+// fetchWordCountPage gets the page with a timeout and size limit, it tells whether the page is html
+func fetchWordCountPage(c echo.Context, url string, maxBodyBytes int64) ([]byte, bool, error) {
+	client := &http.Client{Timeout: confighelper.Get().WordCountFetchTimeout}
+
+	req, err := http.NewRequestWithContext(c.Request().Context(), http.MethodGet, url, nil)
+	if err != nil {
+		return nil, false, apperrors.Validation("invalid request", map[string]string{"url": "url must be a valid URL"})
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, false, apperrors.Upstream("Error While Fetching URL", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, false, apperrors.Upstream("Error While Fetching URL", fmt.Errorf("status %s", resp.Status))
+	}
+
+	body, err := readLimited(resp.Body, maxBodyBytes)
+	if err != nil {
+		return nil, false, apperrors.Upstream("Error While Reading data from URL", err)
+	}
+	contentType := resp.Header.Get(echo.HeaderContentType)
+	if contentType == "" {
+		contentType = http.DetectContentType(body)
+	}
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	return body, mediaType == echo.MIMETextHTML || mediaType == "application/xhtml+xml", nil
+}
+
+// readLimited reads r and fails when it holds more than limit bytes
+func readLimited(r io.Reader, limit int64) ([]byte, error) {
+	body, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > limit {
+		return nil, fmt.Errorf("content is larger than %d bytes", limit)
+	}
+	return body, nil
+}
+
+// extractHTMLText returns the text nodes of the document, leaving out script and style content
+func extractHTMLText(r io.Reader) string {
+	tokenizer := html.NewTokenizer(r)
+	var text strings.Builder
+	skipDepth := 0
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			return text.String()
+		case html.StartTagToken:
+			name, _ := tokenizer.TagName()
+			if wordCountSkippedElements[atom.Lookup(name)] {
+				skipDepth++
+			}
+		case html.EndTagToken:
+			name, _ := tokenizer.TagName()
+			if wordCountSkippedElements[atom.Lookup(name)] && skipDepth > 0 {
+				skipDepth--
+			}
+		case html.TextToken:
+			if skipDepth == 0 {
+				text.Write(tokenizer.Text())
+				text.WriteByte(' ')
+			}
+		}
+	}
+}
+
+// countWords splits text on anything that is not a letter, mark, digit or inner apostrophe
+func countWords(text string, stopwords map[string]bool) map[string]int {
+	words := strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsMark(r) && !unicode.IsDigit(r) && r != '\'' && r != '’'
+	})
+	counts := make(map[string]int)
+	for _, word := range words {
+		word = foldWord(strings.Trim(word, "'’"))
+		if word == "" || stopwords[word] {
+			continue
+		}
+		counts[word]++
+	}
+	return counts
+}
+
+// foldWord case folds a word so "Go", "GO" and "go" are counted together
+func foldWord(word string) string {
+	return cases.Fold().String(word)
+}
+
+// topWords sorts by count then word, top 0 keeps every word
+func topWords(counts map[string]int, top int) []wordFrequency {
+	list := make([]wordFrequency, 0, len(counts))
+	for word, count := range counts {
+		list = append(list, wordFrequency{Word: word, Count: count})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Count != list[j].Count {
+			return list[i].Count > list[j].Count
+		}
+		return list[i].Word < list[j].Word
+	})
+	if top > 0 && top < len(list) {
+		list = list[:top]
+	}
+	return list
+}
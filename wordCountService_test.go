@@ -0,0 +1,120 @@
+package main
+
+import (
+	"TestProject/Server/GolangServer/apperrors"
+	"TestProject/Server/GolangServer/confighelper"
+	"TestProject/Server/GolangServer/validation"
+
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+func newWordCountTestServer() *echo.Echo {
+	e := echo.New()
+	e.HTTPErrorHandler = apperrors.HTTPErrorHandler
+	e.Validator = validation.NewEchoValidator()
+	e.POST("/getWordCountService", GetWordCountService)
+	return e
+}
+
+func postWordCount(e *echo.Echo, contentType string, body io.Reader, query string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/getWordCountService"+query, body)
+	req.Header.Set(echo.HeaderContentType, contentType)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func wordCountResponse(t *testing.T, rec *httptest.ResponseRecorder) []wordFrequency {
+	t.Helper()
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	words := []wordFrequency{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &words); err != nil {
+		t.Fatal(err)
+	}
+	return words
+}
+
+func TestCountWords(t *testing.T) {
+	counts := countWords("Go, GO go! Don't 'stop' the café—Café 42", map[string]bool{"the": true})
+	want := map[string]int{"go": 3, "don't": 1, "stop": 1, "café": 2, "42": 1}
+	if !reflect.DeepEqual(counts, want) {
+		t.Errorf("counts = %v, want %v", counts, want)
+	}
+}
+
+func TestExtractHTMLText(t *testing.T) {
+	text := extractHTMLText(strings.NewReader(`<html><head><style>p { color: red }</style><script>var hidden = 1</script></head>` +
+		`<body><p>Hello <b>world</b></p><noscript>enable</noscript></body></html>`))
+	if fields := strings.Fields(text); !reflect.DeepEqual(fields, []string{"Hello", "world"}) {
+		t.Errorf("text = %q, want only the page content", text)
+	}
+}
+
+func TestTopWords(t *testing.T) {
+	counts := map[string]int{"b": 2, "a": 2, "c": 5, "d": 1}
+	if list := topWords(counts, 3); !reflect.DeepEqual(list, []wordFrequency{{"c", 5}, {"a", 2}, {"b", 2}}) {
+		t.Errorf("top 3 = %v", list)
+	}
+	if list := topWords(counts, 0); len(list) != 4 {
+		t.Errorf("top 0 = %v, want every word", list)
+	}
+}
+
+func TestGetWordCountService(t *testing.T) {
+	e := newWordCountTestServer()
+
+	words := wordCountResponse(t, postWordCount(e, echo.MIMEApplicationJSON,
+		strings.NewReader(`{"text":"the cat and the hat and the bat","top":2,"stopwords":["The"]}`), ""))
+	if !reflect.DeepEqual(words, []wordFrequency{{"and", 2}, {"bat", 1}}) {
+		t.Errorf("json text = %v", words)
+	}
+
+	words = wordCountResponse(t, postWordCount(e, echo.MIMETextHTML,
+		strings.NewReader(`<p>The page and the <script>code</script>page</p>`), "?useStopwords=true"))
+	if !reflect.DeepEqual(words, []wordFrequency{{"page", 2}}) {
+		t.Errorf("raw html = %v", words)
+	}
+
+	page := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(echo.HeaderContentType, echo.MIMETextHTMLCharsetUTF8)
+		io.WriteString(w, "<title>Fetched</title><p>fetched words</p>")
+	}))
+	defer page.Close()
+	words = wordCountResponse(t, postWordCount(e, echo.MIMEApplicationJSON, strings.NewReader(`{"url":"`+page.URL+`"}`), ""))
+	if !reflect.DeepEqual(words, []wordFrequency{{"fetched", 2}, {"words", 1}}) {
+		t.Errorf("url = %v", words)
+	}
+}
+
+func TestGetWordCountServiceRejects(t *testing.T) {
+	e := newWordCountTestServer()
+	maxBodyBytes := confighelper.Get().WordCountMaxBodyBytes
+	large := `{"text":"` + strings.Repeat("a ", int(maxBodyBytes)) + `"}`
+
+	for name, c := range map[string]struct {
+		contentType string
+		body        io.Reader
+		query       string
+	}{
+		"no content":  {echo.MIMEApplicationJSON, strings.NewReader(`{}`), ""},
+		"bad url":     {echo.MIMEApplicationJSON, strings.NewReader(`{"url":"not a url"}`), ""},
+		"bad top":     {echo.MIMETextPlain, strings.NewReader("words"), "?top=-1"},
+		"large json":  {echo.MIMEApplicationJSON, strings.NewReader(large), ""},
+		"large text":  {echo.MIMETextPlain, strings.NewReader(large), ""},
+		"large chunk": {echo.MIMEApplicationJSON, io.MultiReader(strings.NewReader(large)), ""},
+	} {
+		if rec := postWordCount(e, c.contentType, c.body, c.query); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400: %.200s", name, rec.Code, rec.Body)
+		}
+	}
+}